@@ -1,8 +1,10 @@
 package adapters
 
 import (
+	"NewListingBot/decimal"
 	"errors"
 	"github.com/go-playground/validator/v10"
+	"reflect"
 	"regexp"
 	"strings"
 )
@@ -23,6 +25,10 @@ func (v *ValidateStruct) ValidateData(model interface{}) map[string]string {
 	/* this is used to validate models in which  we used instead of the creation serializer*/
 	// Validate the login request struct
 	var validate = validator.New()
+	// the amounts are checked by their value, like gt=0
+	validate.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		return field.Interface().(decimal.Decimal).Float64()
+	}, decimal.Decimal{})
 
 	if err := validate.Struct(model); err != nil {
 		// Cast the error to validator.ValidationErrors to access the actual errors
@@ -0,0 +1,77 @@
+package announcements
+
+import (
+	"NewListingBot/logger"
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Ingester polls the sources and hands every listing found in a new announcement to the handler
+type Ingester struct {
+	sources  []Source
+	parser   *Parser
+	interval time.Duration
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func NewIngester(parser *Parser, interval time.Duration, sources ...Source) *Ingester {
+	return &Ingester{
+		sources:  sources,
+		parser:   parser,
+		interval: interval,
+		seen:     map[string]bool{},
+	}
+}
+
+// Poll fetches every source once and returns the listings of the announcements not seen before,
+// a failing source does not stop the others
+func (i *Ingester) Poll(ctx context.Context) []Listing {
+	var listings []Listing
+
+	for _, source := range i.sources {
+		fetched, err := source.Fetch(ctx)
+		if err != nil {
+			logger.Error(ctx, "error fetching announcements", zap.String("source", source.Name()), zap.Error(err))
+			continue
+		}
+
+		for _, announcement := range fetched {
+			i.mu.Lock()
+			seen := i.seen[announcement.Key()]
+			i.seen[announcement.Key()] = true
+			i.mu.Unlock()
+
+			if seen {
+				continue
+			}
+
+			if listing, ok := i.parser.Parse(announcement); ok {
+				listings = append(listings, listing)
+			}
+		}
+	}
+
+	return listings
+}
+
+// Start polls the sources every interval until the context is done
+func (i *Ingester) Start(ctx context.Context, handler func(Listing)) {
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, listing := range i.Poll(ctx) {
+			handler(listing)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package announcements
+
+import (
+	"NewListingBot/logger"
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSourcesReadFixtures(t *testing.T) {
+	tests := []struct {
+		source Source
+		keys   []string
+		urls   []string
+	}{
+		{
+			source: NewFeedSource("rss", "testdata/rss.xml"),
+			keys:   []string{"rss:rss-1001", "rss:rss-1002", "rss:rss-1003"},
+			urls: []string{
+				"https://exchange.example/announcements/1001",
+				"https://exchange.example/announcements/1002",
+				"https://exchange.example/announcements/1003",
+			},
+		},
+		{
+			source: NewFeedSource("atom", "file://testdata/atom.xml"),
+			keys:   []string{"atom:urn:exchange:listings:2001", "atom:urn:exchange:listings:2002"},
+			urls:   []string{"https://exchange.example/listings/2001", "https://exchange.example/listings/2002"},
+		},
+		{
+			source: NewJSONSource("json", "testdata/announcements.json"),
+			keys:   []string{"json:3001", "json:3002"},
+			urls:   []string{"https://exchange.example/news/3001", "https://exchange.example/news/3002"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source.Name(), func(t *testing.T) {
+			fetched, err := test.source.Fetch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fetched) != len(test.keys) {
+				t.Fatalf("fetched %d announcements, want %d", len(fetched), len(test.keys))
+			}
+
+			for i, announcement := range fetched {
+				if announcement.Key() != test.keys[i] {
+					t.Errorf("key = %s, want %s", announcement.Key(), test.keys[i])
+				}
+				if announcement.URL != test.urls[i] {
+					t.Errorf("url = %s, want %s", announcement.URL, test.urls[i])
+				}
+				if announcement.Body == "" {
+					t.Errorf("announcement %s has no body", announcement.Key())
+				}
+				if announcement.PublishedAt.IsZero() {
+					t.Errorf("announcement %s has no publish time", announcement.Key())
+				}
+			}
+		})
+	}
+}
+
+func TestIngesterPollFixtures(t *testing.T) {
+	// the missing feed gets logged
+	logger.InitLogger()
+
+	ingester := NewIngester(NewParser([]string{"USDT", "USDC"}), time.Minute,
+		NewFeedSource("rss", "testdata/rss.xml"),
+		NewFeedSource("atom", "testdata/atom.xml"),
+		NewJSONSource("json", "testdata/announcements.json"),
+		NewFeedSource("missing", "testdata/missing.xml"),
+	)
+
+	listings := ingester.Poll(context.Background())
+
+	got := map[string]string{}
+	for _, listing := range listings {
+		openTime := ""
+		if listing.OpenTime != nil {
+			openTime = listing.OpenTime.UTC().Format(time.RFC3339)
+		}
+		got[listing.Symbol] = openTime
+	}
+
+	want := map[string]string{
+		"FOOUSDT": "2030-05-10T10:00:00Z",
+		"BARUSDT": "2030-05-11T06:30:00Z",
+		"QUXUSDC": "2030-05-12T08:00:00Z",
+		"BAZUSDT": "2030-05-13T16:00:00Z",
+	}
+
+	if len(got) != len(want) || len(listings) != len(want) {
+		var symbols []string
+		for symbol := range got {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+		t.Fatalf("listings = %v, want %d listings", symbols, len(want))
+	}
+	for symbol, openTime := range want {
+		if got[symbol] != openTime {
+			t.Errorf("%s opens at %q, want %q", symbol, got[symbol], openTime)
+		}
+	}
+
+	if again := ingester.Poll(context.Background()); len(again) != 0 {
+		t.Errorf("second poll returned %d listings, want none", len(again))
+	}
+}
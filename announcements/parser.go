@@ -0,0 +1,146 @@
+package announcements
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Listing is what an announcement tells about an upcoming listing, OpenTime is nil when no time was found
+type Listing struct {
+	Announcement Announcement `json:"announcement"`
+	Symbol       string       `json:"symbol"`
+	BaseAsset    string       `json:"base_asset"`
+	QuoteAsset   string       `json:"quote_asset"`
+	OpenTime     *time.Time   `json:"open_time"`
+}
+
+var (
+	htmlTagPattern = regexp.MustCompile(`<[^>]+>`)
+	tickerPattern  = regexp.MustCompile(`\(([A-Z0-9]{2,15})\)`)
+
+	// words written in parentheses like a ticker that never are one, the time zones and the token standards
+	notTickers = map[string]bool{
+		"UTC": true, "GMT": true,
+		"ERC20": true, "BEP20": true, "BEP2": true, "TRC20": true, "SPL": true, "ARC20": true, "BRC20": true,
+		"SRC20": true, "KRC20": true,
+	}
+
+	// 2024-05-10 10:00 (UTC), 2024-05-10T10:00:00 UTC+8
+	isoTimePattern = regexp.MustCompile(`(\d{4}-\d{1,2}-\d{1,2})[ T,]+(\d{1,2}:\d{2}(?::\d{2})?)\s*\(?\s*(?:UTC|GMT)\s*([+-]\s*\d{1,2})?\s*\)?`)
+	// May 10, 2024, 10:00 (UTC), May 10, 2024 at 10:00 UTC
+	textTimePattern = regexp.MustCompile(`(?i)\b(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Sept|Oct|Nov|Dec)[a-z]*\.?\s+(\d{1,2}),?\s+(\d{4}),?\s*(?:at\s+)?(\d{1,2}:\d{2}(?::\d{2})?)\s*\(?\s*(?:UTC|GMT)\s*([+-]\s*\d{1,2})?\s*\)?`)
+)
+
+// Parser pulls the listings out of the announcements
+type Parser struct {
+	quoteAssets []string
+	pairPattern *regexp.Regexp
+}
+
+// NewParser builds a parser for pairs quoted in one of the assets, the first one is assumed
+// when an announcement only names the token
+func NewParser(quoteAssets []string) *Parser {
+	var quotes []string
+	for _, quoteAsset := range quoteAssets {
+		quoteAsset = strings.ToUpper(strings.TrimSpace(quoteAsset))
+		if quoteAsset != "" {
+			quotes = append(quotes, regexp.QuoteMeta(quoteAsset))
+		}
+	}
+	if len(quotes) == 0 {
+		quotes = []string{"USDT"}
+	}
+
+	return &Parser{
+		quoteAssets: quotes,
+		pairPattern: regexp.MustCompile(`\b([A-Z0-9]{2,15})\s*[/_]\s*(` + strings.Join(quotes, "|") + `)\b`),
+	}
+}
+
+// Parse returns the listing of the announcement, false when it does not name a token
+func (p *Parser) Parse(announcement Announcement) (Listing, bool) {
+	body := htmlTagPattern.ReplaceAllString(announcement.Body, " ")
+	listing := Listing{Announcement: announcement}
+
+	for _, text := range []string{announcement.Title, body} {
+		if match := p.pairPattern.FindStringSubmatch(text); match != nil {
+			listing.BaseAsset, listing.QuoteAsset = match[1], match[2]
+			break
+		}
+	}
+
+	if listing.BaseAsset == "" {
+		for _, text := range []string{announcement.Title, body} {
+			if ticker, ok := findTicker(text); ok {
+				listing.BaseAsset, listing.QuoteAsset = ticker, p.quoteAssets[0]
+				break
+			}
+		}
+	}
+
+	if listing.BaseAsset == "" {
+		return listing, false
+	}
+	listing.Symbol = listing.BaseAsset + listing.QuoteAsset
+
+	for _, text := range []string{announcement.Title, body} {
+		if openTime, ok := parseOpenTime(text); ok {
+			listing.OpenTime = &openTime
+			break
+		}
+	}
+
+	return listing, true
+}
+
+// findTicker returns the first word in parentheses that can be a ticker, "Foo (FOO) (ERC20)" is FOO
+func findTicker(text string) (string, bool) {
+	for _, match := range tickerPattern.FindAllStringSubmatch(text, -1) {
+		if !notTickers[match[1]] {
+			return match[1], true
+		}
+	}
+	return "", false
+}
+
+// parseOpenTime finds the first UTC date and time written in the text
+func parseOpenTime(text string) (time.Time, bool) {
+	if match := isoTimePattern.FindStringSubmatch(text); match != nil {
+		parsed, err := time.Parse("2006-1-2 15:04:05", match[1]+" "+withSeconds(match[2]))
+		if err == nil {
+			return applyUTCOffset(parsed, match[3]), true
+		}
+	}
+
+	if match := textTimePattern.FindStringSubmatch(text); match != nil {
+		month := strings.ToUpper(match[1][:1]) + strings.ToLower(match[1][1:3])
+		parsed, err := time.Parse("Jan 2 2006 15:04:05", fmt.Sprintf("%s %s %s %s", month, match[2], match[3], withSeconds(match[4])))
+		if err == nil {
+			return applyUTCOffset(parsed, match[5]), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func withSeconds(clock string) string {
+	if strings.Count(clock, ":") == 1 {
+		clock += ":00"
+	}
+	if len(clock) == len("5:04:05") {
+		clock = "0" + clock
+	}
+	return clock
+}
+
+// applyUTCOffset turns a time written in UTC+offset into UTC
+func applyUTCOffset(parsed time.Time, offset string) time.Time {
+	hours, err := strconv.Atoi(strings.ReplaceAll(offset, " ", ""))
+	if err != nil {
+		return parsed
+	}
+	return parsed.Add(-time.Duration(hours) * time.Hour)
+}
@@ -0,0 +1,165 @@
+package announcements
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	parser := NewParser([]string{"USDT", "USDC"})
+
+	tests := []struct {
+		name     string
+		title    string
+		body     string
+		symbol   string
+		openTime string
+		ok       bool
+	}{
+		{
+			name:     "pair in the title",
+			title:    "New Listing: FOO/USDT Trading Starts 2030-05-10 10:00 (UTC)",
+			symbol:   "FOOUSDT",
+			openTime: "2030-05-10T10:00:00Z",
+			ok:       true,
+		},
+		{
+			name:     "pair in the body",
+			title:    "Initial Listing of Qux Network",
+			body:     "<p>QUX_USDC spot trading opens at 2030-05-12T08:00:00 UTC.</p>",
+			symbol:   "QUXUSDC",
+			openTime: "2030-05-12T08:00:00Z",
+			ok:       true,
+		},
+		{
+			name:     "ticker quoted in the first asset",
+			title:    "Exchange Will List Bar Protocol (BAR)",
+			body:     "Trading opens on May 11, 2030, 14:30 (UTC+8).",
+			symbol:   "BARUSDT",
+			openTime: "2030-05-11T06:30:00Z",
+			ok:       true,
+		},
+		{
+			name:   "network tag after the ticker",
+			title:  "Exchange Will List Bar Protocol (BAR) (ERC20)",
+			symbol: "BARUSDT",
+			ok:     true,
+		},
+		{
+			name:   "network tag before the ticker",
+			title:  "Deposits of the (BEP20) network for Baz (BAZ) are open",
+			symbol: "BAZUSDT",
+			ok:     true,
+		},
+		{
+			name:  "network tag only",
+			title: "Scheduled Wallet Maintenance (BEP20)",
+			body:  "Deposits will be suspended at 2030-05-09 02:00 (UTC).",
+			ok:    false,
+		},
+		{
+			name:  "no token",
+			title: "Airdrop Campaign Results",
+			body:  "<p>Rewards were distributed to the winners.</p>",
+			ok:    false,
+		},
+		{
+			name:   "no open time",
+			title:  "Listing FOO/USDC soon",
+			symbol: "FOOUSDC",
+			ok:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listing, ok := parser.Parse(Announcement{Title: test.title, Body: test.body})
+			if ok != test.ok {
+				t.Fatalf("ok = %v, want %v", ok, test.ok)
+			}
+			if !ok {
+				return
+			}
+
+			if listing.Symbol != test.symbol {
+				t.Errorf("symbol = %s, want %s", listing.Symbol, test.symbol)
+			}
+
+			if test.openTime == "" {
+				if listing.OpenTime != nil {
+					t.Errorf("open time = %s, want none", listing.OpenTime)
+				}
+				return
+			}
+			if listing.OpenTime == nil {
+				t.Fatalf("open time missing, want %s", test.openTime)
+			}
+			if got := listing.OpenTime.UTC().Format(time.RFC3339); got != test.openTime {
+				t.Errorf("open time = %s, want %s", got, test.openTime)
+			}
+		})
+	}
+}
+
+func TestParseOpenTime(t *testing.T) {
+	tests := []struct {
+		text     string
+		openTime string
+	}{
+		{"2030-05-10 10:00 (UTC)", "2030-05-10T10:00:00Z"},
+		{"2030-5-1 9:05 UTC", "2030-05-01T09:05:00Z"},
+		{"2030-05-10T10:00:00 UTC+8", "2030-05-10T02:00:00Z"},
+		{"2030-05-10 10:00:30 (UTC-3)", "2030-05-10T13:00:30Z"},
+		{"2030-05-10, 10:00 GMT", "2030-05-10T10:00:00Z"},
+		{"May 10, 2030, 10:00 (UTC)", "2030-05-10T10:00:00Z"},
+		{"Sept 3 2030 at 7:15 UTC", "2030-09-03T07:15:00Z"},
+		{"december 31, 2030 23:00 (UTC+2)", "2030-12-31T21:00:00Z"},
+		{"opens on 2030-05-10 at 10:00", ""},
+		{"no date here", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			openTime, ok := parseOpenTime(test.text)
+			if test.openTime == "" {
+				if ok {
+					t.Errorf("parsed %s, want nothing", openTime)
+				}
+				return
+			}
+
+			if !ok {
+				t.Fatalf("nothing parsed, want %s", test.openTime)
+			}
+			if got := openTime.Format(time.RFC3339); got != test.openTime {
+				t.Errorf("open time = %s, want %s", got, test.openTime)
+			}
+		})
+	}
+}
+
+func TestFindTicker(t *testing.T) {
+	tests := []struct {
+		text   string
+		ticker string
+	}{
+		{"Foo Token (FOO)", "FOO"},
+		{"Foo Token (FOO) (ERC20)", "FOO"},
+		{"(BEP20) Foo Token (FOO)", "FOO"},
+		{"Opens 10:00 (UTC) for Foo (FOO)", "FOO"},
+		{"1INCH Network (1INCH)", "1INCH"},
+		{"Wallet maintenance (TRC20) (BEP2) (SPL)", ""},
+		{"Opens at 10:00 (GMT)", ""},
+		{"lowercase (foo) is not a ticker", ""},
+		{"single letter (X) is not a ticker", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			ticker, ok := findTicker(test.text)
+			if ok != (test.ticker != "") || ticker != test.ticker {
+				t.Errorf("ticker = %q %v, want %q", ticker, ok, test.ticker)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package announcements
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Announcement is a single post of an announcement source
+type Announcement struct {
+	Source      string    `json:"source"`
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Key identifies the announcement across the sources
+func (a Announcement) Key() string {
+	return a.Source + ":" + a.ID
+}
+
+// Source is anything announcements can be fetched from
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) ([]Announcement, error)
+}
+
+// readFeed returns the content of a feed, plain paths and file:// urls are read from disk
+// so recorded feeds can be replayed
+func readFeed(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make GET request: %v", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed %s answered with status code %d", location, response.StatusCode)
+	}
+
+	return body, nil
+}
+
+// FeedSource reads an RSS 2.0 or Atom feed
+type FeedSource struct {
+	name string
+	url  string
+}
+
+func NewFeedSource(name string, url string) *FeedSource {
+	return &FeedSource{name: name, url: url}
+}
+
+func (s *FeedSource) Name() string {
+	return s.name
+}
+
+type rssFeed struct {
+	Items []struct {
+		GUID        string `xml:"guid"`
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		PubDate     string `xml:"pubDate"`
+	} `xml:"channel>item"`
+}
+
+type atomFeed struct {
+	Entries []struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+func (s *FeedSource) Fetch(ctx context.Context) ([]Announcement, error) {
+	body, err := readFeed(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(body, &root); err != nil {
+		return nil, fmt.Errorf("error decoding feed %s: %v", s.name, err)
+	}
+
+	var announcements []Announcement
+
+	if root.XMLName.Local == "feed" {
+		var feed atomFeed
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			return nil, fmt.Errorf("error decoding atom feed %s: %v", s.name, err)
+		}
+
+		for _, entry := range feed.Entries {
+			announcement := Announcement{
+				Source:      s.name,
+				ID:          entry.ID,
+				Title:       strings.TrimSpace(entry.Title),
+				Body:        entry.Content,
+				PublishedAt: parseFeedTime(entry.Published, entry.Updated),
+			}
+			if announcement.Body == "" {
+				announcement.Body = entry.Summary
+			}
+			if len(entry.Links) > 0 {
+				announcement.URL = entry.Links[0].Href
+			}
+			if announcement.ID == "" {
+				announcement.ID = announcement.URL
+			}
+			announcements = append(announcements, announcement)
+		}
+
+		return announcements, nil
+	}
+
+	var feed rssFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("error decoding rss feed %s: %v", s.name, err)
+	}
+
+	for _, item := range feed.Items {
+		announcement := Announcement{
+			Source:      s.name,
+			ID:          item.GUID,
+			Title:       strings.TrimSpace(item.Title),
+			Body:        item.Description,
+			URL:         strings.TrimSpace(item.Link),
+			PublishedAt: parseFeedTime(item.PubDate),
+		}
+		if announcement.ID == "" {
+			announcement.ID = announcement.URL
+		}
+		announcements = append(announcements, announcement)
+	}
+
+	return announcements, nil
+}
+
+// parseFeedTime returns the first of the values that is a valid feed date
+func parseFeedTime(values ...string) time.Time {
+	layouts := []string{time.RFC3339, time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST"}
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		for _, layout := range layouts {
+			if parsed, err := time.Parse(layout, value); err == nil {
+				return parsed
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+// JSONSource reads a json feed, either a list of announcements or an object holding them
+// under "items", "data" or "articles", with the fields named like the Announcement json
+type JSONSource struct {
+	name string
+	url  string
+}
+
+func NewJSONSource(name string, url string) *JSONSource {
+	return &JSONSource{name: name, url: url}
+}
+
+func (s *JSONSource) Name() string {
+	return s.name
+}
+
+type jsonItem struct {
+	ID          json.RawMessage `json:"id"`
+	Title       string          `json:"title"`
+	Body        string          `json:"body"`
+	Content     string          `json:"content"`
+	URL         string          `json:"url"`
+	PublishedAt json.RawMessage `json:"published_at"`
+}
+
+func (s *JSONSource) Fetch(ctx context.Context) ([]Announcement, error) {
+	body, err := readFeed(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []jsonItem
+	if err := json.Unmarshal(body, &items); err != nil {
+		var wrapped struct {
+			Items    []jsonItem `json:"items"`
+			Data     []jsonItem `json:"data"`
+			Articles []jsonItem `json:"articles"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return nil, fmt.Errorf("error decoding json feed %s: %v", s.name, err)
+		}
+		items = append(append(wrapped.Items, wrapped.Data...), wrapped.Articles...)
+	}
+
+	announcements := make([]Announcement, 0, len(items))
+	for _, item := range items {
+		announcement := Announcement{
+			Source:      s.name,
+			ID:          strings.Trim(string(item.ID), `"`),
+			Title:       strings.TrimSpace(item.Title),
+			Body:        item.Body,
+			URL:         item.URL,
+			PublishedAt: parseJSONTime(item.PublishedAt),
+		}
+		if announcement.Body == "" {
+			announcement.Body = item.Content
+		}
+		if announcement.ID == "" {
+			announcement.ID = announcement.URL
+		}
+		announcements = append(announcements, announcement)
+	}
+
+	return announcements, nil
+}
+
+// parseJSONTime reads a date given as a string or as unix milliseconds
+func parseJSONTime(value json.RawMessage) time.Time {
+	var milliseconds int64
+	if err := json.Unmarshal(value, &milliseconds); err == nil {
+		return time.UnixMilli(milliseconds)
+	}
+
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		return parseFeedTime(text)
+	}
+
+	return time.Time{}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"NewListingBot/config"
+	"NewListingBot/decimal"
 	"NewListingBot/exchange"
 	"NewListingBot/logger"
 	"context"
@@ -19,18 +20,14 @@ func main() {
 	// Mock MEXCExchange instance
 	mexc := exchange.NewMXCExchange(cfg) // Replace with your actual implementation
 
-	buy, err := mexc.Buy("KASUSDT", 100)
+	buy, err := mexc.PlaceMarketOrder(exchange.OrderRequest{
+		Symbol:        "KASUSDT",
+		Side:          exchange.OrderSideBuy,
+		Type:          exchange.OrderTypeMarket,
+		QuoteOrderQty: decimal.New(100),
+	})
 	if err != nil {
 		return
 	}
 	log.Println(buy)
 }
-
-// Helper functions for creating pointers
-func strPtr(s string) *string {
-	return &s
-}
-
-func float64Ptr(f float64) *float64 {
-	return &f
-}
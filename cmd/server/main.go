@@ -1,15 +1,24 @@
 package main
 
 import (
+	"NewListingBot/config"
+	"NewListingBot/database"
+	"NewListingBot/exchange"
 	lmLogger "NewListingBot/logger"
 	"NewListingBot/middleware"
 	"NewListingBot/migrate"
+	"NewListingBot/models"
 	"NewListingBot/routes"
+	"NewListingBot/scheduler"
+	"context"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -29,6 +38,45 @@ func main() {
 	// Make migrations
 	migrate.MigrateDatabase()
 
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Error loading config", err)
+	}
+
+	// everything started below stops with the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// keep the MEXC clock in sync so buys fire and get signed on exchange time,
+	// the armed jobs are re-armed when the offset moves
+	mexcClock := exchange.StartMEXCClock(ctx, cfg, func(change time.Duration) {
+		scheduler.Default.ClockChanged(change)
+	})
+	scheduler.Default.SetClock(mexcClock)
+
+	// live prices for the buy engine and the exits
+	exchange.StartMEXCMarketStream(ctx, cfg)
+
+	// executions and balances of our own orders as they happen
+	models.ListenExchangeEvents(database.DBConnection())
+	exchange.StartMEXCUserStream(ctx, cfg)
+
+	// spot the new listings on the exchange info
+	models.StartListingWatcher(ctx, database.DBConnection(), cfg)
+
+	// propose draft orders from the listing announcements
+	models.StartAnnouncementIngestion(ctx, database.DBConnection(), cfg)
+
+	// exits of the bought orders, stopped with the server
+	models.StartPositionMonitor(ctx, database.DBConnection(), cfg)
+
+	// follow the on-chain transactions until they are mined, replacing the stuck ones
+	models.ListenChainTransactions(database.DBConnection())
+	models.StartTransactionTracker(ctx, database.DBConnection(), cfg)
+
+	// re-arm the jobs that were pending before the restart
+	models.RecoverScheduledJobs(ctx, database.DBConnection())
+
 	app.Use(middleware.CustomHeaderMiddleware())
 
 	// Register user routes
@@ -40,6 +88,15 @@ func main() {
 		port = "8005"
 	}
 
+	go func() {
+		<-ctx.Done()
+		if err := app.Shutdown(); err != nil {
+			log.Println("error shutting down the server", err)
+		}
+	}()
+
 	log.Printf("Server listening on port %s", port)
-	log.Fatal(app.Listen(":" + port))
+	if err := app.Listen(":" + port); err != nil {
+		log.Fatal(err)
+	}
 }
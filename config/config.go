@@ -1,6 +1,7 @@
 package config
 
 import (
+	"NewListingBot/decimal"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	"log"
@@ -11,6 +12,21 @@ type EthereumConfig struct {
 	EthereumOwnerAddress string `envconfig:"ETHEREUM_OWNER_ADDRESS" default:""`
 	EthereumInfuraURL    string `envconfig:"ETHEREUM_INFURA_URL" default:""`
 	EthereumChainID      int    `envconfig:"ETHEREUM_CHAIN_ID" default:"1"`
+
+	// Uniswap V2
+	EthereumRouterAddress string `envconfig:"ETHEREUM_ROUTER_ADDRESS" default:"0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D"`
+	EthereumWETHAddress   string `envconfig:"ETHEREUM_WETH_ADDRESS" default:"0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"`
+
+	// Uniswap V3, the swaps go through V2 unless the protocol is v3
+	EthereumDEXProtocol      string `envconfig:"ETHEREUM_DEX_PROTOCOL" default:"v2"`
+	EthereumV3RouterAddress  string `envconfig:"ETHEREUM_V3_ROUTER_ADDRESS" default:"0xE592427A0AEce92De3Edee1F18E0157C05861564"`
+	EthereumV3FactoryAddress string `envconfig:"ETHEREUM_V3_FACTORY_ADDRESS" default:"0x1F98431c8aD98523631AE4a59f267346ea31F984"`
+	EthereumV3QuoterAddress  string `envconfig:"ETHEREUM_V3_QUOTER_ADDRESS" default:"0x61fFE014bA17989E743c5F6cB21bF9697530B21e"`
+
+	// legacy, fast, aggressive, fixed or percentile, the caps in gwei are the ones of the fixed strategy
+	EthereumGasStrategy   string          `envconfig:"ETHEREUM_GAS_STRATEGY" default:"fast"`
+	EthereumGasFeeCapGwei decimal.Decimal `envconfig:"ETHEREUM_GAS_FEE_CAP_GWEI" default:"0"`
+	EthereumGasTipCapGwei decimal.Decimal `envconfig:"ETHEREUM_GAS_TIP_CAP_GWEI" default:"0"`
 }
 
 type BinanceConfig struct {
@@ -18,6 +34,21 @@ type BinanceConfig struct {
 	BinanceOwnerAddress string `envconfig:"BINANCE_OWNER_ADDRESS" default:""`
 	BinanceInfuraURL    string `envconfig:"BINANCE_INFURA_URL" default:""`
 	BinanceChainID      int    `envconfig:"BINANCE_CHAIN_ID" default:"56"`
+
+	// PancakeSwap V2
+	BinanceRouterAddress string `envconfig:"BINANCE_ROUTER_ADDRESS" default:"0x10ED43C718714eb63d5aA57B78B54704E256024E"`
+	BinanceWETHAddress   string `envconfig:"BINANCE_WETH_ADDRESS" default:"0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c"`
+
+	// PancakeSwap V3, the swaps go through V2 unless the protocol is v3
+	BinanceDEXProtocol      string `envconfig:"BINANCE_DEX_PROTOCOL" default:"v2"`
+	BinanceV3RouterAddress  string `envconfig:"BINANCE_V3_ROUTER_ADDRESS" default:"0x1b81D678ffb9C0263b24A97847620C99d213eB14"`
+	BinanceV3FactoryAddress string `envconfig:"BINANCE_V3_FACTORY_ADDRESS" default:"0x0BFbCF9fa4f9C56B0F40a671Ad40E0805A091865"`
+	BinanceV3QuoterAddress  string `envconfig:"BINANCE_V3_QUOTER_ADDRESS" default:"0xB048Bbc1Ee6b733FFfCFb9e9CeF7375518e25997"`
+
+	// legacy, fast, aggressive, fixed or percentile, the caps in gwei are the ones of the fixed strategy
+	BinanceGasStrategy   string          `envconfig:"BINANCE_GAS_STRATEGY" default:"legacy"`
+	BinanceGasFeeCapGwei decimal.Decimal `envconfig:"BINANCE_GAS_FEE_CAP_GWEI" default:"0"`
+	BinanceGasTipCapGwei decimal.Decimal `envconfig:"BINANCE_GAS_TIP_CAP_GWEI" default:"0"`
 }
 
 type PolygonConfig struct {
@@ -25,6 +56,21 @@ type PolygonConfig struct {
 	PolygonOwnerAddress string `envconfig:"POLYGON_OWNER_ADDRESS" default:""`
 	PolygonInfuraURL    string `envconfig:"POLYGON_INFURA_URL" default:""`
 	PolygonChainID      int    `envconfig:"POLYGON_CHAIN_ID" default:"137"`
+
+	// QuickSwap
+	PolygonRouterAddress string `envconfig:"POLYGON_ROUTER_ADDRESS" default:"0xa5E0829CaCEd8fFDD4De3c43696c57F7D7A678ff"`
+	PolygonWETHAddress   string `envconfig:"POLYGON_WETH_ADDRESS" default:"0x0d500B1d8E8eF31e21C99d1Db9A6444d3ADf1270"`
+
+	// Uniswap V3, the swaps go through V2 unless the protocol is v3
+	PolygonDEXProtocol      string `envconfig:"POLYGON_DEX_PROTOCOL" default:"v2"`
+	PolygonV3RouterAddress  string `envconfig:"POLYGON_V3_ROUTER_ADDRESS" default:"0xE592427A0AEce92De3Edee1F18E0157C05861564"`
+	PolygonV3FactoryAddress string `envconfig:"POLYGON_V3_FACTORY_ADDRESS" default:"0x1F98431c8aD98523631AE4a59f267346ea31F984"`
+	PolygonV3QuoterAddress  string `envconfig:"POLYGON_V3_QUOTER_ADDRESS" default:"0x61fFE014bA17989E743c5F6cB21bF9697530B21e"`
+
+	// legacy, fast, aggressive, fixed or percentile, the caps in gwei are the ones of the fixed strategy
+	PolygonGasStrategy   string          `envconfig:"POLYGON_GAS_STRATEGY" default:"fast"`
+	PolygonGasFeeCapGwei decimal.Decimal `envconfig:"POLYGON_GAS_FEE_CAP_GWEI" default:"0"`
+	PolygonGasTipCapGwei decimal.Decimal `envconfig:"POLYGON_GAS_TIP_CAP_GWEI" default:"0"`
 }
 
 type SEPOLIAConfig struct {
@@ -32,6 +78,21 @@ type SEPOLIAConfig struct {
 	SepoliaOwnerAddress string `envconfig:"SEPOLIA_OWNER_ADDRESS" default:""`
 	SepoliaInfuraURL    string `envconfig:"SEPOLIA_INFURA_URL" default:""`
 	SepoliaChainID      int    `envconfig:"SEPOLIA_CHAIN_ID" default:"11155111"`
+
+	// no router is deployed by default on the testnet
+	SepoliaRouterAddress string `envconfig:"SEPOLIA_ROUTER_ADDRESS" default:""`
+	SepoliaWETHAddress   string `envconfig:"SEPOLIA_WETH_ADDRESS" default:""`
+
+	// v2 or v3, the swaps go through V2 unless the protocol is v3
+	SepoliaDEXProtocol      string `envconfig:"SEPOLIA_DEX_PROTOCOL" default:"v2"`
+	SepoliaV3RouterAddress  string `envconfig:"SEPOLIA_V3_ROUTER_ADDRESS" default:""`
+	SepoliaV3FactoryAddress string `envconfig:"SEPOLIA_V3_FACTORY_ADDRESS" default:""`
+	SepoliaV3QuoterAddress  string `envconfig:"SEPOLIA_V3_QUOTER_ADDRESS" default:""`
+
+	// legacy, fast, aggressive, fixed or percentile, the caps in gwei are the ones of the fixed strategy
+	SepoliaGasStrategy   string          `envconfig:"SEPOLIA_GAS_STRATEGY" default:"fast"`
+	SepoliaGasFeeCapGwei decimal.Decimal `envconfig:"SEPOLIA_GAS_FEE_CAP_GWEI" default:"0"`
+	SepoliaGasTipCapGwei decimal.Decimal `envconfig:"SEPOLIA_GAS_TIP_CAP_GWEI" default:"0"`
 }
 
 type MEXCConfig struct {
@@ -39,6 +100,13 @@ type MEXCConfig struct {
 	MEXCExchangeAPISecret string `envconfig:"MEXC_EXCHANGE_API_SECRET" default:""`
 	MEXCExchangeInfoURL   string `envconfig:"MEXC_EXCHANGE_INFO_URL" default:"https://api.mexc.com/api/v3/ticker/24hr"`
 	MEXCOrderURL          string `envconfig:"MEXC_ORDER_URL" default:"https://api.mexc.com/api/v3/order"`
+	MEXCBaseURL           string `envconfig:"MEXC_BASE_URL" default:"https://api.mexc.com"`
+
+	MEXCClockSyncIntervalSeconds int `envconfig:"MEXC_CLOCK_SYNC_INTERVAL_SECONDS" default:"30"`
+	MEXCClockSyncSamples         int `envconfig:"MEXC_CLOCK_SYNC_SAMPLES" default:"5"`
+	MEXCSymbolRulesTTLSeconds    int `envconfig:"MEXC_SYMBOL_RULES_TTL_SECONDS" default:"600"`
+
+	MEXCWebSocketURL string `envconfig:"MEXC_WEBSOCKET_URL" default:"wss://wbs.mexc.com/ws"`
 }
 type PostgresConfig struct {
 	PostgresUser         string `envconfig:"POSTGRES_USER" default:"postgres"`
@@ -59,6 +127,80 @@ type NewListingConfig struct {
 	NewListingSKHeader string `envconfig:"NEW_LISTING_SK_HEADER" default:""`
 }
 
+type ListingWatcherConfig struct {
+	ListingWatcherEnabled         bool `envconfig:"LISTING_WATCHER_ENABLED" default:"false"`
+	ListingWatcherIntervalSeconds int  `envconfig:"LISTING_WATCHER_INTERVAL_SECONDS" default:"60"`
+
+	// rules of the orders created for the detected listings, no order is created without a budget and a max price.
+	// The max price is a percentage over the first trade price of the symbol.
+	ListingAutoOrderQuoteAssets     []string        `envconfig:"LISTING_AUTO_ORDER_QUOTE_ASSETS" default:"USDT"`
+	ListingAutoOrderMaxBudget       decimal.Decimal `envconfig:"LISTING_AUTO_ORDER_MAX_BUDGET" default:"0"`
+	ListingAutoOrderMaxPricePercent float64         `envconfig:"LISTING_AUTO_ORDER_MAX_PRICE_PERCENT" default:"20"`
+	ListingAutoOrderBlacklist       []string        `envconfig:"LISTING_AUTO_ORDER_BLACKLIST" default:""`
+}
+
+type AnnouncementConfig struct {
+	AnnouncementsEnabled         bool `envconfig:"ANNOUNCEMENTS_ENABLED" default:"false"`
+	AnnouncementsIntervalSeconds int  `envconfig:"ANNOUNCEMENTS_INTERVAL_SECONDS" default:"120"`
+
+	// RSS or Atom feeds and json feeds, urls or paths of recorded feeds
+	AnnouncementFeeds     []string `envconfig:"ANNOUNCEMENT_FEEDS" default:""`
+	AnnouncementJSONFeeds []string `envconfig:"ANNOUNCEMENT_JSON_FEEDS" default:""`
+
+	AnnouncementQuoteAssets []string        `envconfig:"ANNOUNCEMENT_QUOTE_ASSETS" default:"USDT"`
+	AnnouncementDraftBudget decimal.Decimal `envconfig:"ANNOUNCEMENT_DRAFT_BUDGET" default:"0"`
+	AnnouncementVenue       string          `envconfig:"ANNOUNCEMENT_VENUE" default:"mexc"`
+}
+
+type PositionMonitorConfig struct {
+	PositionMonitorWorkers           int `envconfig:"POSITION_MONITOR_WORKERS" default:"4"`
+	PositionMonitorIntervalMs        int `envconfig:"POSITION_MONITOR_INTERVAL_MS" default:"5000"`
+	PositionMonitorRequestsPerSecond int `envconfig:"POSITION_MONITOR_REQUESTS_PER_SECOND" default:"10"`
+}
+
+type DEXConfig struct {
+	// the min out of a swap is the quoted amount less the slippage tolerance
+	DEXSlippagePercent float64 `envconfig:"DEX_SLIPPAGE_PERCENT" default:"1"`
+	DEXDeadlineSeconds int     `envconfig:"DEX_DEADLINE_SECONDS" default:"120"`
+
+	// V3 pool fees looked up by the fee tier discovery, in hundredths of a basis point
+	DEXV3FeeTiers []int `envconfig:"DEX_V3_FEE_TIERS" default:"100,500,2500,3000,10000"`
+}
+
+type GasConfig struct {
+	// the gas limit is the estimate times the multiplier, the fallback is used when the estimate fails
+	GasLimitMultiplier float64 `envconfig:"GAS_LIMIT_MULTIPLIER" default:"1.2"`
+	GasLimitFallback   uint64  `envconfig:"GAS_LIMIT_FALLBACK" default:"300000"`
+
+	GasAggressiveTipMultiplier float64 `envconfig:"GAS_AGGRESSIVE_TIP_MULTIPLIER" default:"2"`
+	GasPercentile              float64 `envconfig:"GAS_PERCENTILE" default:"60"`
+	GasPercentileBlocks        int     `envconfig:"GAS_PERCENTILE_BLOCKS" default:"10"`
+
+	// fees of a replacement over the ones of the stuck transaction, the nodes want at least 10
+	GasReplacementBumpPercent float64 `envconfig:"GAS_REPLACEMENT_BUMP_PERCENT" default:"12.5"`
+}
+
+type TransactionTrackerConfig struct {
+	TransactionTrackerIntervalSeconds int `envconfig:"TRANSACTION_TRACKER_INTERVAL_SECONDS" default:"5"`
+
+	// a transaction pending for longer than the timeout is sped up, cancelled or left alone (speed_up, cancel or none)
+	TransactionTrackerTimeoutSeconds  int    `envconfig:"TRANSACTION_TRACKER_TIMEOUT_SECONDS" default:"180"`
+	TransactionTrackerTimeoutAction   string `envconfig:"TRANSACTION_TRACKER_TIMEOUT_ACTION" default:"speed_up"`
+	TransactionTrackerMaxReplacements int    `envconfig:"TRANSACTION_TRACKER_MAX_REPLACEMENTS" default:"3"`
+}
+
+type PaperConfig struct {
+	// new orders are paper orders unless they say otherwise
+	PaperTrading         bool    `envconfig:"PAPER_TRADING" default:"false"`
+	PaperSlippagePercent float64 `envconfig:"PAPER_SLIPPAGE_PERCENT" default:"0.1"`
+	PaperFeePercent      float64 `envconfig:"PAPER_FEE_PERCENT" default:"0.1"`
+	PaperLatencyMs       int     `envconfig:"PAPER_LATENCY_MS" default:"100"`
+
+	// csv of time,symbol,price[,bid,ask] replayed instead of the live prices
+	PaperPricesFile string   `envconfig:"PAPER_PRICES_FILE" default:""`
+	PaperBalances   []string `envconfig:"PAPER_BALANCES" default:"USDT:10000"`
+}
+
 type Config struct {
 	EthereumConfig
 	BinanceConfig
@@ -68,6 +210,13 @@ type Config struct {
 	PostgresConfig
 	SentryConfig
 	NewListingConfig
+	ListingWatcherConfig
+	AnnouncementConfig
+	PositionMonitorConfig
+	PaperConfig
+	DEXConfig
+	GasConfig
+	TransactionTrackerConfig
 }
 
 func Load() (Config, error) {
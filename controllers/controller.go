@@ -8,7 +8,10 @@ import (
 	"NewListingBot/models"
 	"NewListingBot/serializers"
 	"context"
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"time"
 )
@@ -31,8 +34,17 @@ func OrderListController(c *fiber.Ctx) error {
 	db := database.DBConnection()
 	defer database.CloseDB()
 
-	err := db.WithContext(ctx).Model(&models.Order{}).
-		Order(clause.OrderByColumn{Column: clause.Column{Name: "timestamp"}, Desc: true}).Find(&orders).Error
+	query := db.WithContext(ctx).Model(&models.Order{})
+	// ?status=draft lists the orders proposed from the announcements
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	// ?paper=true lists the simulated orders only, ?paper=false the real ones
+	if paper := c.Query("paper"); paper != "" {
+		query = query.Where("paper = ?", c.QueryBool("paper"))
+	}
+
+	err := query.Order(clause.OrderByColumn{Column: clause.Column{Name: "timestamp"}, Desc: true}).Find(&orders).Error
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString("Error fetching orders")
 	}
@@ -62,45 +74,168 @@ func OrderCreateController(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(Response{Errors: vErr, Success: false, Detail: vErr})
 	}
 
-	scheduleTime := requestBody.ScheduleTime
-	scheduleSellTime := scheduleTime.Add(time.Minute * 1) // add 15 minutes for ScheduleSellTime
+	// a limit buy is priced at the max price so it needs one
+	if requestBody.BuyOrderType != nil && *requestBody.BuyOrderType != "MARKET" &&
+		requestBody.MaxPrice == nil && requestBody.MaxPricePercent == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Message: "max_price or max_price_percent is required for a non market buy", Success: false})
+	}
 
 	order = models.Order{
-		Symbol:           requestBody.Symbol,
-		ScheduleTime:     scheduleTime,
-		ScheduleSellTime: &scheduleSellTime, // start the sell
-		Price:            requestBody.Price,
+		Symbol:          requestBody.Symbol,
+		ScheduleTime:    requestBody.ScheduleTime,
+		Price:           requestBody.Price,
+		Venue:           requestBody.Venue,
+		BurstPlan:       requestBody.BurstPlan,
+		MissedPolicy:    requestBody.MissedPolicy,
+		BuyOrderType:    requestBody.BuyOrderType,
+		SellOrderType:   requestBody.SellOrderType,
+		MaxPrice:        requestBody.MaxPrice,
+		MaxPricePercent: requestBody.MaxPricePercent,
+		ExitPlan:        requestBody.ExitPlan,
+		Paper:           requestBody.Paper,
 	}
 
-	err := db.WithContext(ctx).Model(&models.Order{}).Create(&order).Error
+	err := models.CreateOrder(ctx, db, &order)
 	if err != nil {
 		return c.Status(400).JSON(Response{Errors: err.Error(), Success: false, Detail: err.Error()})
 	}
 
-	// make the schedule for all buy operations
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*5))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*5))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*5))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*4))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*4))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*4))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*4))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*3))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*3))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*3))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*2))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*2))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*2))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*1))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*1))
-	order.ScheduleBuyScheduler(ctx, db, order.ID, order.ScheduleTime.Add(-time.Second*1))
-
-	// make the schedule for all sell operations
-	order.ScheduleSellScheduler(ctx, db)
+	return c.Status(200).JSON(order)
+}
+
+func OrderApproveController(c *fiber.Ctx) error {
+	var requestBody serializers.OrderApproveRequestSerializer
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Message: "Invalid order id", Success: false, Detail: err.Error()})
+	}
+
+	// the body is optional, an empty one approves the draft as proposed
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&requestBody); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(Response{Message: "Invalid request body ", Success: false, Detail: err.Error()})
+		}
+	}
+
+	vErr := adapters.NewValidate().ValidateData(&requestBody)
+	if vErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Errors: vErr, Success: false, Detail: vErr})
+	}
+
+	// Open the database connection
+	db := database.DBConnection()
+	defer database.CloseDB()
+
+	order, err := models.ApproveDraftOrder(ctx, db, orderID, models.DraftApproval{
+		ScheduleTime:    requestBody.ScheduleTime,
+		Price:           requestBody.Price,
+		MaxPrice:        requestBody.MaxPrice,
+		MaxPricePercent: requestBody.MaxPricePercent,
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(Response{Message: "Order not found", Success: false})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Message: err.Error(), Success: false, Detail: err.Error()})
+	}
+
+	return c.Status(200).JSON(order)
+}
+
+func OrderRejectController(c *fiber.Ctx) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Message: "Invalid order id", Success: false, Detail: err.Error()})
+	}
+
+	// Open the database connection
+	db := database.DBConnection()
+	defer database.CloseDB()
+
+	order, err := models.RejectDraftOrder(ctx, db, orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(Response{Message: "Order not found", Success: false})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Message: err.Error(), Success: false, Detail: err.Error()})
+	}
+
+	return c.Status(200).JSON(order)
+}
+
+func OrderCancelController(c *fiber.Ctx) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Message: "Invalid order id", Success: false, Detail: err.Error()})
+	}
+
+	// Open the database connection
+	db := database.DBConnection()
+	defer database.CloseDB()
+
+	order, err := models.CancelOrder(ctx, db, orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(Response{Message: "Order not found", Success: false})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Message: err.Error(), Success: false, Detail: err.Error()})
+	}
 
 	return c.Status(200).JSON(order)
 }
 
+func OrderEventsController(c *fiber.Ctx) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Message: "Invalid order id", Success: false, Detail: err.Error()})
+	}
+
+	// Open the database connection
+	db := database.DBConnection()
+	defer database.CloseDB()
+
+	events, err := models.GetOrderEvents(ctx, db, orderID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Error fetching order events")
+	}
+
+	return c.Status(200).JSON(events)
+}
+
+func OrderTransactionsController(c *fiber.Ctx) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	orderID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(Response{Message: "Invalid order id", Success: false, Detail: err.Error()})
+	}
+
+	// Open the database connection
+	db := database.DBConnection()
+	defer database.CloseDB()
+
+	transactions, err := models.GetOrderTransactions(ctx, db, orderID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Error fetching order transactions")
+	}
+
+	return c.Status(200).JSON(transactions)
+}
+
 func GetMarketDataController(c *fiber.Ctx) error {
 
 	cfg, err := config.Load()
@@ -127,3 +262,29 @@ func GetMarketDataController(c *fiber.Ctx) error {
 
 	return c.Status(200).JSON(marketData)
 }
+
+func PnLController(c *fiber.Ctx) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	// Open the database connection
+	db := database.DBConnection()
+	defer database.CloseDB()
+
+	// the paper orders are summed apart so they never mix with the real results
+	summary, err := models.GetPnLSummary(ctx, db, c.QueryBool("paper"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("Error computing pnl")
+	}
+
+	return c.Status(200).JSON(summary)
+}
+
+func ClockController(c *fiber.Ctx) error {
+	clock := exchange.MEXCClock()
+	if clock == nil {
+		return c.Status(503).JSON(Response{Message: "exchange clock is not running", Success: false})
+	}
+
+	return c.Status(200).JSON(clock.Stats())
+}
@@ -0,0 +1,313 @@
+package decimal
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimals kept, enough for the low priced tokens and for wei amounts
+const Scale = 18
+
+var (
+	scaleFactor = new(big.Int).Exp(big.NewInt(10), big.NewInt(Scale), nil)
+	ten         = big.NewInt(10)
+)
+
+// Decimal is a fixed point number with Scale decimals, the zero value is 0.
+// Operations truncate toward zero past the Scale decimals.
+type Decimal struct {
+	value *big.Int // the number times 10^Scale
+}
+
+var Zero = Decimal{}
+
+func (d Decimal) scaled() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+	return d.value
+}
+
+// New returns the integer as a decimal
+func New(value int64) Decimal {
+	return Decimal{value: new(big.Int).Mul(big.NewInt(value), scaleFactor)}
+}
+
+// NewFromBigInt returns value * 10^-exp, like a token amount and its decimals
+func NewFromBigInt(value *big.Int, exp int) Decimal {
+	if exp <= Scale {
+		multiplier := new(big.Int).Exp(ten, big.NewInt(int64(Scale-exp)), nil)
+		return Decimal{value: new(big.Int).Mul(value, multiplier)}
+	}
+
+	divisor := new(big.Int).Exp(ten, big.NewInt(int64(exp-Scale)), nil)
+	return Decimal{value: new(big.Int).Quo(value, divisor)}
+}
+
+// NewFromString parses a plain decimal like "-12.000034", the decimals past Scale are dropped
+func NewFromString(value string) (Decimal, error) {
+	text := strings.TrimSpace(value)
+	if text == "" {
+		return Zero, fmt.Errorf("invalid decimal %q", value)
+	}
+
+	negative := false
+	switch text[0] {
+	case '-':
+		negative = true
+		text = text[1:]
+	case '+':
+		text = text[1:]
+	}
+
+	// the exchanges send some values like 1.5E-7
+	if strings.ContainsAny(text, "eE") {
+		parsed, ok := new(big.Float).SetPrec(256).SetString(text)
+		if !ok {
+			return Zero, fmt.Errorf("invalid decimal %q", value)
+		}
+		scaled, _ := parsed.Mul(parsed, new(big.Float).SetInt(scaleFactor)).Int(nil)
+		if negative {
+			scaled.Neg(scaled)
+		}
+		return Decimal{value: scaled}, nil
+	}
+
+	integer, fraction, _ := strings.Cut(text, ".")
+	if integer == "" && fraction == "" {
+		return Zero, fmt.Errorf("invalid decimal %q", value)
+	}
+	if len(fraction) > Scale {
+		fraction = fraction[:Scale]
+	}
+	fraction += strings.Repeat("0", Scale-len(fraction))
+
+	digits := strings.TrimLeft(integer+fraction, "0")
+	if digits == "" {
+		return Zero, nil
+	}
+
+	scaled, ok := new(big.Int).SetString(digits, 10)
+	if !ok || strings.ContainsAny(digits, "+-") {
+		return Zero, fmt.Errorf("invalid decimal %q", value)
+	}
+	if negative {
+		scaled.Neg(scaled)
+	}
+
+	return Decimal{value: scaled}, nil
+}
+
+// RequireFromString is NewFromString for constants, it panics on an invalid value
+func RequireFromString(value string) Decimal {
+	d, err := NewFromString(value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// NewFromFloat converts through the shortest representation of the float, so 0.1 is 0.1
+func NewFromFloat(value float64) Decimal {
+	d, err := NewFromString(strconv.FormatFloat(value, 'g', -1, 64))
+	if err != nil {
+		return Zero
+	}
+	return d
+}
+
+func (d Decimal) Add(other Decimal) Decimal {
+	return Decimal{value: new(big.Int).Add(d.scaled(), other.scaled())}
+}
+
+func (d Decimal) Sub(other Decimal) Decimal {
+	return Decimal{value: new(big.Int).Sub(d.scaled(), other.scaled())}
+}
+
+func (d Decimal) Mul(other Decimal) Decimal {
+	product := new(big.Int).Mul(d.scaled(), other.scaled())
+	return Decimal{value: product.Quo(product, scaleFactor)}
+}
+
+// Div divides by other, it panics on a zero divisor like big.Int does
+func (d Decimal) Div(other Decimal) Decimal {
+	if other.IsZero() {
+		panic("decimal: division by zero")
+	}
+
+	dividend := new(big.Int).Mul(d.scaled(), scaleFactor)
+	return Decimal{value: dividend.Quo(dividend, other.scaled())}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{value: new(big.Int).Neg(d.scaled())}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{value: new(big.Int).Abs(d.scaled())}
+}
+
+// Cmp returns -1, 0 or 1 when d is lower, equal or greater than other
+func (d Decimal) Cmp(other Decimal) int {
+	return d.scaled().Cmp(other.scaled())
+}
+
+func (d Decimal) Sign() int {
+	return d.scaled().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+func (d Decimal) LessThan(other Decimal) bool {
+	return d.Cmp(other) < 0
+}
+
+func (d Decimal) GreaterThan(other Decimal) bool {
+	return d.Cmp(other) > 0
+}
+
+func Min(a Decimal, b Decimal) Decimal {
+	if a.LessThan(b) {
+		return a
+	}
+	return b
+}
+
+func Max(a Decimal, b Decimal) Decimal {
+	if a.GreaterThan(b) {
+		return a
+	}
+	return b
+}
+
+// Truncate drops the decimals past places
+func (d Decimal) Truncate(places int) Decimal {
+	if places >= Scale {
+		return d
+	}
+
+	unit := new(big.Int).Exp(ten, big.NewInt(int64(Scale-places)), nil)
+	truncated := new(big.Int).Quo(d.scaled(), unit)
+	return Decimal{value: truncated.Mul(truncated, unit)}
+}
+
+// FloorTo rounds d down to a multiple of step, a zero step leaves d as it is
+func (d Decimal) FloorTo(step Decimal) Decimal {
+	if step.Sign() <= 0 {
+		return d
+	}
+
+	steps := new(big.Int).Div(d.scaled(), step.scaled())
+	return Decimal{value: steps.Mul(steps, step.scaled())}
+}
+
+// BigInt returns d * 10^exp truncated, like an amount in the smallest unit of a token
+func (d Decimal) BigInt(exp int) *big.Int {
+	if exp >= Scale {
+		multiplier := new(big.Int).Exp(ten, big.NewInt(int64(exp-Scale)), nil)
+		return new(big.Int).Mul(d.scaled(), multiplier)
+	}
+
+	divisor := new(big.Int).Exp(ten, big.NewInt(int64(Scale-exp)), nil)
+	return new(big.Int).Quo(d.scaled(), divisor)
+}
+
+// Float64 is for the ratios and the logs, never for amounts sent anywhere
+func (d Decimal) Float64() float64 {
+	value, _ := strconv.ParseFloat(d.String(), 64)
+	return value
+}
+
+// String formats d without exponent nor trailing zeros, the way the exchanges expect it
+func (d Decimal) String() string {
+	value := d.scaled()
+	digits := new(big.Int).Abs(value).String()
+
+	if len(digits) <= Scale {
+		digits = strings.Repeat("0", Scale-len(digits)+1) + digits
+	}
+
+	integer := digits[:len(digits)-Scale]
+	fraction := strings.TrimRight(digits[len(digits)-Scale:], "0")
+
+	text := integer
+	if fraction != "" {
+		text += "." + fraction
+	}
+	if value.Sign() < 0 {
+		text = "-" + text
+	}
+
+	return text
+}
+
+// MarshalJSON writes a json number with every decimal
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON reads a json number or a string holding one, like MEXC sends
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+
+	text = strings.Trim(text, `"`)
+	if text == "" {
+		*d = Zero
+		return nil
+	}
+
+	parsed, err := NewFromString(text)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Decode reads the decimal from the environment with envconfig
+func (d *Decimal) Decode(value string) error {
+	return d.UnmarshalJSON([]byte(value))
+}
+
+// Scan reads the decimal from the database, stored as text or as a number
+func (d *Decimal) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = Zero
+		return nil
+	case string:
+		return d.UnmarshalJSON([]byte(v))
+	case []byte:
+		return d.UnmarshalJSON(v)
+	case float64:
+		*d = NewFromFloat(v)
+		return nil
+	case int64:
+		*d = New(v)
+		return nil
+	}
+
+	return fmt.Errorf("cannot scan %T into a decimal", value)
+}
+
+// Value stores the decimal as text so no precision is lost
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// GormDataType makes gorm create text columns for the decimals
+func (Decimal) GormDataType() string {
+	return "string"
+}
@@ -0,0 +1,229 @@
+package decimal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewFromString(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{value: "12.000034", want: "12.000034"},
+		{value: "-12.000034", want: "-12.000034"},
+		{value: "+3", want: "3"},
+		{value: "0012.50", want: "12.5"},
+		{value: ".5", want: "0.5"},
+		{value: "5.", want: "5"},
+		{value: " 7 ", want: "7"},
+		{value: "-0", want: "0"},
+		{value: "1.5E-7", want: "0.00000015"},
+		{value: "-2e3", want: "-2000"},
+		// the decimals past Scale are dropped
+		{value: "0.1234567890123456789", want: "0.123456789012345678"},
+		{value: "", err: true},
+		{value: "abc", err: true},
+		{value: "1.2.3", err: true},
+		{value: "--1", err: true},
+		{value: "1-2", err: true},
+		{value: ".", err: true},
+		{value: "1e", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := NewFromString(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("NewFromString(%q) = %v, want an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewFromString(%q) failed: %v", test.value, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("NewFromString(%q) = %v, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		value Decimal
+		want  string
+	}{
+		{value: Zero, want: "0"},
+		{value: New(1000), want: "1000"},
+		{value: New(-5), want: "-5"},
+		{value: RequireFromString("-0.5"), want: "-0.5"},
+		{value: RequireFromString("0.000000000000000001"), want: "0.000000000000000001"},
+		{value: RequireFromString("123456789.10"), want: "123456789.1"},
+		{value: NewFromFloat(0.1), want: "0.1"},
+	}
+
+	for _, test := range tests {
+		if got := test.value.String(); got != test.want {
+			t.Errorf("String() = %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestMulDiv(t *testing.T) {
+	tests := []struct {
+		a, b string
+		mul  string
+		div  string
+	}{
+		{a: "0.1", b: "0.1", mul: "0.01", div: "1"},
+		{a: "1", b: "3", mul: "3", div: "0.333333333333333333"},
+		{a: "2", b: "3", mul: "6", div: "0.666666666666666666"},
+		{a: "-1", b: "3", mul: "-3", div: "-0.333333333333333333"},
+		// the products past Scale are truncated toward zero
+		{a: "0.000000000000000001", b: "0.5", mul: "0", div: "0.000000000000000002"},
+		{a: "-0.000000000000000001", b: "0.5", mul: "0", div: "-0.000000000000000002"},
+		{a: "25", b: "0.0004", mul: "0.01", div: "62500"},
+	}
+
+	for _, test := range tests {
+		a, b := RequireFromString(test.a), RequireFromString(test.b)
+		if got := a.Mul(b).String(); got != test.mul {
+			t.Errorf("%s * %s = %s, want %s", test.a, test.b, got, test.mul)
+		}
+		if got := a.Div(b).String(); got != test.div {
+			t.Errorf("%s / %s = %s, want %s", test.a, test.b, got, test.div)
+		}
+	}
+}
+
+func TestDivByZeroPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("dividing by zero did not panic")
+		}
+	}()
+
+	New(1).Div(Zero)
+}
+
+func TestFloorToAndTruncate(t *testing.T) {
+	tests := []struct {
+		value  string
+		step   string
+		floor  string
+		places int
+		trunc  string
+	}{
+		{value: "12.3456", step: "0.01", floor: "12.34", places: 2, trunc: "12.34"},
+		{value: "12.3456", step: "0.05", floor: "12.3", places: 0, trunc: "12"},
+		{value: "12.3456", step: "5", floor: "10", places: 3, trunc: "12.345"},
+		{value: "12.3456", step: "0", floor: "12.3456", places: 18, trunc: "12.3456"},
+		// flooring goes down, truncating goes toward zero
+		{value: "-1.25", step: "0.1", floor: "-1.3", places: 1, trunc: "-1.2"},
+		{value: "0.0009", step: "0.001", floor: "0", places: 3, trunc: "0"},
+	}
+
+	for _, test := range tests {
+		value := RequireFromString(test.value)
+		if got := value.FloorTo(RequireFromString(test.step)).String(); got != test.floor {
+			t.Errorf("%s floored to %s = %s, want %s", test.value, test.step, got, test.floor)
+		}
+		if got := value.Truncate(test.places).String(); got != test.trunc {
+			t.Errorf("%s truncated to %d places = %s, want %s", test.value, test.places, got, test.trunc)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Price Decimal `json:"price"`
+	}{Price: RequireFromString("-12.50")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"price":-12.5}` {
+		t.Errorf("marshalled %s, want a json number", data)
+	}
+
+	tests := []struct {
+		data string
+		want string
+		err  bool
+	}{
+		{data: `0.1`, want: "0.1"},
+		{data: `"0.1"`, want: "0.1"},
+		{data: `"1.5E-7"`, want: "0.00000015"},
+		{data: `""`, want: "0"},
+		{data: `null`, want: "3"},
+		{data: `"abc"`, err: true},
+	}
+
+	for _, test := range tests {
+		// null leaves the value as it was
+		value := New(3)
+		err := json.Unmarshal([]byte(test.data), &value)
+		if test.err {
+			if err == nil {
+				t.Errorf("unmarshalling %s gave %v, want an error", test.data, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unmarshalling %s failed: %v", test.data, err)
+			continue
+		}
+		if value.String() != test.want {
+			t.Errorf("unmarshalled %s into %v, want %s", test.data, value, test.want)
+		}
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	for _, text := range []string{"0", "-0.000000000000000001", "123456789.987654321", "1000"} {
+		stored, err := RequireFromString(text).Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var scanned Decimal
+		if err := scanned.Scan(stored); err != nil {
+			t.Fatal(err)
+		}
+		if scanned.String() != text {
+			t.Errorf("%s came back as %v", text, scanned)
+		}
+	}
+
+	tests := []struct {
+		value interface{}
+		want  string
+		err   bool
+	}{
+		{value: nil, want: "0"},
+		{value: []byte("1.25"), want: "1.25"},
+		{value: 0.1, want: "0.1"},
+		{value: int64(-7), want: "-7"},
+		{value: true, err: true},
+		{value: "x", err: true},
+	}
+
+	for _, test := range tests {
+		var scanned Decimal
+		err := scanned.Scan(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("scanning %v gave %v, want an error", test.value, scanned)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("scanning %v failed: %v", test.value, err)
+			continue
+		}
+		if scanned.String() != test.want {
+			t.Errorf("scanned %v into %v, want %s", test.value, scanned, test.want)
+		}
+	}
+}
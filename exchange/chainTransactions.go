@@ -0,0 +1,106 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"sync"
+)
+
+// states of a broadcast transaction as seen by the node
+const (
+	TransactionPending  = "pending"
+	TransactionMined    = "mined"
+	TransactionReverted = "reverted"
+	TransactionDropped  = "dropped"
+	TransactionReplaced = "replaced"
+)
+
+// TransactionState is where a transaction stands, the gas is only known once it is mined
+type TransactionState struct {
+	Status            string
+	BlockNumber       uint64
+	GasUsed           uint64
+	EffectiveGasPrice string
+}
+
+// TransactionState looks the transaction up on the node. A transaction the node does not know anymore
+// was replaced when its nonce is used, by one of our replacements or by another wallet of the key, and dropped otherwise.
+func (e *EthereumCompatible) TransactionState(ctx context.Context, txHash string, from string, nonce uint64) (TransactionState, error) {
+	client, err := e.chainClient()
+	if err != nil {
+		return TransactionState{}, err
+	}
+
+	hash := common.HexToHash(txHash)
+
+	receipt, err := client.TransactionReceipt(ctx, hash)
+	if err == nil {
+		state := TransactionState{
+			Status:      TransactionMined,
+			BlockNumber: receipt.BlockNumber.Uint64(),
+			GasUsed:     receipt.GasUsed,
+		}
+		if receipt.EffectiveGasPrice != nil {
+			state.EffectiveGasPrice = receipt.EffectiveGasPrice.String()
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			state.Status = TransactionReverted
+		}
+		return state, nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return TransactionState{}, fmt.Errorf("reading receipt failed: %v", err)
+	}
+
+	_, _, err = client.TransactionByHash(ctx, hash)
+	if err == nil {
+		// known but not mined yet
+		return TransactionState{Status: TransactionPending}, nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return TransactionState{}, fmt.Errorf("reading transaction failed: %v", err)
+	}
+
+	minedNonce, err := client.NonceAt(ctx, common.HexToAddress(from), nil)
+	if err != nil {
+		return TransactionState{}, fmt.Errorf("reading nonce failed: %v", err)
+	}
+	if minedNonce > nonce {
+		return TransactionState{Status: TransactionReplaced}, nil
+	}
+	return TransactionState{Status: TransactionDropped}, nil
+}
+
+var (
+	chainsMu sync.Mutex
+	chains   = map[int]*EthereumCompatible{}
+)
+
+// EthereumCompatibleForChain returns the configured chain of the ID, shared by everyone following its transactions
+func EthereumCompatibleForChain(chainID int) (*EthereumCompatible, error) {
+	chainsMu.Lock()
+	defer chainsMu.Unlock()
+
+	if chain, ok := chains[chainID]; ok {
+		return chain, nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chain := range []*EthereumCompatible{NewEthereumExchange(cfg), NewBinanceExchange(cfg), NewPolygonExchange(cfg), NewSepoliaExchange(cfg)} {
+		if chain.ChainID == chainID {
+			chains[chainID] = chain
+			return chain, nil
+		}
+	}
+
+	return nil, fmt.Errorf("chain %d is not configured", chainID)
+}
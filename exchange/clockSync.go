@@ -0,0 +1,189 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/logger"
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// ClockStats is the last estimate of the exchange clock compared to the local one
+type ClockStats struct {
+	Synced   bool       `json:"synced"`
+	OffsetMs float64    `json:"offset_ms"` // exchange time minus local time
+	RTTMs    float64    `json:"rtt_ms"`
+	Samples  int        `json:"samples"` // samples answered by the exchange on the last sync
+	LastSync *time.Time `json:"last_sync"`
+}
+
+// ClockSync periodically samples the exchange server time and estimates the offset and the round trip
+// so requests can be signed with the exchange time without an extra request on the hot path.
+type ClockSync struct {
+	timeURL  string
+	interval time.Duration
+	samples  int
+
+	// onChange is told how much the offset moved on every sync
+	onChange func(change time.Duration)
+
+	mu       sync.RWMutex
+	synced   bool
+	offset   time.Duration
+	rtt      time.Duration
+	answered int
+	lastSync time.Time
+}
+
+// defaultClockSyncInterval is used when the configured interval is not positive
+const defaultClockSyncInterval = 30 * time.Second
+
+var mexcClock *ClockSync
+
+func NewClockSync(timeURL string, interval time.Duration, samples int) *ClockSync {
+	if samples < 1 {
+		samples = 1
+	}
+	if interval <= 0 {
+		interval = defaultClockSyncInterval
+	}
+	return &ClockSync{
+		timeURL:  timeURL,
+		interval: interval,
+		samples:  samples,
+	}
+}
+
+// StartMEXCClock syncs the MEXC clock once before returning, so what is armed next starts from the exchange time,
+// and keeps it synced in the background. onChange is told how much the offset moved on every sync.
+func StartMEXCClock(ctx context.Context, cfg config.Config, onChange func(change time.Duration)) *ClockSync {
+	mexcClock = NewClockSync(
+		cfg.MEXCBaseURL+"/api/v3/time",
+		time.Duration(cfg.MEXCClockSyncIntervalSeconds)*time.Second,
+		cfg.MEXCClockSyncSamples,
+	)
+	mexcClock.onChange = onChange
+
+	if err := mexcClock.Sync(); err != nil {
+		logger.Error(ctx, "error syncing exchange clock", zap.Error(err))
+	}
+	go mexcClock.keepSynced(ctx)
+
+	return mexcClock
+}
+
+// MEXCClock returns the running MEXC clock, nil when it was not started
+func MEXCClock() *ClockSync {
+	return mexcClock
+}
+
+// Start syncs right away and then on every interval until the context is done
+func (c *ClockSync) Start(ctx context.Context) {
+	if err := c.Sync(); err != nil {
+		logger.Error(ctx, "error syncing exchange clock", zap.Error(err))
+	}
+	c.keepSynced(ctx)
+}
+
+// keepSynced syncs on every interval until the context is done
+func (c *ClockSync) keepSynced(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := c.Sync(); err != nil {
+			logger.Error(ctx, "error syncing exchange clock", zap.Error(err))
+		}
+	}
+}
+
+// Sync takes the samples and keeps the one with the lowest round trip, it is the least skewed by the network
+func (c *ClockSync) Sync() error {
+	var bestOffset, bestRTT time.Duration
+	var lastErr error
+	found := false
+	answered := 0
+
+	for i := 0; i < c.samples; i++ {
+		sent := time.Now()
+		serverTime, err := fetchServerTime(c.timeURL)
+		received := time.Now()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		answered++
+		rtt := received.Sub(sent)
+		// the server stamped the response about half way through the round trip
+		offset := time.UnixMilli(serverTime).Sub(sent.Add(rtt / 2))
+
+		if !found || rtt < bestRTT {
+			bestOffset, bestRTT, found = offset, rtt, true
+		}
+	}
+
+	if !found {
+		return lastErr
+	}
+
+	c.mu.Lock()
+	change := bestOffset - c.offset
+	c.synced = true
+	c.offset = bestOffset
+	c.rtt = bestRTT
+	c.answered = answered
+	c.lastSync = time.Now()
+	c.mu.Unlock()
+
+	if c.onChange != nil {
+		c.onChange(change)
+	}
+
+	return nil
+}
+
+// Now returns the current exchange time
+func (c *ClockSync) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return time.Now().Add(c.offset)
+}
+
+// Timestamp returns the current exchange time in milliseconds as used to sign requests
+func (c *ClockSync) Timestamp() int64 {
+	return c.Now().UnixMilli()
+}
+
+func (c *ClockSync) Synced() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.synced
+}
+
+func (c *ClockSync) Stats() ClockStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats := ClockStats{
+		Synced:   c.synced,
+		OffsetMs: float64(c.offset) / float64(time.Millisecond),
+		RTTMs:    float64(c.rtt) / float64(time.Millisecond),
+		Samples:  c.answered,
+	}
+	if c.synced {
+		lastSync := c.lastSync
+		stats.LastSync = &lastSync
+	}
+
+	return stats
+}
@@ -0,0 +1,69 @@
+package exchange
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClockSyncCountsTheAnsweredSamples(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every other sample fails
+		if atomic.AddInt32(&requests, 1)%2 == 0 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().Add(time.Second).UnixMilli())
+	}))
+	defer server.Close()
+
+	clock := NewClockSync(server.URL, 0, 4)
+	if clock.interval <= 0 {
+		t.Errorf("interval = %v, want a default", clock.interval)
+	}
+
+	if err := clock.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := clock.Stats()
+	if !stats.Synced || stats.Samples != 2 {
+		t.Errorf("stats = %+v, want synced on 2 samples", stats)
+	}
+	if stats.OffsetMs < 500 || stats.OffsetMs > 1500 {
+		t.Errorf("offset = %vms, want about a second", stats.OffsetMs)
+	}
+}
+
+func TestClockSyncKeepsTheOffsetOnErrorAnswers(t *testing.T) {
+	var limited int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&limited) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"code":429}`)
+			return
+		}
+		fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().Add(time.Second).UnixMilli())
+	}))
+	defer server.Close()
+
+	clock := NewClockSync(server.URL, 0, 2)
+	if err := clock.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	before := clock.Stats()
+
+	atomic.StoreInt32(&limited, 1)
+	if err := clock.Sync(); err == nil {
+		t.Fatal("sync succeeded on a rate limited server")
+	}
+
+	after := clock.Stats()
+	if after.OffsetMs != before.OffsetMs || !after.Synced {
+		t.Errorf("stats = %+v, want the previous offset %vms", after, before.OffsetMs)
+	}
+}
@@ -0,0 +1,58 @@
+package exchange
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"strings"
+)
+
+const erc20ABI = `[
+	{"name":"decimals","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+	{"name":"balanceOf","type":"function","stateMutability":"view",
+	 "inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"name":"allowance","type":"function","stateMutability":"view",
+	 "inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"name":"approve","type":"function","stateMutability":"nonpayable",
+	 "inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]}
+]`
+
+// ERC20 reads and approves the balance of a token
+type ERC20 struct {
+	client  ChainClient
+	address common.Address
+	abi     abi.ABI
+}
+
+func NewERC20(client ChainClient, address common.Address) (*ERC20, error) {
+	tokenABI, err := abi.JSON(strings.NewReader(erc20ABI))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ERC20{client: client, address: address, abi: tokenABI}, nil
+}
+
+func (t *ERC20) Decimals(ctx context.Context) (int, error) {
+	var decimals uint8
+	err := callContract(ctx, t.client, t.abi, t.address, &decimals, "decimals")
+	return int(decimals), err
+}
+
+func (t *ERC20) BalanceOf(ctx context.Context, account common.Address) (*big.Int, error) {
+	var balance *big.Int
+	err := callContract(ctx, t.client, t.abi, t.address, &balance, "balanceOf", account)
+	return balance, err
+}
+
+func (t *ERC20) Allowance(ctx context.Context, owner common.Address, spender common.Address) (*big.Int, error) {
+	var allowance *big.Int
+	err := callContract(ctx, t.client, t.abi, t.address, &allowance, "allowance", owner, spender)
+	return allowance, err
+}
+
+// Approve packs the approval of the spender for the amount
+func (t *ERC20) Approve(spender common.Address, amount *big.Int) ([]byte, error) {
+	return t.abi.Pack("approve", spender, amount)
+}
@@ -2,23 +2,78 @@ package exchange
 
 import (
 	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"NewListingBot/logger"
 	"context"
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
-	"log"
+	"go.uber.org/zap"
+	"math"
 	"math/big"
 	"strings"
+	"time"
 )
 
+// nativeDecimals is the precision of the native coin of every supported chain
+const nativeDecimals = 18
+
+var ErrTransactionNotPending = errors.New("the transaction is not pending")
+
+// kinds of the transactions sent
+const (
+	TransactionKindBuy      = "buy"
+	TransactionKindSell     = "sell"
+	TransactionKindApprove  = "approve"
+	TransactionKindWithdraw = "withdraw"
+	TransactionKindSpeedUp  = "speed_up"
+	TransactionKindCancel   = "cancel"
+)
+
+// cancelGasLimit is the gas of a transfer of nothing to ourselves
+const cancelGasLimit = 21000
+
+// DEX protocols the swaps can go through
+const (
+	DEXProtocolV2 = "v2"
+	DEXProtocolV3 = "v3"
+)
+
+// SwapRequest is an on-chain buy of a token with the native coin of the chain, or a sell of it for the native coin
+type SwapRequest struct {
+	Token           string          // contract address of the token
+	AmountIn        decimal.Decimal // native coin spent by a buy, tokens sold by a sell
+	SlippagePercent float64         // 0 uses the configured tolerance
+	Recipient       string          // receives the output, the own address when empty
+	Protocol        string          // v2 or v3, the one of the chain when empty
+	Via             []string        // tokens hopped through from the native coin to the token, reversed on a sell
+	OrderID         string          // order the transactions of the swap belong to, if any
+}
+
+// DEXAddresses are the contracts the swaps of a chain go through
+type DEXAddresses struct {
+	Protocol  string // used when the request does not choose
+	Router    string
+	WETH      string // wrapped native coin, every path starts or ends with it
+	V3Router  string
+	V3Factory string
+	V3Quoter  string
+}
+
 type EthereumCompatibleInstance interface {
-	Buy(tokenABI string, ownerAddress string, contractAddress string) (string, error)
+	Buy(ctx context.Context, request SwapRequest) (string, error)
+	Sell(ctx context.Context, request SwapRequest) (string, error)
 	Withdraw(tokenABI string, ownerAddress string, contractAddress string) (string, error)
+	ReplaceTransaction(ctx context.Context, txHash string) (string, error)
+	CancelTransaction(ctx context.Context, txHash string) (string, error)
+	TransactionState(ctx context.Context, txHash string, from string, nonce uint64) (TransactionState, error)
 }
 
 type EthereumCompatible struct {
@@ -28,95 +83,400 @@ type EthereumCompatible struct {
 	contractAddr common.Address
 	cfg          config.Config
 	ChainID      int
+	client       ChainClient
+	dex          DEXAddresses
+	gas          GasSettings
 }
 
-func NewEthereumExchange() EthereumCompatibleInstance {
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatal(err)
-	}
+func NewEthereumExchange(cfg config.Config) *EthereumCompatible {
 	return &EthereumCompatible{
 		infuraURL:  cfg.EthereumInfuraURL,
 		privateKey: cfg.EthereumPrivateKey,
 		ChainID:    cfg.EthereumChainID,
+		cfg:        cfg,
+		dex: DEXAddresses{
+			Protocol:  cfg.EthereumDEXProtocol,
+			Router:    cfg.EthereumRouterAddress,
+			WETH:      cfg.EthereumWETHAddress,
+			V3Router:  cfg.EthereumV3RouterAddress,
+			V3Factory: cfg.EthereumV3FactoryAddress,
+			V3Quoter:  cfg.EthereumV3QuoterAddress,
+		},
+		gas: GasSettings{
+			Strategy:   cfg.EthereumGasStrategy,
+			FeeCapGwei: cfg.EthereumGasFeeCapGwei,
+			TipCapGwei: cfg.EthereumGasTipCapGwei,
+		},
 	}
 }
-func NewBinanceExchange() *EthereumCompatible {
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatal(err)
-	}
+
+func NewBinanceExchange(cfg config.Config) *EthereumCompatible {
 	return &EthereumCompatible{
 		infuraURL:  cfg.BinanceInfuraURL,
 		privateKey: cfg.BinancePrivateKey,
 		ChainID:    cfg.BinanceChainID,
+		cfg:        cfg,
+		dex: DEXAddresses{
+			Protocol:  cfg.BinanceDEXProtocol,
+			Router:    cfg.BinanceRouterAddress,
+			WETH:      cfg.BinanceWETHAddress,
+			V3Router:  cfg.BinanceV3RouterAddress,
+			V3Factory: cfg.BinanceV3FactoryAddress,
+			V3Quoter:  cfg.BinanceV3QuoterAddress,
+		},
+		gas: GasSettings{
+			Strategy:   cfg.BinanceGasStrategy,
+			FeeCapGwei: cfg.BinanceGasFeeCapGwei,
+			TipCapGwei: cfg.BinanceGasTipCapGwei,
+		},
 	}
 }
-func NewPolygonExchange() *EthereumCompatible {
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatal(err)
-	}
+
+func NewPolygonExchange(cfg config.Config) *EthereumCompatible {
 	return &EthereumCompatible{
 		infuraURL:  cfg.PolygonInfuraURL,
 		privateKey: cfg.PolygonPrivateKey,
 		ChainID:    cfg.PolygonChainID,
+		cfg:        cfg,
+		dex: DEXAddresses{
+			Protocol:  cfg.PolygonDEXProtocol,
+			Router:    cfg.PolygonRouterAddress,
+			WETH:      cfg.PolygonWETHAddress,
+			V3Router:  cfg.PolygonV3RouterAddress,
+			V3Factory: cfg.PolygonV3FactoryAddress,
+			V3Quoter:  cfg.PolygonV3QuoterAddress,
+		},
+		gas: GasSettings{
+			Strategy:   cfg.PolygonGasStrategy,
+			FeeCapGwei: cfg.PolygonGasFeeCapGwei,
+			TipCapGwei: cfg.PolygonGasTipCapGwei,
+		},
 	}
 }
-func NewSepoliaExchange() *EthereumCompatible {
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatal(err)
-	}
+
+func NewSepoliaExchange(cfg config.Config) *EthereumCompatible {
 	return &EthereumCompatible{
 		infuraURL:  cfg.SepoliaInfuraURL,
 		privateKey: cfg.SepoliaPrivateKey,
 		ChainID:    cfg.SepoliaChainID,
+		cfg:        cfg,
+		dex: DEXAddresses{
+			Protocol:  cfg.SepoliaDEXProtocol,
+			Router:    cfg.SepoliaRouterAddress,
+			WETH:      cfg.SepoliaWETHAddress,
+			V3Router:  cfg.SepoliaV3RouterAddress,
+			V3Factory: cfg.SepoliaV3FactoryAddress,
+			V3Quoter:  cfg.SepoliaV3QuoterAddress,
+		},
+		gas: GasSettings{
+			Strategy:   cfg.SepoliaGasStrategy,
+			FeeCapGwei: cfg.SepoliaGasFeeCapGwei,
+			TipCapGwei: cfg.SepoliaGasTipCapGwei,
+		},
 	}
 }
 
-func (e *EthereumCompatible) Buy(tokenABI string, ownerAddress string, contractAddress string) (string, error) {
+// NewEthereumCompatibleWithClient trades through an existing client, like the fake node of the tests
+func NewEthereumCompatibleWithClient(client ChainClient, privateKey string, chainID int, dex DEXAddresses, gas GasSettings, cfg config.Config) *EthereumCompatible {
+	return &EthereumCompatible{
+		privateKey: privateKey,
+		ChainID:    chainID,
+		cfg:        cfg,
+		client:     client,
+		dex:        dex,
+		gas:        gas,
+	}
+}
+
+// chainClient returns the client of the chain, it connects on first use
+func (e *EthereumCompatible) chainClient() (ChainClient, error) {
+	if e.client != nil {
+		return e.client, nil
+	}
+
 	rpcClient, err := rpc.Dial(e.infuraURL)
+	if err != nil {
+		return nil, err
+	}
+
+	e.client = ethclient.NewClient(rpcClient)
+	return e.client, nil
+}
+
+// protocol returns the protocol the request is swapped through
+func (e *EthereumCompatible) protocol(request SwapRequest) string {
+	if request.Protocol != "" {
+		return request.Protocol
+	}
+	if e.dex.Protocol != "" {
+		return e.dex.Protocol
+	}
+	return DEXProtocolV2
+}
+
+// router returns the V2 router of the chain
+func (e *EthereumCompatible) router(client ChainClient) (*UniswapV2Router, error) {
+	if e.dex.Router == "" || e.dex.WETH == "" {
+		return nil, fmt.Errorf("no V2 router configured for chain %d", e.ChainID)
+	}
+	return NewUniswapV2Router(client, common.HexToAddress(e.dex.Router))
+}
+
+// uniswapV3 returns the V3 contracts of the chain
+func (e *EthereumCompatible) uniswapV3(client ChainClient) (*UniswapV3, error) {
+	if e.dex.V3Router == "" || e.dex.V3Factory == "" || e.dex.V3Quoter == "" || e.dex.WETH == "" {
+		return nil, fmt.Errorf("no V3 contracts configured for chain %d", e.ChainID)
+	}
+	return NewUniswapV3(client, common.HexToAddress(e.dex.V3Router), common.HexToAddress(e.dex.V3Factory), common.HexToAddress(e.dex.V3Quoter))
+}
+
+// feeTiers returns the V3 fees looked up by the discovery
+func (e *EthereumCompatible) feeTiers() []uint32 {
+	if len(e.cfg.DEXV3FeeTiers) == 0 {
+		return DefaultV3FeeTiers
+	}
+
+	tiers := make([]uint32, 0, len(e.cfg.DEXV3FeeTiers))
+	for _, tier := range e.cfg.DEXV3FeeTiers {
+		tiers = append(tiers, uint32(tier))
+	}
+	return tiers
+}
+
+// buyPath returns the tokens from the wrapped native coin to the token, sellPath the other way around
+func (e *EthereumCompatible) buyPath(request SwapRequest) []common.Address {
+	path := []common.Address{common.HexToAddress(e.dex.WETH)}
+	for _, token := range request.Via {
+		path = append(path, common.HexToAddress(token))
+	}
+	return append(path, common.HexToAddress(request.Token))
+}
+
+func (e *EthereumCompatible) sellPath(request SwapRequest) []common.Address {
+	buyPath := e.buyPath(request)
+
+	path := make([]common.Address, len(buyPath))
+	for i, token := range buyPath {
+		path[len(buyPath)-1-i] = token
+	}
+	return path
+}
+
+// swapParams returns who receives the output of the swap, its min out and its deadline
+func (e *EthereumCompatible) swapParams(request SwapRequest, quoted *big.Int) (common.Address, *big.Int, *big.Int, error) {
+	recipient, err := ownAddress(e.privateKey)
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	if request.Recipient != "" {
+		recipient = common.HexToAddress(request.Recipient)
+	}
+
+	slippage := request.SlippagePercent
+	if slippage <= 0 {
+		slippage = e.cfg.DEXSlippagePercent
+	}
+
+	deadline := big.NewInt(time.Now().Add(time.Duration(e.cfg.DEXDeadlineSeconds) * time.Second).Unix())
+
+	return recipient, minAmountOut(quoted, slippage), deadline, nil
+}
+
+// Buy swaps the native coin for the token through the V2 router or the V3 pools of the chain,
+// the min out is the quote less the slippage tolerance
+func (e *EthereumCompatible) Buy(ctx context.Context, request SwapRequest) (string, error) {
+	client, err := e.chainClient()
 	if err != nil {
 		return "", err
 	}
-	client := ethclient.NewClient(rpcClient)
 
-	// Set up a client to interact with the Ethereum network
-	tokenInstance, err := setupTokenInstance(tokenABI)
+	amountIn := request.AmountIn.BigInt(nativeDecimals)
+	if amountIn.Sign() <= 0 {
+		return "", errors.New("the amount to swap must be positive")
+	}
+
+	var to common.Address
+	var input []byte
+
+	switch protocol := e.protocol(request); protocol {
+	case DEXProtocolV2:
+		to, input, err = e.buyV2(ctx, client, request, amountIn)
+	case DEXProtocolV3:
+		to, input, err = e.buyV3(ctx, client, request, amountIn)
+	default:
+		err = fmt.Errorf("unsupported dex protocol: %s", protocol)
+	}
 	if err != nil {
 		return "", err
 	}
 
-	// Construct the data field
-	tokenAmount := big.NewInt(1000000000000000000) // buy 1 token, for example
-	input, err := tokenInstance.Pack("transfer", common.HexToAddress(ownerAddress), tokenAmount)
+	return e.sendTransaction(ctx, client, TransactionKindBuy, request.OrderID, to, amountIn, input)
+}
+
+func (e *EthereumCompatible) buyV2(ctx context.Context, client ChainClient, request SwapRequest, amountIn *big.Int) (common.Address, []byte, error) {
+	router, err := e.router(client)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	path := e.buyPath(request)
+	amounts, err := router.GetAmountsOut(ctx, amountIn, path)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	recipient, amountOutMin, deadline, err := e.swapParams(request, amounts[len(amounts)-1])
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	input, err := router.SwapExactETHForTokens(amountOutMin, path, recipient, deadline)
+	return router.Address(), input, err
+}
+
+// buyV3 sends the native coin with the swap, the router wraps it
+func (e *EthereumCompatible) buyV3(ctx context.Context, client ChainClient, request SwapRequest, amountIn *big.Int) (common.Address, []byte, error) {
+	v3, err := e.uniswapV3(client)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	route, err := v3.Route(ctx, e.buyPath(request), amountIn, e.feeTiers())
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	recipient, amountOutMin, deadline, err := e.swapParams(request, route.AmountOut)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	input, err := v3.Swap(route, amountIn, amountOutMin, recipient, deadline)
+	return v3.Address(), input, err
+}
+
+// Sell swaps the tokens for the native coin through the V2 router or the V3 pools of the chain,
+// the router is approved first when it is not allowed to spend them
+func (e *EthereumCompatible) Sell(ctx context.Context, request SwapRequest) (string, error) {
+	client, err := e.chainClient()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := NewERC20(client, common.HexToAddress(request.Token))
 	if err != nil {
 		return "", err
 	}
 
-	// Prepare the transaction
-	txData, err := prepareTransaction(e.privateKey, client, common.HexToAddress(contractAddress), input)
+	decimals, err := token.Decimals(ctx)
+	if err != nil {
+		return "", fmt.Errorf("reading token decimals failed: %v", err)
+	}
+
+	amountIn := request.AmountIn.BigInt(decimals)
+	if amountIn.Sign() <= 0 {
+		return "", errors.New("the amount to swap must be positive")
+	}
+
+	var to common.Address
+	var input []byte
+
+	switch protocol := e.protocol(request); protocol {
+	case DEXProtocolV2:
+		to, input, err = e.sellV2(ctx, client, request, amountIn)
+	case DEXProtocolV3:
+		to, input, err = e.sellV3(ctx, client, request, amountIn)
+	default:
+		err = fmt.Errorf("unsupported dex protocol: %s", protocol)
+	}
 	if err != nil {
 		return "", err
 	}
 
-	// Increase the gas limit
-	// Sign and broadcast the transaction
-	txHash, err := signAndBroadcastTransaction(client, e.privateKey, common.HexToAddress(contractAddress), txData, input, e.ChainID)
+	err = e.approve(ctx, client, token, to, amountIn, request.OrderID)
 	if err != nil {
 		return "", err
 	}
 
-	return txHash, nil
+	return e.sendTransaction(ctx, client, TransactionKindSell, request.OrderID, to, big.NewInt(0), input)
+}
+
+func (e *EthereumCompatible) sellV2(ctx context.Context, client ChainClient, request SwapRequest, amountIn *big.Int) (common.Address, []byte, error) {
+	router, err := e.router(client)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	path := e.sellPath(request)
+	amounts, err := router.GetAmountsOut(ctx, amountIn, path)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	recipient, amountOutMin, deadline, err := e.swapParams(request, amounts[len(amounts)-1])
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	input, err := router.SwapExactTokensForETH(amountIn, amountOutMin, path, recipient, deadline)
+	return router.Address(), input, err
+}
+
+// sellV3 swaps to the wrapped native coin and unwraps it in the same transaction
+func (e *EthereumCompatible) sellV3(ctx context.Context, client ChainClient, request SwapRequest, amountIn *big.Int) (common.Address, []byte, error) {
+	v3, err := e.uniswapV3(client)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	route, err := v3.Route(ctx, e.sellPath(request), amountIn, e.feeTiers())
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	recipient, amountOutMin, deadline, err := e.swapParams(request, route.AmountOut)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+
+	input, err := v3.SwapToNative(route, amountIn, amountOutMin, recipient, deadline)
+	return v3.Address(), input, err
+}
+
+// approve lets the spender use the amount of tokens unless it already can
+func (e *EthereumCompatible) approve(ctx context.Context, client ChainClient, token *ERC20, spender common.Address, amount *big.Int, orderID string) error {
+	owner, err := ownAddress(e.privateKey)
+	if err != nil {
+		return err
+	}
+
+	allowance, err := token.Allowance(ctx, owner, spender)
+	if err != nil {
+		return fmt.Errorf("reading allowance failed: %v", err)
+	}
+	if allowance.Cmp(amount) >= 0 {
+		return nil
+	}
+
+	input, err := token.Approve(spender, amount)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.sendTransaction(ctx, client, TransactionKindApprove, orderID, token.address, big.NewInt(0), input)
+	if err != nil {
+		return fmt.Errorf("approving the router failed: %v", err)
+	}
+	return nil
 }
 
 func (e *EthereumCompatible) Withdraw(tokenABI string, ownerAddress string, contractAddress string) (string, error) {
-	rpcClient, err := rpc.Dial(e.infuraURL)
+	ctx := context.Background()
+
+	client, err := e.chainClient()
 	if err != nil {
 		return "", err
 	}
-	client := ethclient.NewClient(rpcClient)
 
 	// Set up a client to interact with the Ethereum network
 	tokenInstance, err := setupTokenInstance(tokenABI)
@@ -132,14 +492,8 @@ func (e *EthereumCompatible) Withdraw(tokenABI string, ownerAddress string, cont
 		return "", err
 	}
 
-	// Prepare the transaction
-	txData, err := prepareTransaction(e.privateKey, client, common.HexToAddress(ownerAddress), input)
-	if err != nil {
-		return "", err
-	}
-
-	// Sign and broadcast the transaction
-	txHash, err := signAndBroadcastTransaction(client, e.privateKey, common.HexToAddress(contractAddress), txData, input, e.ChainID)
+	// Prepare, sign and broadcast the transaction
+	txHash, err := e.sendTransaction(ctx, client, TransactionKindWithdraw, "", common.HexToAddress(ownerAddress), big.NewInt(0), input)
 	if err != nil {
 		return "", err
 	}
@@ -158,64 +512,258 @@ func setupTokenInstance(tokenABI string) (*abi.ABI, error) {
 	return &contractABI, nil
 }
 
-func prepareTransaction(privateKeyStr string, client *ethclient.Client, contractAddress common.Address, input []byte) (*types.Transaction, error) {
+// ownAddress returns the address of the private key
+func ownAddress(privateKeyStr string) (common.Address, error) {
 	privateKey, err := crypto.HexToECDSA(privateKeyStr)
 	if err != nil {
-		return nil, err
+		return common.Address{}, err
 	}
 
 	publicKey := privateKey.Public()
 	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
 	if !ok {
-		return nil, fmt.Errorf("error casting public key to ECDSA")
+		return common.Address{}, fmt.Errorf("error casting public key to ECDSA")
 	}
 
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
+	return crypto.PubkeyToAddress(*publicKeyECDSA), nil
+}
+
+// sendTransaction signs and broadcasts a call of the contract at the next nonce of the key,
+// the call is sent again at a fresh nonce when the node says the one it got is already used
+func (e *EthereumCompatible) sendTransaction(ctx context.Context, client ChainClient, kind string, orderID string, contractAddress common.Address, value *big.Int, input []byte) (string, error) {
+	fromAddress, err := ownAddress(e.privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	for attempt := 0; ; attempt++ {
+		nonce, err := nonceManager.Next(ctx, client, e.ChainID, fromAddress)
+		if err != nil {
+			return "", fmt.Errorf("reading nonce failed: %v", err)
+		}
+
+		tx, err := e.prepareTransaction(ctx, client, nonce, contractAddress, value, input)
+		if err != nil {
+			// nothing was sent, the next transaction takes the nonce
+			nonceManager.Release(e.ChainID, fromAddress, nonce)
+			return "", err
+		}
+
+		signedTx, err := e.signTransaction(tx)
+		if err != nil {
+			nonceManager.Release(e.ChainID, fromAddress, nonce)
+			return "", err
+		}
+
+		err = client.SendTransaction(ctx, signedTx)
+		if err == nil {
+			txHash := signedTx.Hash().Hex()
+			e.publishTransaction(fromAddress, tx, txHash, kind, orderID, "")
+			return txHash, nil
+		}
+
+		if isRejectedBeforeMempool(err) {
+			// the node refused the transaction outright, its nonce is still free
+			nonceManager.Release(e.ChainID, fromAddress, nonce)
+			return "", err
+		}
+
+		// the transaction may have reached the pool or the nonce is taken there,
+		// either way the next one is read from the node again
+		nonceManager.Resync(e.ChainID, fromAddress)
+		if !isNonceTooLow(err) || attempt >= maxNonceRetries {
+			return "", err
+		}
+	}
+}
+
+// prepareTransaction builds a call of the contract sending value in wei (1 eth = 10^18 wei),
+// priced by the gas strategy of the chain with a limit from the estimate of the node
+func (e *EthereumCompatible) prepareTransaction(ctx context.Context, client ChainClient, nonce uint64, contractAddress common.Address, value *big.Int, input []byte) (*types.Transaction, error) {
+	fromAddress, err := ownAddress(e.privateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	value := big.NewInt(0)     // in wei (1 eth = 10^18 wei)
-	gasLimit := uint64(200000) // in units
-	gasPrice, err := client.SuggestGasPrice(context.Background())
+	fees, err := e.gasFees(ctx, client)
 	if err != nil {
 		return nil, err
 	}
 
-	// Prepare the transaction by setting the from address, value, gas limit, and gas price
-	tx := types.NewTx(&types.LegacyTx{
-		Nonce:    nonce,
-		GasPrice: gasPrice,
-		Gas:      gasLimit,
-		To:       &contractAddress,
-		Value:    value,
-		Data:     input,
+	gasLimit := e.gasLimit(ctx, client, ethereum.CallMsg{From: fromAddress, To: &contractAddress, Value: value, Data: input})
+
+	return e.newTransaction(nonce, fees, gasLimit, contractAddress, value, input), nil
+}
+
+func (e *EthereumCompatible) gasFees(ctx context.Context, client ChainClient) (GasFees, error) {
+	strategy, err := NewGasStrategy(e.gas, e.cfg)
+	if err != nil {
+		return GasFees{}, err
+	}
+	return strategy.Fees(ctx, client)
+}
+
+// newTransaction is a legacy transaction for a gas price and an EIP-1559 one for fee caps
+func (e *EthereumCompatible) newTransaction(nonce uint64, fees GasFees, gasLimit uint64, to common.Address, value *big.Int, input []byte) *types.Transaction {
+	if !fees.Dynamic() {
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: fees.GasPrice,
+			Gas:      gasLimit,
+			To:       &to,
+			Value:    value,
+			Data:     input,
+		})
+	}
+
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(int64(e.ChainID)),
+		Nonce:     nonce,
+		GasTipCap: fees.GasTipCap,
+		GasFeeCap: fees.GasFeeCap,
+		Gas:       gasLimit,
+		To:        &to,
+		Value:     value,
+		Data:      input,
 	})
+}
+
+// ReplaceTransaction sends the call of a stuck transaction again at its nonce with higher fees,
+// the one of the two mined first wins and the other one is dropped
+func (e *EthereumCompatible) ReplaceTransaction(ctx context.Context, txHash string) (string, error) {
+	client, err := e.chainClient()
+	if err != nil {
+		return "", err
+	}
 
+	original, err := e.pendingTransaction(ctx, client, txHash)
+	if err != nil {
+		return "", err
+	}
+
+	return e.replaceTransaction(ctx, client, original, TransactionKindSpeedUp, *original.To(), original.Value(), original.Data(), original.Gas())
+}
+
+// CancelTransaction replaces a stuck transaction with a transfer of nothing to ourselves,
+// once it is mined the stuck one can never be
+func (e *EthereumCompatible) CancelTransaction(ctx context.Context, txHash string) (string, error) {
+	client, err := e.chainClient()
+	if err != nil {
+		return "", err
+	}
+
+	original, err := e.pendingTransaction(ctx, client, txHash)
+	if err != nil {
+		return "", err
+	}
+
+	fromAddress, err := ownAddress(e.privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return e.replaceTransaction(ctx, client, original, TransactionKindCancel, fromAddress, big.NewInt(0), nil, cancelGasLimit)
+}
+
+// pendingTransaction returns the transaction of the hash while it is not mined
+func (e *EthereumCompatible) pendingTransaction(ctx context.Context, client ChainClient, txHash string) (*types.Transaction, error) {
+	tx, isPending, err := client.TransactionByHash(ctx, common.HexToHash(txHash))
+	if err != nil {
+		return nil, fmt.Errorf("reading transaction %s failed: %v", txHash, err)
+	}
+	if !isPending {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotPending, txHash)
+	}
+	if tx.To() == nil {
+		return nil, fmt.Errorf("transaction %s deploys a contract", txHash)
+	}
 	return tx, nil
 }
 
-func signAndBroadcastTransaction(client *ethclient.Client, privateKeyStr string, contractAddr common.Address, tx *types.Transaction, input []byte, chainID int) (string, error) {
-	privateKey, err := crypto.HexToECDSA(privateKeyStr)
+// replaceTransaction sends a transaction at the nonce of the original one, its fees are the current ones of
+// the gas strategy but at least the ones of the original bumped enough for the nodes to take the replacement
+func (e *EthereumCompatible) replaceTransaction(ctx context.Context, client ChainClient, original *types.Transaction, kind string, to common.Address, value *big.Int, input []byte, gasLimit uint64) (string, error) {
+	fees, err := e.gasFees(ctx, client)
+	if err != nil {
+		return "", err
+	}
+
+	fees = replacementFees(original, fees, e.cfg.GasReplacementBumpPercent)
+	tx := e.newTransaction(original.Nonce(), fees, gasLimit, to, value, input)
+
+	txHash, err := e.signAndBroadcastTransaction(ctx, client, tx)
 	if err != nil {
 		return "", err
 	}
 
-	// Create a signer
-	signer := types.NewEIP155Signer(big.NewInt(int64(chainID))) // Replace 1 with your chain ID
+	fromAddress, err := ownAddress(e.privateKey)
+	if err == nil {
+		e.publishTransaction(fromAddress, tx, txHash, kind, "", original.Hash().Hex())
+	}
+	return txHash, nil
+}
+
+// publishTransaction tells the listeners a transaction was broadcast so they can follow it
+func (e *EthereumCompatible) publishTransaction(from common.Address, tx *types.Transaction, txHash string, kind string, orderID string, replaces string) {
+	var to string
+	if tx.To() != nil {
+		to = tx.To().Hex()
+	}
+
+	Events.PublishTransaction(TransactionEvent{
+		ChainID:  e.ChainID,
+		Hash:     txHash,
+		From:     from.Hex(),
+		To:       to,
+		Nonce:    tx.Nonce(),
+		Value:    tx.Value().String(),
+		Kind:     kind,
+		OrderID:  orderID,
+		Replaces: replaces,
+		Time:     time.Now(),
+	})
+}
+
+// gasLimit is the estimate of the node with a safety margin. A swap right after its approval cannot be estimated
+// before the approval is mined, it gets the fallback limit.
+func (e *EthereumCompatible) gasLimit(ctx context.Context, client ChainClient, call ethereum.CallMsg) uint64 {
+	estimate, err := client.EstimateGas(ctx, call)
+	if err != nil {
+		logger.Info(ctx, "gas estimate failed, using the fallback limit",
+			zap.Uint64("gasLimit", e.cfg.GasLimitFallback), zap.Error(err))
+		return e.cfg.GasLimitFallback
+	}
+
+	multiplier := e.cfg.GasLimitMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	return uint64(math.Ceil(float64(estimate) * multiplier))
+}
 
-	// Sign the transaction
-	signedTx, err := types.SignTx(tx, signer, privateKey)
+// signAndBroadcastTransaction signs the transaction and sends it to the node
+func (e *EthereumCompatible) signAndBroadcastTransaction(ctx context.Context, client ChainClient, tx *types.Transaction) (string, error) {
+	signedTx, err := e.signTransaction(tx)
 	if err != nil {
 		return "", err
 	}
 
 	// Broadcast the transaction
-	err = client.SendTransaction(context.Background(), signedTx)
+	err = client.SendTransaction(ctx, signedTx)
 	if err != nil {
 		return "", err
 	}
 
 	return signedTx.Hash().Hex(), nil
 }
+
+// signTransaction signs with the London signer, which takes both the legacy and the EIP-1559 transactions
+func (e *EthereumCompatible) signTransaction(tx *types.Transaction) (*types.Transaction, error) {
+	privateKey, err := crypto.HexToECDSA(e.privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := types.NewLondonSigner(big.NewInt(int64(e.ChainID)))
+	return types.SignTx(tx, signer, privateKey)
+}
@@ -0,0 +1,159 @@
+package exchange
+
+import (
+	"NewListingBot/decimal"
+	"sync"
+	"time"
+)
+
+// OrderUpdate is the state of one of our orders as pushed by the venue
+type OrderUpdate struct {
+	Venue          string          `json:"venue"`
+	Symbol         string          `json:"symbol"`
+	OrderID        string          `json:"order_id"`
+	ClientOrderID  string          `json:"client_order_id"`
+	Side           OrderSide       `json:"side"`
+	Status         string          `json:"status"`
+	Price          decimal.Decimal `json:"price"`
+	Quantity       decimal.Decimal `json:"quantity"`
+	ExecutedQty    decimal.Decimal `json:"executed_qty"`
+	ExecutedAmount decimal.Decimal `json:"executed_amount"`
+	AveragePrice   decimal.Decimal `json:"average_price"`
+	Time           time.Time       `json:"time"`
+}
+
+// FillEvent is a single execution of one of our orders
+type FillEvent struct {
+	Venue           string          `json:"venue"`
+	Symbol          string          `json:"symbol"`
+	OrderID         string          `json:"order_id"`
+	ClientOrderID   string          `json:"client_order_id"`
+	TradeID         string          `json:"trade_id"`
+	Side            OrderSide       `json:"side"`
+	Price           decimal.Decimal `json:"price"`
+	Quantity        decimal.Decimal `json:"quantity"`
+	Amount          decimal.Decimal `json:"amount"`
+	Commission      decimal.Decimal `json:"commission"`
+	CommissionAsset string          `json:"commission_asset"`
+	IsMaker         bool            `json:"is_maker"`
+	Time            time.Time       `json:"time"`
+}
+
+type BalanceUpdate struct {
+	Venue  string          `json:"venue"`
+	Asset  string          `json:"asset"`
+	Free   decimal.Decimal `json:"free"`
+	Locked decimal.Decimal `json:"locked"`
+	Time   time.Time       `json:"time"`
+}
+
+// TransactionEvent is a transaction we broadcast on a chain, Replaces is the hash of the one it replaces
+type TransactionEvent struct {
+	ChainID  int       `json:"chain_id"`
+	Hash     string    `json:"hash"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Nonce    uint64    `json:"nonce"`
+	Value    string    `json:"value"`
+	Kind     string    `json:"kind"`
+	OrderID  string    `json:"order_id"`
+	Replaces string    `json:"replaces"`
+	Time     time.Time `json:"time"`
+}
+
+// EventBus hands the order updates, fills and balance changes pushed by the venues to whoever listens
+type EventBus struct {
+	mu              sync.RWMutex
+	orderHandlers   []func(OrderUpdate)
+	fillHandlers    []func(FillEvent)
+	balanceHandlers []func(BalanceUpdate)
+	txHandlers      []func(TransactionEvent)
+	balances        map[string]BalanceUpdate
+}
+
+// Events is the bus shared by every venue stream
+var Events = NewEventBus()
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		balances: map[string]BalanceUpdate{},
+	}
+}
+
+func (b *EventBus) OnOrderUpdate(handler func(OrderUpdate)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.orderHandlers = append(b.orderHandlers, handler)
+}
+
+func (b *EventBus) OnFill(handler func(FillEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.fillHandlers = append(b.fillHandlers, handler)
+}
+
+func (b *EventBus) OnBalance(handler func(BalanceUpdate)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.balanceHandlers = append(b.balanceHandlers, handler)
+}
+
+func (b *EventBus) OnTransaction(handler func(TransactionEvent)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.txHandlers = append(b.txHandlers, handler)
+}
+
+func (b *EventBus) PublishOrderUpdate(update OrderUpdate) {
+	b.mu.RLock()
+	handlers := b.orderHandlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(update)
+	}
+}
+
+func (b *EventBus) PublishFill(fill FillEvent) {
+	b.mu.RLock()
+	handlers := b.fillHandlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(fill)
+	}
+}
+
+func (b *EventBus) PublishBalance(update BalanceUpdate) {
+	b.mu.Lock()
+	b.balances[update.Venue+":"+update.Asset] = update
+	handlers := b.balanceHandlers
+	b.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(update)
+	}
+}
+
+func (b *EventBus) PublishTransaction(event TransactionEvent) {
+	b.mu.RLock()
+	handlers := b.txHandlers
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Balance returns the last balance of the asset pushed by the venue
+func (b *EventBus) Balance(venue string, asset string) (BalanceUpdate, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	update, ok := b.balances[venue+":"+asset]
+	return update, ok
+}
@@ -0,0 +1,121 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"errors"
+	"fmt"
+)
+
+const (
+	VenueMEXC = "mexc"
+)
+
+type OrderSide string
+
+const (
+	OrderSideBuy  OrderSide = "BUY"
+	OrderSideSell OrderSide = "SELL"
+)
+
+type OrderType string
+
+const (
+	OrderTypeMarket            OrderType = "MARKET"
+	OrderTypeLimit             OrderType = "LIMIT"
+	OrderTypeImmediateOrCancel OrderType = "IMMEDIATE_OR_CANCEL"
+	OrderTypeFillOrKill        OrderType = "FILL_OR_KILL"
+)
+
+// ErrOrderStateUnknown is returned when an order request got no answer from the venue,
+// the order may or may not have been placed and has to be looked up by its client order id
+var ErrOrderStateUnknown = errors.New("order state unknown")
+
+// ErrOrderNotFound is returned when the venue answered that it does not know the order
+var ErrOrderNotFound = errors.New("order not found")
+
+// OrderRequest describes an order independently of the venue it is sent to
+type OrderRequest struct {
+	Symbol        string
+	Side          OrderSide
+	Type          OrderType
+	Quantity      decimal.Decimal // base asset quantity
+	QuoteOrderQty decimal.Decimal // quote asset amount, only used by market buys
+	Price         decimal.Decimal // only used by limit, immediate or cancel and fill or kill orders
+	ClientOrderID string          // lets the venue reject duplicates and lets us look the order up
+}
+
+type OrderResponse struct {
+	Symbol              string          `json:"symbol"`
+	OrderId             string          `json:"orderId"`
+	OrderListId         int             `json:"orderListId"`
+	ClientOrderId       string          `json:"clientOrderId"`
+	Price               decimal.Decimal `json:"price"`
+	OrigQty             decimal.Decimal `json:"origQty"`
+	ExecutedQty         decimal.Decimal `json:"executedQty"`
+	CummulativeQuoteQty decimal.Decimal `json:"cummulativeQuoteQty"`
+	Status              string          `json:"status"`
+	Type                string          `json:"type"`
+	Side                string          `json:"side"`
+	TransactTime        int64           `json:"transactTime"`
+}
+
+type Balance struct {
+	Asset  string          `json:"asset"`
+	Free   decimal.Decimal `json:"free"`
+	Locked decimal.Decimal `json:"locked"`
+}
+
+// Trade is a single execution of one of our orders
+type Trade struct {
+	Symbol          string          `json:"symbol"`
+	Id              string          `json:"id"`
+	OrderId         string          `json:"orderId"`
+	ClientOrderId   string          `json:"clientOrderId"`
+	Price           decimal.Decimal `json:"price"`
+	Qty             decimal.Decimal `json:"qty"`
+	QuoteQty        decimal.Decimal `json:"quoteQty"`
+	Commission      decimal.Decimal `json:"commission"`
+	CommissionAsset string          `json:"commissionAsset"`
+	Time            int64           `json:"time"`
+	IsBuyer         bool            `json:"isBuyer"`
+	IsMaker         bool            `json:"isMaker"`
+}
+
+type Ticker struct {
+	Symbol    string          `json:"symbol"`
+	LastPrice decimal.Decimal `json:"lastPrice"`
+	BidPrice  decimal.Decimal `json:"bidPrice"`
+	AskPrice  decimal.Decimal `json:"askPrice"`
+	HighPrice decimal.Decimal `json:"highPrice"`
+	LowPrice  decimal.Decimal `json:"lowPrice"`
+	Volume    decimal.Decimal `json:"volume"`
+}
+
+// Exchange is implemented by every centralized venue the bot can trade on.
+// The order lifecycle in models only talks to this interface, so new venues or fakes
+// can be plugged in without touching it.
+type Exchange interface {
+	Name() string
+	PlaceMarketOrder(request OrderRequest) (OrderResponse, error)
+	PlaceLimitOrder(request OrderRequest) (OrderResponse, error)
+	CancelOrder(symbol string, orderID string) (OrderResponse, error)
+	CancelAllOpenOrders(symbol string) ([]OrderResponse, error)
+	GetOrder(symbol string, orderID string) (OrderResponse, error)
+	GetOrderByClientID(symbol string, clientOrderID string) (OrderResponse, error)
+	GetOpenOrders(symbol string) ([]OrderResponse, error)
+	GetMyTrades(symbol string, orderID string) ([]Trade, error)
+	GetBalances() ([]Balance, error)
+	GetTicker(symbol string) (Ticker, error)
+	GetSymbolInfo(symbol string) (SymbolInfo, error)
+}
+
+// New returns the Exchange registered under the venue name
+func New(venue string, cfg config.Config) (Exchange, error) {
+	switch venue {
+	case "", VenueMEXC:
+		return NewMXCExchange(cfg), nil
+	}
+
+	return nil, fmt.Errorf("unsupported exchange venue: %s", venue)
+}
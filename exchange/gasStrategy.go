@@ -0,0 +1,234 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// gas strategies selectable per chain
+const (
+	GasStrategyLegacy     = "legacy"
+	GasStrategyFast       = "fast"
+	GasStrategyAggressive = "aggressive"
+	GasStrategyFixed      = "fixed"
+	GasStrategyPercentile = "percentile"
+)
+
+// gweiDecimals is the precision of a gwei amount in wei
+const gweiDecimals = 9
+
+// GasFees are the fees of a transaction, a gas price for a legacy one and the caps for an EIP-1559 one
+type GasFees struct {
+	GasPrice  *big.Int
+	GasTipCap *big.Int
+	GasFeeCap *big.Int
+}
+
+// Dynamic tells if the fees are for an EIP-1559 transaction
+func (f GasFees) Dynamic() bool {
+	return f.GasFeeCap != nil
+}
+
+// GasStrategy prices the transactions of a chain
+type GasStrategy interface {
+	Fees(ctx context.Context, client ChainClient) (GasFees, error)
+}
+
+// GasSettings are the gas settings of a chain
+type GasSettings struct {
+	Strategy   string
+	FeeCapGwei decimal.Decimal // max fee per gas of the fixed strategy
+	TipCapGwei decimal.Decimal // tip per gas of the fixed strategy
+}
+
+// NewGasStrategy returns the strategy of the settings, the shared knobs come from the config
+func NewGasStrategy(settings GasSettings, cfg config.Config) (GasStrategy, error) {
+	switch settings.Strategy {
+	case GasStrategyLegacy:
+		return LegacyGas{}, nil
+	case "", GasStrategyFast:
+		return SuggestedTipGas{TipMultiplier: 1}, nil
+	case GasStrategyAggressive:
+		return SuggestedTipGas{TipMultiplier: cfg.GasAggressiveTipMultiplier}, nil
+	case GasStrategyFixed:
+		if settings.FeeCapGwei.Sign() <= 0 {
+			return nil, fmt.Errorf("the fixed gas strategy needs a fee cap")
+		}
+		return FixedCapGas{
+			FeeCap: settings.FeeCapGwei.BigInt(gweiDecimals),
+			TipCap: settings.TipCapGwei.BigInt(gweiDecimals),
+		}, nil
+	case GasStrategyPercentile:
+		return PercentileGas{Blocks: uint64(cfg.GasPercentileBlocks), Percentile: cfg.GasPercentile}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported gas strategy: %s", settings.Strategy)
+}
+
+// LegacyGas pays the gas price suggested by the node, for the chains without EIP-1559
+type LegacyGas struct{}
+
+func (LegacyGas) Fees(ctx context.Context, client ChainClient) (GasFees, error) {
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return GasFees{}, fmt.Errorf("suggesting gas price failed: %v", err)
+	}
+	return GasFees{GasPrice: gasPrice}, nil
+}
+
+// SuggestedTipGas tips what the node suggests times the multiplier
+type SuggestedTipGas struct {
+	TipMultiplier float64
+}
+
+func (s SuggestedTipGas) Fees(ctx context.Context, client ChainClient) (GasFees, error) {
+	baseFee, err := latestBaseFee(ctx, client)
+	if err != nil {
+		return GasFees{}, err
+	}
+	if baseFee == nil {
+		return LegacyGas{}.Fees(ctx, client)
+	}
+
+	tip, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return GasFees{}, fmt.Errorf("suggesting gas tip failed: %v", err)
+	}
+
+	if s.TipMultiplier > 0 && s.TipMultiplier != 1 {
+		tip = decimal.NewFromBigInt(tip, 0).Mul(decimal.NewFromFloat(s.TipMultiplier)).BigInt(0)
+	}
+
+	return dynamicFees(baseFee, tip), nil
+}
+
+// FixedCapGas tips a fixed amount and never pays more than the cap per gas,
+// the transaction waits in the mempool while the base fee is above it
+type FixedCapGas struct {
+	TipCap *big.Int
+	FeeCap *big.Int
+}
+
+func (s FixedCapGas) Fees(ctx context.Context, client ChainClient) (GasFees, error) {
+	baseFee, err := latestBaseFee(ctx, client)
+	if err != nil {
+		return GasFees{}, err
+	}
+	if baseFee == nil {
+		return GasFees{GasPrice: s.FeeCap}, nil
+	}
+
+	tip := s.TipCap
+	if tip.Cmp(s.FeeCap) > 0 {
+		tip = s.FeeCap
+	}
+
+	return GasFees{GasTipCap: tip, GasFeeCap: s.FeeCap}, nil
+}
+
+// PercentileGas tips the median over the recent blocks of the percentile of the tips paid in each of them
+type PercentileGas struct {
+	Blocks     uint64
+	Percentile float64
+}
+
+func (s PercentileGas) Fees(ctx context.Context, client ChainClient) (GasFees, error) {
+	baseFee, err := latestBaseFee(ctx, client)
+	if err != nil {
+		return GasFees{}, err
+	}
+	if baseFee == nil {
+		return LegacyGas{}.Fees(ctx, client)
+	}
+
+	history, err := client.FeeHistory(ctx, s.Blocks, nil, []float64{s.Percentile})
+	if err != nil {
+		return GasFees{}, fmt.Errorf("reading fee history failed: %v", err)
+	}
+
+	var tips []*big.Int
+	for _, rewards := range history.Reward {
+		if len(rewards) > 0 && rewards[0] != nil {
+			tips = append(tips, rewards[0])
+		}
+	}
+	if len(tips) == 0 {
+		return SuggestedTipGas{TipMultiplier: 1}.Fees(ctx, client)
+	}
+
+	sort.Slice(tips, func(i, j int) bool {
+		return tips[i].Cmp(tips[j]) < 0
+	})
+
+	// the history ends with the base fee of the next block
+	if len(history.BaseFee) > 0 && history.BaseFee[len(history.BaseFee)-1] != nil {
+		baseFee = history.BaseFee[len(history.BaseFee)-1]
+	}
+
+	return dynamicFees(baseFee, tips[len(tips)/2]), nil
+}
+
+// latestBaseFee returns the base fee of the latest block, nil when the chain has no EIP-1559
+func latestBaseFee(ctx context.Context, client ChainClient) (*big.Int, error) {
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading latest block failed: %v", err)
+	}
+	return header.BaseFee, nil
+}
+
+// dynamicFees caps the fee at twice the base fee plus the tip, which stays above the base fee for 6 full blocks in a row
+func dynamicFees(baseFee *big.Int, tip *big.Int) GasFees {
+	feeCap := new(big.Int).Mul(baseFee, big.NewInt(2))
+	return GasFees{GasTipCap: tip, GasFeeCap: feeCap.Add(feeCap, tip)}
+}
+
+// replacementFees raises the fees to at least the ones of the original transaction bumped by the percent,
+// the nodes only take a replacement paying 10% more than the pending transaction
+func replacementFees(original *types.Transaction, fees GasFees, bumpPercent float64) GasFees {
+	if original.Type() == types.LegacyTxType {
+		gasPrice := fees.GasPrice
+		if fees.Dynamic() {
+			gasPrice = fees.GasFeeCap
+		}
+		return GasFees{GasPrice: maxBigInt(gasPrice, bumpFee(original.GasPrice(), bumpPercent))}
+	}
+
+	tip, feeCap := fees.GasTipCap, fees.GasFeeCap
+	if !fees.Dynamic() {
+		tip, feeCap = fees.GasPrice, fees.GasPrice
+	}
+
+	tip = maxBigInt(tip, bumpFee(original.GasTipCap(), bumpPercent))
+	feeCap = maxBigInt(feeCap, bumpFee(original.GasFeeCap(), bumpPercent))
+	if tip.Cmp(feeCap) > 0 {
+		feeCap = tip
+	}
+
+	return GasFees{GasTipCap: tip, GasFeeCap: feeCap}
+}
+
+// bumpFee raises the fee by the percent, rounded up so the bump is never short of it
+func bumpFee(fee *big.Int, bumpPercent float64) *big.Int {
+	basisPoints := int64(math.Ceil(bumpPercent * 100))
+	if basisPoints < 0 {
+		basisPoints = 0
+	}
+
+	bumped := new(big.Int).Mul(fee, big.NewInt(10000+basisPoints))
+	bumped.Add(bumped, big.NewInt(9999))
+	return bumped.Quo(bumped, big.NewInt(10000))
+}
+
+func maxBigInt(a *big.Int, b *big.Int) *big.Int {
+	if a == nil || a.Cmp(b) < 0 {
+		return b
+	}
+	return a
+}
@@ -4,50 +4,56 @@ package exchange
 
 import (
 	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"NewListingBot/logger"
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go.uber.org/zap"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
 )
 
+// errResponseLost is returned when a request was sent but its response never came back
+var errResponseLost = errors.New("response lost")
+
 type MEXCExchange struct {
 	cfg config.Config
 }
 
-type NewMEXCOrderResponse struct {
-	Symbol       string `json:"symbol"`
-	OrderId      string `json:"orderId"`
-	OrderListId  int    `json:"orderListId"`
-	Price        string `json:"price"`
-	OrigQty      string `json:"origQty"`
-	Type         string `json:"type"`
-	Side         string `json:"side"`
-	TransactTime int64  `json:"transactTime"`
-}
+// the symbol rules are shared by every MEXCExchange, exchangeInfo is too heavy to load per order
+var mexcSymbolRules *SymbolRulesCache
+var mexcSymbolRulesOnce sync.Once
 
 type MEXCMarketPriceResponse struct {
-	Symbol             string      `json:"symbol"`
-	PriceChange        string      `json:"priceChange"`
-	PriceChangePercent string      `json:"priceChangePercent"`
-	PrevClosePrice     string      `json:"prevClosePrice"`
-	LastPrice          string      `json:"lastPrice"`
-	BidPrice           string      `json:"bidPrice"`
-	BidQty             string      `json:"bidQty"`
-	AskPrice           string      `json:"askPrice"`
-	AskQty             string      `json:"askQty"`
-	OpenPrice          string      `json:"openPrice"`
-	HighPrice          string      `json:"highPrice"`
-	LowPrice           string      `json:"lowPrice"`
-	Volume             string      `json:"volume"`
-	QuoteVolume        interface{} `json:"quoteVolume"`
-	OpenTime           int64       `json:"openTime"`
-	CloseTime          int64       `json:"closeTime"`
-	Count              interface{} `json:"count"`
+	Symbol             string          `json:"symbol"`
+	PriceChange        decimal.Decimal `json:"priceChange"`
+	PriceChangePercent string          `json:"priceChangePercent"`
+	PrevClosePrice     decimal.Decimal `json:"prevClosePrice"`
+	LastPrice          decimal.Decimal `json:"lastPrice"`
+	BidPrice           decimal.Decimal `json:"bidPrice"`
+	BidQty             decimal.Decimal `json:"bidQty"`
+	AskPrice           decimal.Decimal `json:"askPrice"`
+	AskQty             decimal.Decimal `json:"askQty"`
+	OpenPrice          decimal.Decimal `json:"openPrice"`
+	HighPrice          decimal.Decimal `json:"highPrice"`
+	LowPrice           decimal.Decimal `json:"lowPrice"`
+	Volume             decimal.Decimal `json:"volume"`
+	QuoteVolume        interface{}     `json:"quoteVolume"`
+	OpenTime           int64           `json:"openTime"`
+	CloseTime          int64           `json:"closeTime"`
+	Count              interface{}     `json:"count"`
 }
 
 type MarketData struct {
@@ -55,30 +61,32 @@ type MarketData struct {
 	ServerTime      int64         `json:"serverTime"`
 	RateLimits      []interface{} `json:"rateLimits"`
 	ExchangeFilters []interface{} `json:"exchangeFilters"`
-	Symbols         []struct {
-		Symbol                     string        `json:"symbol"`
-		Status                     string        `json:"status"`
-		BaseAsset                  string        `json:"baseAsset"`
-		BaseAssetPrecision         int           `json:"baseAssetPrecision"`
-		QuoteAsset                 string        `json:"quoteAsset"`
-		QuotePrecision             int           `json:"quotePrecision"`
-		QuoteAssetPrecision        int           `json:"quoteAssetPrecision"`
-		BaseCommissionPrecision    int           `json:"baseCommissionPrecision"`
-		QuoteCommissionPrecision   int           `json:"quoteCommissionPrecision"`
-		OrderTypes                 []string      `json:"orderTypes"`
-		IsSpotTradingAllowed       bool          `json:"isSpotTradingAllowed"`
-		IsMarginTradingAllowed     bool          `json:"isMarginTradingAllowed"`
-		QuoteAmountPrecision       string        `json:"quoteAmountPrecision"`
-		BaseSizePrecision          string        `json:"baseSizePrecision"`
-		Permissions                []string      `json:"permissions"`
-		Filters                    []interface{} `json:"filters"`
-		MaxQuoteAmount             string        `json:"maxQuoteAmount"`
-		MakerCommission            string        `json:"makerCommission"`
-		TakerCommission            string        `json:"takerCommission"`
-		QuoteAmountPrecisionMarket string        `json:"quoteAmountPrecisionMarket"`
-		MaxQuoteAmountMarket       string        `json:"maxQuoteAmountMarket"`
-		FullName                   string        `json:"fullName"`
-	} `json:"symbols"`
+	Symbols         []SymbolInfo  `json:"symbols"`
+}
+
+type SymbolInfo struct {
+	Symbol                     string        `json:"symbol"`
+	Status                     string        `json:"status"`
+	BaseAsset                  string        `json:"baseAsset"`
+	BaseAssetPrecision         int           `json:"baseAssetPrecision"`
+	QuoteAsset                 string        `json:"quoteAsset"`
+	QuotePrecision             int           `json:"quotePrecision"`
+	QuoteAssetPrecision        int           `json:"quoteAssetPrecision"`
+	BaseCommissionPrecision    int           `json:"baseCommissionPrecision"`
+	QuoteCommissionPrecision   int           `json:"quoteCommissionPrecision"`
+	OrderTypes                 []string      `json:"orderTypes"`
+	IsSpotTradingAllowed       bool          `json:"isSpotTradingAllowed"`
+	IsMarginTradingAllowed     bool          `json:"isMarginTradingAllowed"`
+	QuoteAmountPrecision       string        `json:"quoteAmountPrecision"`
+	BaseSizePrecision          string        `json:"baseSizePrecision"`
+	Permissions                []string      `json:"permissions"`
+	Filters                    []interface{} `json:"filters"`
+	MaxQuoteAmount             string        `json:"maxQuoteAmount"`
+	MakerCommission            string        `json:"makerCommission"`
+	TakerCommission            string        `json:"takerCommission"`
+	QuoteAmountPrecisionMarket string        `json:"quoteAmountPrecisionMarket"`
+	MaxQuoteAmountMarket       string        `json:"maxQuoteAmountMarket"`
+	FullName                   string        `json:"fullName"`
 }
 
 func NewMXCExchange(cfg config.Config) *MEXCExchange {
@@ -105,18 +113,21 @@ func (m *MEXCExchange) sendRequest(method, endpoint string, payload interface{})
 
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, 0, err
+		// a request refused while connecting never reached the exchange
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, 0, err
+		}
+		return nil, 0, fmt.Errorf("%w: %v", errResponseLost, err)
 	}
 
 	defer res.Body.Close()
 
 	responseBody, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return nil, res.StatusCode, err
+		return nil, res.StatusCode, fmt.Errorf("%w: %v", errResponseLost, err)
 	}
 
-	log.Println("The response body", string(responseBody))
-
 	return responseBody, res.StatusCode, nil
 }
 
@@ -134,9 +145,10 @@ func (m *MEXCExchange) generateSignature(payload string) string {
 	return signature
 }
 
-// getServerTime fetches the server time from the specified API endpoint
-func getServerTime() (int64, error) {
-	response, err := http.Get("https://api.mexc.com/api/v3/time")
+// fetchServerTime fetches the server time from the specified API endpoint,
+// an error answer or one without a time is an error rather than the epoch
+func fetchServerTime(timeURL string) (int64, error) {
+	response, err := http.Get(timeURL)
 	if err != nil {
 		return 0, fmt.Errorf("failed to make GET request: %v", err)
 	}
@@ -147,6 +159,10 @@ func getServerTime() (int64, error) {
 		return 0, fmt.Errorf("failed to read response body: %v", err)
 	}
 
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return 0, fmt.Errorf("server time request failed: %w", newMEXCError(response.StatusCode, body))
+	}
+
 	var ServerTime struct {
 		ServerTime int64 `json:"serverTime"`
 	}
@@ -156,13 +172,27 @@ func getServerTime() (int64, error) {
 		return 0, err
 	}
 
+	if ServerTime.ServerTime <= 0 {
+		return 0, fmt.Errorf("server time request failed: no time in %s", string(body))
+	}
+
 	return ServerTime.ServerTime, nil
 }
 
+// timestamp returns the exchange time from the synced clock,
+// it only falls back to asking the server when the clock is not synced yet
+func (m *MEXCExchange) timestamp() (int64, error) {
+	if mexcClock != nil && mexcClock.Synced() {
+		return mexcClock.Timestamp(), nil
+	}
+
+	return fetchServerTime(m.cfg.MEXCBaseURL + "/api/v3/time")
+}
+
 func (m *MEXCExchange) GetMarketData() (MarketData, error) {
 	var result MarketData
 
-	response, err := http.Get("https://api.mexc.com/api/v3/exchangeInfo")
+	response, err := http.Get(m.cfg.MEXCBaseURL + "/api/v3/exchangeInfo")
 	if err != nil {
 		return result, fmt.Errorf("failed to make GET request: %v", err)
 	}
@@ -181,37 +211,92 @@ func (m *MEXCExchange) GetMarketData() (MarketData, error) {
 	return result, nil
 }
 
-func (m *MEXCExchange) Buy(symbol string, quoteOrderQty int) (NewMEXCOrderResponse, error) {
-	var result NewMEXCOrderResponse
-
-	payload := map[string]interface{}{}
+func (m *MEXCExchange) Name() string {
+	return VenueMEXC
+}
 
+// signedRequest adds the timestamp and the signature to the query params and sends the request
+func (m *MEXCExchange) signedRequest(method, endpoint string, params url.Values) ([]byte, int, error) {
 	// Generate timestamp
-	timestamp, err := getServerTime()
+	timestamp, err := m.timestamp()
 	if err != nil {
-		return result, fmt.Errorf("buy market request failed: %v", err)
+		return nil, 0, err
 	}
 
-	// Construct the payload
-	params := fmt.Sprintf("symbol=%s&side=BUY&type=MARKET&quoteOrderQty=%d&timestamp=%d&recvWindow=5000", symbol, quoteOrderQty, timestamp)
+	params.Set("timestamp", strconv.FormatInt(timestamp, 10))
+	params.Set("recvWindow", "5000")
+	query := params.Encode()
 
 	// Generate signature
-	signature := m.generateSignature(params)
+	signature := m.generateSignature(query)
 
 	// Construct the URL with the timestamp and signature
-	url := fmt.Sprintf("%s?%s&signature=%s",
-		m.cfg.MEXCOrderURL, params, signature)
+	requestURL := fmt.Sprintf("%s?%s&signature=%s", endpoint, query, signature)
+
+	return m.sendRequest(method, requestURL, map[string]interface{}{})
+}
+
+func (m *MEXCExchange) symbolRules() *SymbolRulesCache {
+	mexcSymbolRulesOnce.Do(func() {
+		mexcSymbolRules = NewSymbolRulesCache(time.Duration(m.cfg.MEXCSymbolRulesTTLSeconds)*time.Second, m.GetMarketData)
+	})
+	return mexcSymbolRules
+}
+
+// GetSymbolRules returns the cached trading rules of the symbol
+func (m *MEXCExchange) GetSymbolRules(symbol string) (SymbolRules, bool, error) {
+	return m.symbolRules().Get(symbol)
+}
+
+// applySymbolRules rounds the request to the symbol step sizes and checks its notional before it is sent
+func (m *MEXCExchange) applySymbolRules(request OrderRequest) (OrderRequest, error) {
+	rules, found, err := m.symbolRules().Get(request.Symbol)
+	if err != nil {
+		logger.Error(context.Background(), "error loading symbol rules", zap.String("symbol", request.Symbol), zap.Error(err))
+	}
+
+	// a symbol that is not in exchangeInfo yet cannot be checked, the exchange will do it
+	if !found {
+		return request, nil
+	}
+
+	return rules.Apply(request)
+}
+
+func (m *MEXCExchange) PlaceMarketOrder(request OrderRequest) (OrderResponse, error) {
+	var result OrderResponse
 
-	response, statusCode, err := m.sendRequest("POST", url, payload)
+	request, err := m.applySymbolRules(request)
 	if err != nil {
-		return result, fmt.Errorf("buy market request failed: %v", err)
+		return result, err
+	}
+
+	params := url.Values{}
+	params.Set("symbol", request.Symbol)
+	params.Set("side", string(request.Side))
+	params.Set("type", string(OrderTypeMarket))
+	if request.Side == OrderSideBuy && request.QuoteOrderQty.Sign() > 0 {
+		params.Set("quoteOrderQty", request.QuoteOrderQty.String())
+	} else {
+		params.Set("quantity", request.Quantity.String())
+	}
+	if request.ClientOrderID != "" {
+		params.Set("newClientOrderId", request.ClientOrderID)
+	}
+
+	response, statusCode, err := m.signedRequest("POST", m.cfg.MEXCOrderURL, params)
+	if errors.Is(err, errResponseLost) {
+		// the request reached the exchange, the order may have been placed
+		return result, fmt.Errorf("%s market request failed: %w: %v", request.Side, ErrOrderStateUnknown, err)
+	}
+	if err != nil {
+		return result, fmt.Errorf("%s market request failed: %v", request.Side, err)
 	}
 
 	if statusCode != http.StatusOK {
-		return result, fmt.Errorf("buy market request failed with status code: %d", statusCode)
+		return result, fmt.Errorf("%s market request failed: %w", request.Side, newMEXCError(statusCode, response))
 	}
 
-	// Check if "data" key exists and is a map
 	err = json.Unmarshal(response, &result)
 	if err != nil {
 		log.Println("error unmarshalling response")
@@ -221,37 +306,42 @@ func (m *MEXCExchange) Buy(symbol string, quoteOrderQty int) (NewMEXCOrderRespon
 	return result, nil
 }
 
-func (m *MEXCExchange) Sell(symbol string, quantity float64) (NewMEXCOrderResponse, error) {
-	var result NewMEXCOrderResponse
-
-	payload := map[string]interface{}{}
+func (m *MEXCExchange) PlaceLimitOrder(request OrderRequest) (OrderResponse, error) {
+	var result OrderResponse
 
-	// Generate timestamp
-	timestamp, err := getServerTime()
+	request, err := m.applySymbolRules(request)
 	if err != nil {
-		return result, fmt.Errorf("buy market request failed: %v", err)
+		return result, err
 	}
 
-	params := fmt.Sprintf("%s?symbol=%s&side=SELL&type=MARKET&quantity=%f&timestamp=%d&%d&recvWindow=5000",
-		m.cfg.MEXCOrderURL, symbol, quantity, timestamp)
-
-	// Generate signature
-	signature := m.generateSignature(params)
-
-	// Construct the URL with the timestamp and signature
-	url := fmt.Sprintf("%s?%s&signature=%s",
-		m.cfg.MEXCOrderURL, params, signature)
+	params := url.Values{}
+	params.Set("symbol", request.Symbol)
+	params.Set("side", string(request.Side))
+	// immediate or cancel and fill or kill are limit orders with a different time in force
+	orderType := request.Type
+	if orderType != OrderTypeImmediateOrCancel && orderType != OrderTypeFillOrKill {
+		orderType = OrderTypeLimit
+	}
+	params.Set("type", string(orderType))
+	params.Set("quantity", request.Quantity.String())
+	params.Set("price", request.Price.String())
+	if request.ClientOrderID != "" {
+		params.Set("newClientOrderId", request.ClientOrderID)
+	}
 
-	response, statusCode, err := m.sendRequest("POST", url, payload)
+	response, statusCode, err := m.signedRequest("POST", m.cfg.MEXCOrderURL, params)
+	if errors.Is(err, errResponseLost) {
+		// the request reached the exchange, the order may have been placed
+		return result, fmt.Errorf("%s limit request failed: %w: %v", request.Side, ErrOrderStateUnknown, err)
+	}
 	if err != nil {
-		return result, fmt.Errorf("buy market request failed: %v", err)
+		return result, fmt.Errorf("%s limit request failed: %v", request.Side, err)
 	}
 
 	if statusCode != http.StatusOK {
-		return result, fmt.Errorf("buy market request failed with status code: %d", statusCode)
+		return result, fmt.Errorf("%s limit request failed: %w", request.Side, newMEXCError(statusCode, response))
 	}
 
-	// Check if "data" key exists and is a map
 	err = json.Unmarshal(response, &result)
 	if err != nil {
 		log.Println("error unmarshalling response")
@@ -261,6 +351,36 @@ func (m *MEXCExchange) Sell(symbol string, quantity float64) (NewMEXCOrderRespon
 	return result, nil
 }
 
+func (m *MEXCExchange) GetTicker(symbol string) (Ticker, error) {
+	marketPrice, err := m.GetMarketPrice(symbol)
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	return Ticker{
+		Symbol:    marketPrice.Symbol,
+		LastPrice: marketPrice.LastPrice,
+		BidPrice:  marketPrice.BidPrice,
+		AskPrice:  marketPrice.AskPrice,
+		HighPrice: marketPrice.HighPrice,
+		LowPrice:  marketPrice.LowPrice,
+		Volume:    marketPrice.Volume,
+	}, nil
+}
+
+// GetSymbolInfo returns the symbol out of the cached exchangeInfo shared with the symbol rules
+func (m *MEXCExchange) GetSymbolInfo(symbol string) (SymbolInfo, error) {
+	symbolInfo, found, err := m.symbolRules().Info(symbol)
+	if found {
+		return symbolInfo, nil
+	}
+	if err != nil {
+		return SymbolInfo{}, err
+	}
+
+	return SymbolInfo{}, fmt.Errorf("symbol %s not found on %s", symbol, VenueMEXC)
+}
+
 func (m *MEXCExchange) GetMarketPrice(symbol string) (MEXCMarketPriceResponse, error) {
 	var result MEXCMarketPriceResponse
 
@@ -271,7 +391,7 @@ func (m *MEXCExchange) GetMarketPrice(symbol string) (MEXCMarketPriceResponse, e
 	}
 
 	if statusCode != http.StatusOK {
-		return result, fmt.Errorf("GetMarketPrice request failed with status code: %d", statusCode)
+		return result, fmt.Errorf("GetMarketPrice request failed: %w", newMEXCError(statusCode, response))
 	}
 
 	// Check if "data" key exists and is a map
@@ -0,0 +1,112 @@
+package exchange
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MEXCError is the error body MEXC answers with, like {"code":10007,"msg":"symbol not support api"}
+type MEXCError struct {
+	StatusCode int    `json:"-"`
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+}
+
+func (e *MEXCError) Error() string {
+	return fmt.Sprintf("mexc error %d: %s (status code %d)", e.Code, e.Msg, e.StatusCode)
+}
+
+// Category returns the category of the error from the catalog
+func (e *MEXCError) Category() ErrorCategory {
+	if category, ok := mexcErrorCategories[e.Code]; ok {
+		return category
+	}
+
+	switch {
+	// the ticker of a symbol without any trade yet
+	case strings.Contains(e.Msg, "last price is null"):
+		return ErrorCategoryNotListed
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrorCategoryRateLimited
+	}
+
+	return ErrorCategoryUnknown
+}
+
+type ErrorCategory string
+
+const (
+	ErrorCategoryUnknown              ErrorCategory = "unknown"
+	ErrorCategoryNotListed            ErrorCategory = "not_listed"
+	ErrorCategorySymbolNotAPITradable ErrorCategory = "symbol_not_api_tradable"
+	ErrorCategoryOrderTypeDisabled    ErrorCategory = "order_type_disabled"
+	ErrorCategoryInsufficientBalance  ErrorCategory = "insufficient_balance"
+	ErrorCategoryRateLimited          ErrorCategory = "rate_limited"
+	ErrorCategorySignature            ErrorCategory = "signature"
+	ErrorCategoryOrderRejected        ErrorCategory = "order_rejected"
+	ErrorCategoryOrderNotFound        ErrorCategory = "order_not_found"
+)
+
+// mexcErrorCategories maps the known MEXC error codes to their category
+var mexcErrorCategories = map[int]ErrorCategory{
+	10007:  ErrorCategorySymbolNotAPITradable, // symbol not support api
+	30014:  ErrorCategoryNotListed,            // invalid symbol, not in the exchange yet
+	30016:  ErrorCategoryNotListed,            // trading disabled, not open yet
+	30010:  ErrorCategoryNotListed,            // no valid trade price
+	30018:  ErrorCategoryOrderTypeDisabled,    // market order is disabled
+	30019:  ErrorCategoryOrderTypeDisabled,    // api market order is disabled
+	30041:  ErrorCategoryOrderTypeDisabled,    // current order type can not place order
+	10101:  ErrorCategoryInsufficientBalance,  // insufficient balance
+	30004:  ErrorCategoryInsufficientBalance,  // insufficient position
+	30005:  ErrorCategoryInsufficientBalance,  // oversold
+	429:    ErrorCategoryRateLimited,          // too many requests
+	510:    ErrorCategoryRateLimited,          // excessive frequency
+	700001: ErrorCategorySignature,            // api key format invalid
+	700002: ErrorCategorySignature,            // signature for this request is not valid
+	700003: ErrorCategorySignature,            // timestamp outside of the recvWindow
+	30002:  ErrorCategoryOrderRejected,        // minimum transaction volume
+	30003:  ErrorCategoryOrderRejected,        // maximum transaction volume
+	30029:  ErrorCategoryOrderRejected,        // maximum order limit
+	-2013:  ErrorCategoryOrderNotFound,        // order does not exist
+}
+
+// newMEXCError builds the error of a non 2xx answer, the raw body is kept when it is not the usual json
+func newMEXCError(statusCode int, body []byte) error {
+	mexcError := &MEXCError{StatusCode: statusCode}
+
+	if err := json.Unmarshal(body, mexcError); err != nil || (mexcError.Code == 0 && mexcError.Msg == "") {
+		mexcError.Msg = string(body)
+	}
+
+	// a signature refused because of the timestamp usually means the clock drifted
+	if mexcError.Code == 700003 && mexcClock != nil {
+		go mexcClock.Sync()
+	}
+
+	return mexcError
+}
+
+// ClassifyError returns the category of an exchange error
+func ClassifyError(err error) ErrorCategory {
+	var mexcError *MEXCError
+	if errors.As(err, &mexcError) {
+		return mexcError.Category()
+	}
+
+	return ErrorCategoryUnknown
+}
+
+// IsNotListedYet reports whether the error only means the symbol cannot be traded yet,
+// which is the one error worth hammering on around a listing
+func IsNotListedYet(err error) bool {
+	return ClassifyError(err) == ErrorCategoryNotListed
+}
+
+// IsOrderNotFound reports whether the venue answered that the order does not exist,
+// as opposed to not answering at all
+func IsOrderNotFound(err error) bool {
+	return errors.Is(err, ErrOrderNotFound) || ClassifyError(err) == ErrorCategoryOrderNotFound
+}
@@ -0,0 +1,170 @@
+package exchange
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMEXCErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		code      int
+		msg       string
+		category  ErrorCategory
+		notListed bool
+	}{
+		{
+			name:     "symbol not tradable through the api",
+			status:   http.StatusBadRequest,
+			body:     `{"code":10007,"msg":"symbol not support api"}`,
+			code:     10007,
+			msg:      "symbol not support api",
+			category: ErrorCategorySymbolNotAPITradable,
+		},
+		{
+			name:      "symbol not listed yet",
+			status:    http.StatusBadRequest,
+			body:      `{"code":30014,"msg":"Invalid symbol."}`,
+			code:      30014,
+			msg:       "Invalid symbol.",
+			category:  ErrorCategoryNotListed,
+			notListed: true,
+		},
+		{
+			name:      "no trade yet",
+			status:    http.StatusBadRequest,
+			body:      `{"code":30010,"msg":"no valid trade price"}`,
+			code:      30010,
+			msg:       "no valid trade price",
+			category:  ErrorCategoryNotListed,
+			notListed: true,
+		},
+		{
+			name:      "ticker without a last price",
+			status:    http.StatusBadRequest,
+			body:      `{"code":-1,"msg":"last price is null"}`,
+			code:      -1,
+			msg:       "last price is null",
+			category:  ErrorCategoryNotListed,
+			notListed: true,
+		},
+		{
+			name:     "market orders disabled",
+			status:   http.StatusBadRequest,
+			body:     `{"code":30018,"msg":"market order is disabled"}`,
+			code:     30018,
+			msg:      "market order is disabled",
+			category: ErrorCategoryOrderTypeDisabled,
+		},
+		{
+			name:     "insufficient position",
+			status:   http.StatusBadRequest,
+			body:     `{"code":30004,"msg":"Insufficient position"}`,
+			code:     30004,
+			msg:      "Insufficient position",
+			category: ErrorCategoryInsufficientBalance,
+		},
+		{
+			name:     "bad signature",
+			status:   http.StatusBadRequest,
+			body:     `{"code":700002,"msg":"Signature for this request is not valid."}`,
+			code:     700002,
+			msg:      "Signature for this request is not valid.",
+			category: ErrorCategorySignature,
+		},
+		{
+			name:     "unknown order",
+			status:   http.StatusBadRequest,
+			body:     `{"code":-2013,"msg":"Order does not exist."}`,
+			code:     -2013,
+			msg:      "Order does not exist.",
+			category: ErrorCategoryOrderNotFound,
+		},
+		{
+			name:     "rate limited without a json body",
+			status:   http.StatusTooManyRequests,
+			body:     `<html><body>Too Many Requests</body></html>`,
+			msg:      `<html><body>Too Many Requests</body></html>`,
+			category: ErrorCategoryRateLimited,
+		},
+		{
+			name:     "gateway error",
+			status:   http.StatusBadGateway,
+			body:     ``,
+			category: ErrorCategoryUnknown,
+		},
+		{
+			name:     "code not in the catalog",
+			status:   http.StatusBadRequest,
+			body:     `{"code":-1121,"msg":"Invalid symbol."}`,
+			code:     -1121,
+			msg:      "Invalid symbol.",
+			category: ErrorCategoryUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newMEXCError(test.status, []byte(test.body))
+
+			mexcError, ok := err.(*MEXCError)
+			if !ok {
+				t.Fatalf("error is a %T, want a *MEXCError", err)
+			}
+			if mexcError.StatusCode != test.status || mexcError.Code != test.code || mexcError.Msg != test.msg {
+				t.Errorf("error = %+v, want status %d code %d msg %q", mexcError, test.status, test.code, test.msg)
+			}
+
+			// the callers wrap the error with the request that failed
+			wrapped := fmt.Errorf("BUY market request failed: %w", err)
+			if category := ClassifyError(wrapped); category != test.category {
+				t.Errorf("category = %s, want %s", category, test.category)
+			}
+			if notListed := IsNotListedYet(wrapped); notListed != test.notListed {
+				t.Errorf("not listed yet = %v, want %v", notListed, test.notListed)
+			}
+			if notFound, want := IsOrderNotFound(wrapped), test.category == ErrorCategoryOrderNotFound; notFound != want {
+				t.Errorf("order not found = %v, want %v", notFound, want)
+			}
+		})
+	}
+
+	if ClassifyError(fmt.Errorf("dial tcp: i/o timeout")) != ErrorCategoryUnknown {
+		t.Error("a transport error is classified")
+	}
+}
+
+func TestMEXCTimestampErrorResyncsTheClock(t *testing.T) {
+	synced := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli())
+		select {
+		case synced <- struct{}{}:
+		default:
+		}
+	}))
+	defer server.Close()
+
+	previous := mexcClock
+	mexcClock = NewClockSync(server.URL, 0, 1)
+	defer func() { mexcClock = previous }()
+
+	newMEXCError(http.StatusBadRequest, []byte(`{"code":700002,"msg":"Signature for this request is not valid."}`))
+	select {
+	case <-synced:
+		t.Fatal("the clock was synced on a bad signature")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	newMEXCError(http.StatusBadRequest, []byte(`{"code":700003,"msg":"Timestamp for this request is outside of the recvWindow."}`))
+	select {
+	case <-synced:
+	case <-time.After(time.Second):
+		t.Fatal("the clock was not synced on a timestamp error")
+	}
+}
@@ -0,0 +1,126 @@
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+type MEXCAccount struct {
+	MakerCommission int       `json:"makerCommission"`
+	TakerCommission int       `json:"takerCommission"`
+	BuyerCommission int       `json:"buyerCommission"`
+	CanTrade        bool      `json:"canTrade"`
+	CanWithdraw     bool      `json:"canWithdraw"`
+	CanDeposit      bool      `json:"canDeposit"`
+	UpdateTime      int64     `json:"updateTime"`
+	AccountType     string    `json:"accountType"`
+	Balances        []Balance `json:"balances"`
+	Permissions     []string  `json:"permissions"`
+}
+
+// signedCall sends a signed request and decodes the answer into result
+func (m *MEXCExchange) signedCall(name, method, endpoint string, params url.Values, result interface{}) error {
+	response, statusCode, err := m.signedRequest(method, endpoint, params)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %v", name, err)
+	}
+
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("%s request failed: %w", name, newMEXCError(statusCode, response))
+	}
+
+	err = json.Unmarshal(response, result)
+	if err != nil {
+		log.Println("error unmarshalling response")
+		return err
+	}
+
+	return nil
+}
+
+func (m *MEXCExchange) CancelOrder(symbol string, orderID string) (OrderResponse, error) {
+	var result OrderResponse
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("orderId", orderID)
+
+	err := m.signedCall("CancelOrder", "DELETE", m.cfg.MEXCOrderURL, params, &result)
+	return result, err
+}
+
+// CancelAllOpenOrders cancels every open order of the symbol and returns the cancelled ones
+func (m *MEXCExchange) CancelAllOpenOrders(symbol string) ([]OrderResponse, error) {
+	var result []OrderResponse
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+
+	err := m.signedCall("CancelAllOpenOrders", "DELETE", m.cfg.MEXCBaseURL+"/api/v3/openOrders", params, &result)
+	return result, err
+}
+
+func (m *MEXCExchange) GetOrder(symbol string, orderID string) (OrderResponse, error) {
+	var result OrderResponse
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("orderId", orderID)
+
+	err := m.signedCall("GetOrder", "GET", m.cfg.MEXCOrderURL, params, &result)
+	return result, err
+}
+
+func (m *MEXCExchange) GetOrderByClientID(symbol string, clientOrderID string) (OrderResponse, error) {
+	var result OrderResponse
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	params.Set("origClientOrderId", clientOrderID)
+
+	err := m.signedCall("GetOrderByClientID", "GET", m.cfg.MEXCOrderURL, params, &result)
+	return result, err
+}
+
+func (m *MEXCExchange) GetOpenOrders(symbol string) ([]OrderResponse, error) {
+	var result []OrderResponse
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+
+	err := m.signedCall("GetOpenOrders", "GET", m.cfg.MEXCBaseURL+"/api/v3/openOrders", params, &result)
+	return result, err
+}
+
+// GetMyTrades returns the executions of the account on the symbol, only the ones of the order when orderID is set
+func (m *MEXCExchange) GetMyTrades(symbol string, orderID string) ([]Trade, error) {
+	var result []Trade
+
+	params := url.Values{}
+	params.Set("symbol", symbol)
+	if orderID != "" {
+		params.Set("orderId", orderID)
+	}
+
+	err := m.signedCall("GetMyTrades", "GET", m.cfg.MEXCBaseURL+"/api/v3/myTrades", params, &result)
+	return result, err
+}
+
+func (m *MEXCExchange) GetAccount() (MEXCAccount, error) {
+	var result MEXCAccount
+
+	err := m.signedCall("GetAccount", "GET", m.cfg.MEXCBaseURL+"/api/v3/account", url.Values{}, &result)
+	return result, err
+}
+
+func (m *MEXCExchange) GetBalances() ([]Balance, error) {
+	account, err := m.GetAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	return account.Balances, nil
+}
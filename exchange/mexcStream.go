@@ -0,0 +1,438 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"NewListingBot/logger"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mexcDealsChannel      = "spot@public.deals.v3.api@"
+	mexcBookTickerChannel = "spot@public.bookTicker.v3.api@"
+	mexcDepthChannel      = "spot@public.limit.depth.v3.api@"
+	mexcDepthLevels       = 5
+
+	// MEXC closes connections without any message for a minute
+	mexcPingInterval   = 20 * time.Second
+	mexcMaxReconnectIn = 30 * time.Second
+	// a connection up for that long was healthy, its drop reconnects without waiting long
+	mexcStableAfter = time.Minute
+)
+
+type Deal struct {
+	Symbol   string          `json:"symbol"`
+	Price    decimal.Decimal `json:"price"`
+	Quantity decimal.Decimal `json:"quantity"`
+	Side     OrderSide       `json:"side"`
+	Time     time.Time       `json:"time"`
+}
+
+type BookTicker struct {
+	Symbol    string          `json:"symbol"`
+	BidPrice  decimal.Decimal `json:"bid_price"`
+	BidQty    decimal.Decimal `json:"bid_qty"`
+	AskPrice  decimal.Decimal `json:"ask_price"`
+	AskQty    decimal.Decimal `json:"ask_qty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type DepthLevel struct {
+	Price    string `json:"p"`
+	Quantity string `json:"v"`
+}
+
+type Depth struct {
+	Symbol    string       `json:"symbol"`
+	Bids      []DepthLevel `json:"bids"`
+	Asks      []DepthLevel `json:"asks"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// MarketCache is the local copy of the last deals and books received on the streams
+type MarketCache struct {
+	mu          sync.RWMutex
+	lastDeals   map[string]Deal
+	firstDeals  map[string]Deal
+	firstTrades map[string]chan struct{}
+	books       map[string]BookTicker
+	depths      map[string]Depth
+	handlers    []func(Deal)
+}
+
+func NewMarketCache() *MarketCache {
+	return &MarketCache{
+		lastDeals:   map[string]Deal{},
+		firstDeals:  map[string]Deal{},
+		firstTrades: map[string]chan struct{}{},
+		books:       map[string]BookTicker{},
+		depths:      map[string]Depth{},
+	}
+}
+
+// LastDeal returns the last deal of the symbol when it is not older than maxAge
+func (c *MarketCache) LastDeal(symbol string, maxAge time.Duration) (Deal, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	deal, ok := c.lastDeals[symbol]
+	if !ok || time.Since(deal.Time) > maxAge {
+		return Deal{}, false
+	}
+	return deal, true
+}
+
+// FirstDeal returns the first deal seen on the symbol since it was watched
+func (c *MarketCache) FirstDeal(symbol string) (Deal, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	deal, ok := c.firstDeals[symbol]
+	return deal, ok
+}
+
+// FirstTrade returns a channel closed once the first deal of the symbol is seen
+func (c *MarketCache) FirstTrade(symbol string) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.firstTradeChannel(symbol)
+}
+
+// BookTicker returns the best bid and ask of the symbol when they are not older than maxAge
+func (c *MarketCache) BookTicker(symbol string, maxAge time.Duration) (BookTicker, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	book, ok := c.books[symbol]
+	if !ok || time.Since(book.UpdatedAt) > maxAge {
+		return BookTicker{}, false
+	}
+	return book, true
+}
+
+func (c *MarketCache) Depth(symbol string) (Depth, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	depth, ok := c.depths[symbol]
+	return depth, ok
+}
+
+// OnDeal calls the handler with every deal received, it must not block the stream
+func (c *MarketCache) OnDeal(handler func(Deal)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handlers = append(c.handlers, handler)
+}
+
+// firstTradeChannel must be called with the write lock held
+func (c *MarketCache) firstTradeChannel(symbol string) chan struct{} {
+	channel, ok := c.firstTrades[symbol]
+	if !ok {
+		channel = make(chan struct{})
+		c.firstTrades[symbol] = channel
+	}
+	return channel
+}
+
+func (c *MarketCache) addDeal(deal Deal) {
+	c.mu.Lock()
+
+	if _, seen := c.firstDeals[deal.Symbol]; !seen {
+		c.firstDeals[deal.Symbol] = deal
+		close(c.firstTradeChannel(deal.Symbol))
+	}
+
+	if last, ok := c.lastDeals[deal.Symbol]; !ok || !deal.Time.Before(last.Time) {
+		c.lastDeals[deal.Symbol] = deal
+	}
+
+	handlers := c.handlers
+	c.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(deal)
+	}
+}
+
+func (c *MarketCache) setBook(book BookTicker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.books[book.Symbol] = book
+}
+
+func (c *MarketCache) setDepth(depth Depth) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.depths[depth.Symbol] = depth
+}
+
+// MEXCStream keeps a connection to the MEXC public streams, reconnecting and subscribing again when it drops
+type MEXCStream struct {
+	url   string
+	cache *MarketCache
+
+	mu            sync.Mutex
+	conn          *websocket.Conn
+	subscriptions map[string]bool
+}
+
+var mexcMarketStream *MEXCStream
+
+func NewMEXCStream(url string) *MEXCStream {
+	return &MEXCStream{
+		url:           url,
+		cache:         NewMarketCache(),
+		subscriptions: map[string]bool{},
+	}
+}
+
+// StartMEXCMarketStream connects the shared MEXC market stream in the background
+func StartMEXCMarketStream(ctx context.Context, cfg config.Config) *MEXCStream {
+	mexcMarketStream = NewMEXCStream(cfg.MEXCWebSocketURL)
+	go mexcMarketStream.Start(ctx)
+
+	return mexcMarketStream
+}
+
+// MEXCMarketStream returns the running MEXC market stream, nil when it was not started
+func MEXCMarketStream() *MEXCStream {
+	return mexcMarketStream
+}
+
+func (s *MEXCStream) Cache() *MarketCache {
+	return s.cache
+}
+
+// WatchSymbol subscribes to the deals, book ticker and depth of the symbol
+func (s *MEXCStream) WatchSymbol(symbol string) {
+	s.subscribe(
+		mexcDealsChannel+symbol,
+		mexcBookTickerChannel+symbol,
+		fmt.Sprintf("%s%s@%d", mexcDepthChannel, symbol, mexcDepthLevels),
+	)
+}
+
+// UnwatchSymbol stops the streams of the symbol
+func (s *MEXCStream) UnwatchSymbol(symbol string) {
+	channels := []string{
+		mexcDealsChannel + symbol,
+		mexcBookTickerChannel + symbol,
+		fmt.Sprintf("%s%s@%d", mexcDepthChannel, symbol, mexcDepthLevels),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, channel := range channels {
+		delete(s.subscriptions, channel)
+	}
+	s.send(map[string]interface{}{"method": "UNSUBSCRIPTION", "params": channels})
+}
+
+func (s *MEXCStream) subscribe(channels ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added []string
+	for _, channel := range channels {
+		if !s.subscriptions[channel] {
+			s.subscriptions[channel] = true
+			added = append(added, channel)
+		}
+	}
+
+	// without a connection the subscriptions are sent once connected
+	if len(added) > 0 {
+		s.send(map[string]interface{}{"method": "SUBSCRIPTION", "params": added})
+	}
+}
+
+// send must be called with the lock held, it also serializes the writes on the connection
+func (s *MEXCStream) send(message interface{}) {
+	if s.conn == nil {
+		return
+	}
+
+	if err := s.conn.WriteJSON(message); err != nil {
+		logger.Error(context.Background(), "error writing on mexc stream", zap.Error(err))
+	}
+}
+
+// Start keeps the stream connected until the context is done
+func (s *MEXCStream) Start(ctx context.Context) {
+	var wait time.Duration
+
+	for {
+		connected := time.Now()
+		err := s.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		wait = reconnectWait(wait, time.Since(connected))
+		logger.Error(ctx, "mexc stream disconnected", zap.Error(err), zap.Duration("reconnect_in", wait))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// reconnectWait returns how long to wait before reconnecting, twice the last wait up to the max
+// or a second again when the connection was up long enough to be healthy
+func reconnectWait(last time.Duration, up time.Duration) time.Duration {
+	if last == 0 || up >= mexcStableAfter {
+		return time.Second
+	}
+
+	wait := last * 2
+	if wait > mexcMaxReconnectIn {
+		wait = mexcMaxReconnectIn
+	}
+	return wait
+}
+
+// run connects, subscribes again to every channel and reads until the connection drops
+func (s *MEXCStream) run(ctx context.Context) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, s.url, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.conn = conn
+	var channels []string
+	for channel := range s.subscriptions {
+		channels = append(channels, channel)
+	}
+	if len(channels) > 0 {
+		s.send(map[string]interface{}{"method": "SUBSCRIPTION", "params": channels})
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.ping(ctx, conn, done)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		s.handle(message)
+	}
+}
+
+func (s *MEXCStream) ping(ctx context.Context, conn *websocket.Conn, done chan struct{}) {
+	ticker := time.NewTicker(mexcPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			// unblocks the read loop
+			conn.Close()
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.send(map[string]string{"method": "PING"})
+			s.mu.Unlock()
+		}
+	}
+}
+
+type mexcStreamMessage struct {
+	Channel string          `json:"c"`
+	Symbol  string          `json:"s"`
+	Time    int64           `json:"t"`
+	Data    json.RawMessage `json:"d"`
+}
+
+func (s *MEXCStream) handle(message []byte) {
+	var streamMessage mexcStreamMessage
+	if err := json.Unmarshal(message, &streamMessage); err != nil || streamMessage.Channel == "" {
+		// subscription acks and pongs
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(streamMessage.Channel, mexcDealsChannel):
+		var data struct {
+			Deals []struct {
+				Side     int             `json:"S"`
+				Price    decimal.Decimal `json:"p"`
+				Quantity decimal.Decimal `json:"v"`
+				Time     int64           `json:"t"`
+			} `json:"deals"`
+		}
+		if json.Unmarshal(streamMessage.Data, &data) != nil {
+			return
+		}
+
+		for _, deal := range data.Deals {
+			side := OrderSideBuy
+			if deal.Side == 2 {
+				side = OrderSideSell
+			}
+			s.cache.addDeal(Deal{
+				Symbol:   streamMessage.Symbol,
+				Price:    deal.Price,
+				Quantity: deal.Quantity,
+				Side:     side,
+				Time:     time.UnixMilli(deal.Time),
+			})
+		}
+
+	case strings.HasPrefix(streamMessage.Channel, mexcBookTickerChannel):
+		var data struct {
+			AskQty   decimal.Decimal `json:"A"`
+			BidQty   decimal.Decimal `json:"B"`
+			AskPrice decimal.Decimal `json:"a"`
+			BidPrice decimal.Decimal `json:"b"`
+		}
+		if json.Unmarshal(streamMessage.Data, &data) != nil {
+			return
+		}
+
+		s.cache.setBook(BookTicker{
+			Symbol:    streamMessage.Symbol,
+			BidPrice:  data.BidPrice,
+			BidQty:    data.BidQty,
+			AskPrice:  data.AskPrice,
+			AskQty:    data.AskQty,
+			UpdatedAt: time.Now(),
+		})
+
+	case strings.HasPrefix(streamMessage.Channel, mexcDepthChannel):
+		var depth Depth
+		if json.Unmarshal(streamMessage.Data, &depth) != nil {
+			return
+		}
+
+		depth.Symbol = streamMessage.Symbol
+		depth.UpdatedAt = time.Now()
+		s.cache.setDepth(depth)
+	}
+}
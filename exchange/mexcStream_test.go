@@ -0,0 +1,28 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectWait(t *testing.T) {
+	tests := []struct {
+		name string
+		last time.Duration
+		up   time.Duration
+		want time.Duration
+	}{
+		{name: "first drop", last: 0, up: time.Second, want: time.Second},
+		{name: "dropped again right away", last: 4 * time.Second, up: time.Second, want: 8 * time.Second},
+		{name: "capped", last: 20 * time.Second, up: time.Second, want: mexcMaxReconnectIn},
+		{name: "stable connection", last: mexcMaxReconnectIn, up: 2 * mexcStableAfter, want: time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if wait := reconnectWait(test.last, test.up); wait != test.want {
+				t.Errorf("wait = %v, want %v", wait, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"NewListingBot/logger"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"net/url"
+	"time"
+)
+
+const (
+	mexcPrivateOrdersChannel  = "spot@private.orders.v3.api"
+	mexcPrivateDealsChannel   = "spot@private.deals.v3.api"
+	mexcPrivateAccountChannel = "spot@private.account.v3.api"
+
+	// a listen key expires after an hour without keepalive
+	mexcListenKeyKeepAlive = 30 * time.Minute
+)
+
+// mexcOrderStatuses maps the numeric statuses of the private order stream to the REST ones
+var mexcOrderStatuses = map[string]string{
+	"1": "NEW",
+	"2": "FILLED",
+	"3": "PARTIALLY_FILLED",
+	"4": "CANCELED",
+	"5": "PARTIALLY_CANCELED",
+}
+
+// streamValue reads the values MEXC sends either as json strings or numbers
+type streamValue string
+
+func (v *streamValue) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*v = ""
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		*v = streamValue(value)
+		return nil
+	}
+
+	*v = streamValue(data)
+	return nil
+}
+
+func (m *MEXCExchange) CreateListenKey() (string, error) {
+	var result struct {
+		ListenKey string `json:"listenKey"`
+	}
+
+	err := m.signedCall("CreateListenKey", "POST", m.cfg.MEXCBaseURL+"/api/v3/userDataStream", url.Values{}, &result)
+	return result.ListenKey, err
+}
+
+func (m *MEXCExchange) KeepAliveListenKey(listenKey string) error {
+	var result struct {
+		ListenKey string `json:"listenKey"`
+	}
+
+	params := url.Values{}
+	params.Set("listenKey", listenKey)
+
+	return m.signedCall("KeepAliveListenKey", "PUT", m.cfg.MEXCBaseURL+"/api/v3/userDataStream", params, &result)
+}
+
+func (m *MEXCExchange) CloseListenKey(listenKey string) error {
+	var result struct {
+		ListenKey string `json:"listenKey"`
+	}
+
+	params := url.Values{}
+	params.Set("listenKey", listenKey)
+
+	return m.signedCall("CloseListenKey", "DELETE", m.cfg.MEXCBaseURL+"/api/v3/userDataStream", params, &result)
+}
+
+// MEXCUserStream follows our orders, fills and balances on the MEXC private streams
+// and publishes them on the event bus
+type MEXCUserStream struct {
+	mexc *MEXCExchange
+	url  string
+	bus  *EventBus
+}
+
+func NewMEXCUserStream(cfg config.Config, bus *EventBus) *MEXCUserStream {
+	return &MEXCUserStream{
+		mexc: NewMXCExchange(cfg),
+		url:  cfg.MEXCWebSocketURL,
+		bus:  bus,
+	}
+}
+
+// StartMEXCUserStream follows the MEXC account in the background, it does nothing without api keys
+func StartMEXCUserStream(ctx context.Context, cfg config.Config) *MEXCUserStream {
+	if cfg.MEXCExchangeAPIKey == "" {
+		return nil
+	}
+
+	stream := NewMEXCUserStream(cfg, Events)
+	go stream.Start(ctx)
+
+	return stream
+}
+
+// Start keeps the stream connected with a fresh listen key until the context is done
+func (s *MEXCUserStream) Start(ctx context.Context) {
+	var wait time.Duration
+
+	for {
+		connected := time.Now()
+		err := s.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		wait = reconnectWait(wait, time.Since(connected))
+		logger.Error(ctx, "mexc user stream disconnected", zap.Error(err), zap.Duration("reconnect_in", wait))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (s *MEXCUserStream) run(ctx context.Context) error {
+	listenKey, err := s.mexc.CreateListenKey()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := s.mexc.CloseListenKey(listenKey); err != nil {
+			logger.Error(context.Background(), "error closing mexc listen key", zap.Error(err))
+		}
+	}()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, s.url+"?listenKey="+listenKey, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the connection is only written from here and from the keepalive loop, one at a time
+	writes := make(chan interface{}, 1)
+	writes <- map[string]interface{}{
+		"method": "SUBSCRIPTION",
+		"params": []string{mexcPrivateOrdersChannel, mexcPrivateDealsChannel, mexcPrivateAccountChannel},
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.keepAlive(ctx, conn, listenKey, writes, done)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		s.handle(message)
+	}
+}
+
+func (s *MEXCUserStream) keepAlive(ctx context.Context, conn *websocket.Conn, listenKey string, writes chan interface{}, done chan struct{}) {
+	ping := time.NewTicker(mexcPingInterval)
+	defer ping.Stop()
+	keepAlive := time.NewTicker(mexcListenKeyKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			// unblocks the read loop
+			conn.Close()
+			return
+		case message := <-writes:
+			if err := conn.WriteJSON(message); err != nil {
+				logger.Error(ctx, "error writing on mexc user stream", zap.Error(err))
+			}
+		case <-ping.C:
+			if err := conn.WriteJSON(map[string]string{"method": "PING"}); err != nil {
+				logger.Error(ctx, "error writing on mexc user stream", zap.Error(err))
+			}
+		case <-keepAlive.C:
+			if err := s.mexc.KeepAliveListenKey(listenKey); err != nil {
+				logger.Error(ctx, "error keeping mexc listen key alive", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *MEXCUserStream) handle(message []byte) {
+	var streamMessage mexcStreamMessage
+	if err := json.Unmarshal(message, &streamMessage); err != nil || streamMessage.Channel == "" {
+		return
+	}
+
+	streamSide := func(side streamValue) OrderSide {
+		if side == "2" {
+			return OrderSideSell
+		}
+		return OrderSideBuy
+	}
+
+	switch streamMessage.Channel {
+	case mexcPrivateOrdersChannel:
+		var data struct {
+			OrderID        streamValue     `json:"i"`
+			ClientOrderID  streamValue     `json:"c"`
+			Side           streamValue     `json:"S"`
+			Status         streamValue     `json:"s"`
+			Price          decimal.Decimal `json:"p"`
+			Quantity       decimal.Decimal `json:"v"`
+			ExecutedQty    decimal.Decimal `json:"cv"`
+			ExecutedAmount decimal.Decimal `json:"ca"`
+			AveragePrice   decimal.Decimal `json:"ap"`
+		}
+		if json.Unmarshal(streamMessage.Data, &data) != nil {
+			return
+		}
+
+		s.bus.PublishOrderUpdate(OrderUpdate{
+			Venue:          VenueMEXC,
+			Symbol:         streamMessage.Symbol,
+			OrderID:        string(data.OrderID),
+			ClientOrderID:  string(data.ClientOrderID),
+			Side:           streamSide(data.Side),
+			Status:         mexcOrderStatuses[string(data.Status)],
+			Price:          data.Price,
+			Quantity:       data.Quantity,
+			ExecutedQty:    data.ExecutedQty,
+			ExecutedAmount: data.ExecutedAmount,
+			AveragePrice:   data.AveragePrice,
+			Time:           time.UnixMilli(streamMessage.Time),
+		})
+
+	case mexcPrivateDealsChannel:
+		var data struct {
+			OrderID         streamValue     `json:"i"`
+			ClientOrderID   streamValue     `json:"c"`
+			TradeID         streamValue     `json:"t"`
+			Side            streamValue     `json:"S"`
+			Price           decimal.Decimal `json:"p"`
+			Quantity        decimal.Decimal `json:"v"`
+			Amount          decimal.Decimal `json:"a"`
+			Commission      decimal.Decimal `json:"n"`
+			CommissionAsset streamValue     `json:"N"`
+			IsMaker         streamValue     `json:"m"`
+			Time            int64           `json:"T"`
+		}
+		if json.Unmarshal(streamMessage.Data, &data) != nil {
+			return
+		}
+
+		s.bus.PublishFill(FillEvent{
+			Venue:           VenueMEXC,
+			Symbol:          streamMessage.Symbol,
+			OrderID:         string(data.OrderID),
+			ClientOrderID:   string(data.ClientOrderID),
+			TradeID:         string(data.TradeID),
+			Side:            streamSide(data.Side),
+			Price:           data.Price,
+			Quantity:        data.Quantity,
+			Amount:          data.Amount,
+			Commission:      data.Commission,
+			CommissionAsset: string(data.CommissionAsset),
+			IsMaker:         data.IsMaker == "1" || data.IsMaker == "true",
+			Time:            time.UnixMilli(data.Time),
+		})
+
+	case mexcPrivateAccountChannel:
+		var data struct {
+			Asset  streamValue     `json:"a"`
+			Free   decimal.Decimal `json:"f"`
+			Locked decimal.Decimal `json:"l"`
+			Time   int64           `json:"c"`
+		}
+		if json.Unmarshal(streamMessage.Data, &data) != nil {
+			return
+		}
+
+		s.bus.PublishBalance(BalanceUpdate{
+			Venue:  VenueMEXC,
+			Asset:  string(data.Asset),
+			Free:   data.Free,
+			Locked: data.Locked,
+			Time:   time.UnixMilli(data.Time),
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMEXCOrderStateUnknownOnlyWhenTheResponseIsLost(t *testing.T) {
+	// the rules of the symbol are known so no exchangeInfo is downloaded
+	mexcSymbolRulesOnce.Do(func() {})
+	previous := mexcSymbolRules
+	mexcSymbolRules = NewSymbolRulesCache(time.Minute, func() (MarketData, error) {
+		return MarketData{Symbols: []SymbolInfo{{Symbol: "FOOUSDT", BaseAsset: "FOO", QuoteAsset: "USDT", QuoteAssetPrecision: 4}}}, nil
+	})
+	defer func() { mexcSymbolRules = previous }()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name string
+		// answers the server time request, the time is fine when nil
+		time func(w http.ResponseWriter)
+		// answers the order request
+		order    func(w http.ResponseWriter)
+		orderURL string
+		unknown  bool
+	}{
+		{
+			name: "response lost",
+			order: func(w http.ResponseWriter) {
+				connection, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					connection.Close()
+				}
+			},
+			unknown: true,
+		},
+		{
+			name:     "exchange unreachable",
+			orderURL: closed.URL + "/api/v3/order",
+		},
+		{
+			name: "no timestamp",
+			time: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusTooManyRequests)
+				fmt.Fprint(w, `{"code":429}`)
+			},
+		},
+		{
+			name: "order refused",
+			order: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"code":30004,"msg":"Insufficient position"}`)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var orders int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/time":
+					if test.time != nil {
+						test.time(w)
+						return
+					}
+					fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli())
+				case "/api/v3/order":
+					atomic.AddInt32(&orders, 1)
+					test.order(w)
+				}
+			}))
+			defer server.Close()
+
+			cfg := config.Config{}
+			cfg.MEXCBaseURL = server.URL
+			cfg.MEXCOrderURL = server.URL + "/api/v3/order"
+			if test.orderURL != "" {
+				cfg.MEXCOrderURL = test.orderURL
+			}
+
+			m := NewMXCExchange(cfg)
+			_, err := m.PlaceMarketOrder(OrderRequest{Symbol: "FOOUSDT", Side: OrderSideBuy, QuoteOrderQty: decimal.New(10), ClientOrderID: "nlsbuy"})
+			if err == nil {
+				t.Fatal("the order went through")
+			}
+			if unknown := errors.Is(err, ErrOrderStateUnknown); unknown != test.unknown {
+				t.Errorf("err = %v, state unknown %v, want %v", err, unknown, test.unknown)
+			}
+
+			if test.time != nil && orders != 0 {
+				t.Errorf("%d orders sent without a timestamp", orders)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package exchange
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxNonceRetries is how many times a transaction is sent again after its nonce went stale
+const maxNonceRetries = 3
+
+// nonceManager is shared by every EthereumCompatible so the instances of a key don't collide
+var nonceManager = NewNonceManager()
+
+type nonceKey struct {
+	chainID int
+	address common.Address
+}
+
+type addressNonce struct {
+	mu     sync.Mutex
+	next   uint64
+	synced bool
+	// released are the nonces handed out but never broadcast, below next, they are handed out again first
+	released []uint64
+}
+
+// NonceManager hands out the nonces of the addresses of every chain one after the other,
+// they are read from the node on first use and after a resync. The nonces released because their
+// transaction was never broadcast fill the gaps they left before new ones are handed out.
+type NonceManager struct {
+	mu        sync.Mutex
+	addresses map[nonceKey]*addressNonce
+}
+
+func NewNonceManager() *NonceManager {
+	return &NonceManager{addresses: map[nonceKey]*addressNonce{}}
+}
+
+func (m *NonceManager) address(chainID int, address common.Address) *addressNonce {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := nonceKey{chainID: chainID, address: address}
+	nonce, ok := m.addresses[key]
+	if !ok {
+		nonce = &addressNonce{}
+		m.addresses[key] = nonce
+	}
+	return nonce
+}
+
+// Next returns the nonce of the next transaction of the address
+func (m *NonceManager) Next(ctx context.Context, client ChainClient, chainID int, address common.Address) (uint64, error) {
+	nonce := m.address(chainID, address)
+
+	nonce.mu.Lock()
+	defer nonce.mu.Unlock()
+
+	if !nonce.synced {
+		pending, err := client.PendingNonceAt(ctx, address)
+		if err != nil {
+			return 0, err
+		}
+		nonce.next, nonce.synced = pending, true
+	}
+
+	if len(nonce.released) > 0 {
+		next := nonce.released[0]
+		nonce.released = nonce.released[1:]
+		return next, nil
+	}
+
+	next := nonce.next
+	nonce.next++
+	return next, nil
+}
+
+// Release gives back a nonce whose transaction was never broadcast. The last nonce handed out is simply
+// handed out again, an earlier one is kept aside so the next transaction fills the gap.
+func (m *NonceManager) Release(chainID int, address common.Address, released uint64) {
+	nonce := m.address(chainID, address)
+
+	nonce.mu.Lock()
+	defer nonce.mu.Unlock()
+
+	// a resync since then reads the nonce from the node again anyway
+	if !nonce.synced || released >= nonce.next {
+		return
+	}
+
+	if released+1 == nonce.next {
+		nonce.next--
+		// the gaps left right below it are now the end of the sequence
+		for len(nonce.released) > 0 && nonce.released[len(nonce.released)-1]+1 == nonce.next {
+			nonce.next--
+			nonce.released = nonce.released[:len(nonce.released)-1]
+		}
+		return
+	}
+
+	for _, other := range nonce.released {
+		if other == released {
+			return
+		}
+	}
+	nonce.released = append(nonce.released, released)
+	sort.Slice(nonce.released, func(i, j int) bool { return nonce.released[i] < nonce.released[j] })
+}
+
+// Resync makes the next nonce of the address be read from the node again,
+// after a transaction was not sent or the node said the nonce was already used
+func (m *NonceManager) Resync(chainID int, address common.Address) {
+	nonce := m.address(chainID, address)
+
+	nonce.mu.Lock()
+	nonce.synced = false
+	nonce.released = nil
+	nonce.mu.Unlock()
+}
+
+// ResyncNonce makes the next transaction of the address read its nonce from the node, after one of them was dropped
+func ResyncNonce(chainID int, address string) {
+	nonceManager.Resync(chainID, common.HexToAddress(address))
+}
+
+// preMempoolRejections are the answers of the nodes to a transaction they refused before it reached the pool,
+// anything else may mean it is in the pool or its nonce is taken there
+var preMempoolRejections = []string{
+	"insufficient funds",
+	"intrinsic gas too low",
+	"exceeds block gas limit",
+	"fee cap less than block base fee",
+	"max fee per gas less than block base fee",
+	"max priority fee per gas higher than max fee per gas",
+	"tip above fee cap",
+	"exceeds the configured cap",
+	"transaction type not supported",
+	"invalid sender",
+	"oversized data",
+	"negative value",
+}
+
+// isNonceTooLow tells if the node refused the transaction because its nonce is already used
+func isNonceTooLow(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "nonce too low")
+}
+
+// isRejectedBeforeMempool tells if the node surely dropped the transaction, so its nonce can be handed out again
+func isRejectedBeforeMempool(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, rejection := range preMempoolRejections {
+		if strings.Contains(message, rejection) {
+			return true
+		}
+	}
+	return false
+}
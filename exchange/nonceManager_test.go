@@ -0,0 +1,126 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+// pendingNonceClient only answers the pending nonce of the node
+type pendingNonceClient struct {
+	ChainClient
+	pending uint64
+}
+
+func (c pendingNonceClient) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return c.pending, nil
+}
+
+func nextNonces(t *testing.T, manager *NonceManager, client ChainClient, count int) []uint64 {
+	t.Helper()
+
+	var nonces []uint64
+	for i := 0; i < count; i++ {
+		nonce, err := manager.Next(context.Background(), client, 1, common.Address{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonces = append(nonces, nonce)
+	}
+	return nonces
+}
+
+func TestNonceManagerReleasedNoncesFillTheGaps(t *testing.T) {
+	manager := NewNonceManager()
+	client := pendingNonceClient{pending: 5}
+
+	if nonces := nextNonces(t, manager, client, 3); nonces[0] != 5 || nonces[2] != 7 {
+		t.Fatalf("nonces = %v, want 5 to 7", nonces)
+	}
+
+	// 6 was never broadcast while 7 was, the next transaction takes 6
+	manager.Release(1, common.Address{}, 6)
+	if nonces := nextNonces(t, manager, client, 2); nonces[0] != 6 || nonces[1] != 8 {
+		t.Errorf("nonces = %v, want 6 then 8", nonces)
+	}
+
+	// the last nonces handed out are handed out again
+	manager.Release(1, common.Address{}, 7)
+	manager.Release(1, common.Address{}, 8)
+	if nonces := nextNonces(t, manager, client, 1); nonces[0] != 7 {
+		t.Errorf("nonces = %v, want 7", nonces)
+	}
+}
+
+func TestIsNonceTooLow(t *testing.T) {
+	if !isNonceTooLow(errors.New("nonce too low: next nonce 8, tx nonce 7")) {
+		t.Error("nonce too low is not seen")
+	}
+	// an underpriced replacement means the nonce is taken in the pool, it is resynced rather than retried
+	if isNonceTooLow(errors.New("replacement transaction underpriced")) {
+		t.Error("an underpriced replacement is taken for a used nonce")
+	}
+}
+
+func TestIsRejectedBeforeMempool(t *testing.T) {
+	tests := []struct {
+		err  string
+		want bool
+	}{
+		{err: "insufficient funds for gas * price + value: balance 0, tx cost 21000", want: true},
+		{err: "intrinsic gas too low: have 20000, want 21000", want: true},
+		{err: "max fee per gas less than block base fee: address 0x0, maxFeePerGas: 1, baseFee: 7", want: true},
+		{err: "tx fee (1.20 ether) exceeds the configured cap (1.00 ether)", want: true},
+		{err: "replacement transaction underpriced"},
+		{err: "already known"},
+		{err: "nonce too low: next nonce 8, tx nonce 7"},
+		{err: "Post \"https://rpc.example\": context deadline exceeded"},
+	}
+
+	for _, test := range tests {
+		if got := isRejectedBeforeMempool(errors.New(test.err)); got != test.want {
+			t.Errorf("isRejectedBeforeMempool(%q) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestUnderpricedReplacementResyncsTheNonce(t *testing.T) {
+	client := newFakeChain(t, 1004)
+	e, _ := newTestEthereumCompatible(t, client)
+	ctx := context.Background()
+
+	input, err := client.tokenABI.Pack("approve", testRouter, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func() error {
+		_, err := e.sendTransaction(ctx, client, TransactionKindApprove, "", testToken, big.NewInt(0), input)
+		return err
+	}
+
+	if err := send(); err != nil {
+		t.Fatal(err)
+	}
+
+	// another process took nonce 1 in the pool, our transaction at 1 is refused as an underpriced replacement
+	client.mu.Lock()
+	client.sent = append(client.sent, types.NewTx(&types.LegacyTx{Nonce: 1}))
+	client.sendErr = errors.New("replacement transaction underpriced")
+	client.mu.Unlock()
+
+	if err := send(); err == nil {
+		t.Fatal("the underpriced replacement was sent")
+	}
+	if err := send(); err != nil {
+		t.Fatal(err)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if last := client.sent[len(client.sent)-1]; last.Nonce() != 2 {
+		t.Errorf("nonce = %d, want 2 read from the node again", last.Nonce())
+	}
+}
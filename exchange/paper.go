@@ -0,0 +1,486 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const VenuePaper = "paper"
+
+var ErrPaperInsufficientBalance = errors.New("insufficient paper balance")
+
+const (
+	paperStatusNew      = "NEW"
+	paperStatusFilled   = "FILLED"
+	paperStatusCanceled = "CANCELED"
+	paperStatusExpired  = "EXPIRED"
+)
+
+// paperOrder is an order of the paper exchange, the locked amount is what a resting limit order holds
+type paperOrder struct {
+	response   OrderResponse
+	request    OrderRequest
+	baseAsset  string
+	quoteAsset string
+	rules      *SymbolRules
+	locked     decimal.Decimal
+	trades     []Trade
+}
+
+// PaperExchange simulates the fills of a venue against its live prices or a recording,
+// with slippage, fees and latency. Market data and symbol info come from the real venue,
+// no order ever reaches it.
+// Its orders and balances live in memory only, they are gone with the process.
+type PaperExchange struct {
+	venue    Exchange
+	prices   PriceSource
+	slippage decimal.Decimal // share of the price lost on every fill
+	fee      decimal.Decimal // share of the quote amount paid on every fill
+	latency  time.Duration
+
+	mu       sync.Mutex
+	runID    string // makes the order ids of the process unique across restarts
+	nextID   int64
+	orders   map[string]*paperOrder
+	clientID map[string]string
+	free     map[string]decimal.Decimal
+	locked   map[string]decimal.Decimal
+}
+
+var (
+	paperExchangesMu sync.Mutex
+	paperExchanges   = map[string]*PaperExchange{}
+)
+
+func NewPaperExchange(venue Exchange, prices PriceSource, cfg config.Config) *PaperExchange {
+	p := &PaperExchange{
+		venue:    venue,
+		prices:   prices,
+		slippage: decimal.NewFromFloat(cfg.PaperSlippagePercent / 100),
+		fee:      decimal.NewFromFloat(cfg.PaperFeePercent / 100),
+		latency:  time.Duration(cfg.PaperLatencyMs) * time.Millisecond,
+		runID:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		orders:   map[string]*paperOrder{},
+		clientID: map[string]string{},
+		free:     map[string]decimal.Decimal{},
+		locked:   map[string]decimal.Decimal{},
+	}
+
+	// balances are given like USDT:1000
+	for _, balance := range cfg.PaperBalances {
+		asset, amount, _ := strings.Cut(strings.TrimSpace(balance), ":")
+		value, err := decimal.NewFromString(amount)
+		if err != nil || asset == "" {
+			continue
+		}
+		p.free[strings.ToUpper(asset)] = value
+	}
+
+	return p
+}
+
+// PaperExchangeFor returns the paper exchange simulating the venue, it is shared
+// so the orders and balances survive between the jobs of an order
+func PaperExchangeFor(venue string, cfg config.Config) (*PaperExchange, error) {
+	paperExchangesMu.Lock()
+	defer paperExchangesMu.Unlock()
+
+	if paper, ok := paperExchanges[venue]; ok {
+		return paper, nil
+	}
+
+	realVenue, err := New(venue, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var prices PriceSource = NewLivePrices(realVenue)
+	if cfg.PaperPricesFile != "" {
+		prices, err = LoadRecordedPrices(cfg.PaperPricesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	paper := NewPaperExchange(realVenue, prices, cfg)
+	paperExchanges[venue] = paper
+	return paper, nil
+}
+
+func (p *PaperExchange) Name() string {
+	return VenuePaper
+}
+
+// symbolAssets returns the base and quote assets of the symbol and its rules when the venue has them
+func (p *PaperExchange) symbolAssets(symbol string) (string, string, *SymbolRules, error) {
+	if venue, ok := p.venue.(interface {
+		GetSymbolRules(symbol string) (SymbolRules, bool, error)
+	}); ok {
+		rules, found, _ := venue.GetSymbolRules(symbol)
+		if found {
+			return rules.BaseAsset, rules.QuoteAsset, &rules, nil
+		}
+	}
+
+	info, err := p.venue.GetSymbolInfo(symbol)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return info.BaseAsset, info.QuoteAsset, nil, nil
+}
+
+func (p *PaperExchange) PlaceMarketOrder(request OrderRequest) (OrderResponse, error) {
+	request.Type = OrderTypeMarket
+	return p.place(request)
+}
+
+func (p *PaperExchange) PlaceLimitOrder(request OrderRequest) (OrderResponse, error) {
+	if request.Type != OrderTypeImmediateOrCancel && request.Type != OrderTypeFillOrKill {
+		request.Type = OrderTypeLimit
+	}
+	return p.place(request)
+}
+
+func (p *PaperExchange) place(request OrderRequest) (OrderResponse, error) {
+	baseAsset, quoteAsset, rules, err := p.symbolAssets(request.Symbol)
+	if err != nil {
+		return OrderResponse{}, err
+	}
+
+	if rules != nil {
+		request, err = rules.Apply(request)
+		if err != nil {
+			return OrderResponse{}, err
+		}
+	}
+
+	// the time the order takes to reach the venue
+	time.Sleep(p.latency)
+
+	ticker, err := p.prices.GetTicker(request.Symbol)
+	if err != nil {
+		return OrderResponse{}, fmt.Errorf("%s paper request failed: %v", request.Side, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if request.ClientOrderID != "" {
+		if _, ok := p.clientID[request.ClientOrderID]; ok {
+			return OrderResponse{}, fmt.Errorf("%s paper request failed: duplicate client order id %s", request.Side, request.ClientOrderID)
+		}
+	}
+
+	p.nextID++
+	order := &paperOrder{
+		request:    request,
+		baseAsset:  baseAsset,
+		quoteAsset: quoteAsset,
+		rules:      rules,
+		response: OrderResponse{
+			Symbol:        request.Symbol,
+			OrderId:       "paper-" + p.runID + "-" + strconv.FormatInt(p.nextID, 10),
+			ClientOrderId: request.ClientOrderID,
+			Price:         request.Price,
+			OrigQty:       request.Quantity,
+			Status:        paperStatusNew,
+			Type:          string(request.Type),
+			Side:          string(request.Side),
+			TransactTime:  time.Now().UnixMilli(),
+		},
+	}
+
+	err = p.match(order, ticker)
+	if err != nil {
+		return OrderResponse{}, err
+	}
+
+	p.orders[order.response.OrderId] = order
+	if request.ClientOrderID != "" {
+		p.clientID[request.ClientOrderID] = order.response.OrderId
+	}
+
+	return order.response, nil
+}
+
+// fillPrice is the price the side fills at on the ticker once slipped, zero without a price
+func (p *PaperExchange) fillPrice(side OrderSide, ticker Ticker) decimal.Decimal {
+	one := decimal.New(1)
+
+	if side == OrderSideBuy {
+		ask := ticker.AskPrice
+		if ask.Sign() <= 0 {
+			ask = ticker.LastPrice
+		}
+		return ask.Mul(one.Add(p.slippage))
+	}
+
+	bid := ticker.BidPrice
+	if bid.Sign() <= 0 {
+		bid = ticker.LastPrice
+	}
+	return bid.Mul(one.Sub(p.slippage))
+}
+
+// match fills a new or resting order when the price allows it, a limit order that cannot fill rests
+// and holds its balance, immediate or cancel and fill or kill orders are dropped.
+// Must be called with the lock held.
+func (p *PaperExchange) match(order *paperOrder, ticker Ticker) error {
+	request := order.request
+	price := p.fillPrice(request.Side, ticker)
+	if price.Sign() <= 0 {
+		return fmt.Errorf("%s paper request failed: no price for %s", request.Side, request.Symbol)
+	}
+
+	if request.Type != OrderTypeMarket {
+		reachable := !price.GreaterThan(request.Price)
+		if request.Side == OrderSideSell {
+			reachable = !price.LessThan(request.Price)
+		}
+
+		if !reachable {
+			switch {
+			case order.response.Status != paperStatusNew:
+			case request.Type == OrderTypeFillOrKill:
+				order.response.Status = paperStatusExpired
+			case request.Type == OrderTypeImmediateOrCancel:
+				order.response.Status = paperStatusCanceled
+			case order.locked.IsZero():
+				return p.lock(order)
+			}
+			return nil
+		}
+
+		// a limit order fills at its price or better
+		if request.Side == OrderSideBuy {
+			price = decimal.Min(price, request.Price)
+		} else {
+			price = decimal.Max(price, request.Price)
+		}
+	}
+
+	quantity := request.Quantity
+	quoteQty := quantity.Mul(price)
+	if request.Side == OrderSideBuy && request.Type == OrderTypeMarket && request.QuoteOrderQty.Sign() > 0 {
+		quantity = request.QuoteOrderQty.Div(price)
+		quoteQty = request.QuoteOrderQty
+		if order.rules != nil {
+			quantity = order.rules.RoundQuantity(quantity)
+			quoteQty = quantity.Mul(price)
+		}
+	}
+	commission := quoteQty.Mul(p.fee)
+
+	// what the order held while resting goes back before paying
+	p.unlock(order)
+
+	if request.Side == OrderSideBuy {
+		if p.free[order.quoteAsset].LessThan(quoteQty.Add(commission)) {
+			return fmt.Errorf("%w: %s %v needed", ErrPaperInsufficientBalance, order.quoteAsset, quoteQty.Add(commission))
+		}
+		p.free[order.quoteAsset] = p.free[order.quoteAsset].Sub(quoteQty).Sub(commission)
+		p.free[order.baseAsset] = p.free[order.baseAsset].Add(quantity)
+	} else {
+		if p.free[order.baseAsset].LessThan(quantity) {
+			return fmt.Errorf("%w: %s %v needed", ErrPaperInsufficientBalance, order.baseAsset, quantity)
+		}
+		p.free[order.baseAsset] = p.free[order.baseAsset].Sub(quantity)
+		p.free[order.quoteAsset] = p.free[order.quoteAsset].Add(quoteQty).Sub(commission)
+	}
+
+	now := time.Now().UnixMilli()
+	order.trades = append(order.trades, Trade{
+		Symbol:          request.Symbol,
+		Id:              order.response.OrderId + "-" + strconv.Itoa(len(order.trades)+1),
+		OrderId:         order.response.OrderId,
+		ClientOrderId:   request.ClientOrderID,
+		Price:           price,
+		Qty:             quantity,
+		QuoteQty:        quoteQty,
+		Commission:      commission,
+		CommissionAsset: order.quoteAsset,
+		Time:            now,
+		IsBuyer:         request.Side == OrderSideBuy,
+		IsMaker:         order.response.TransactTime < now && request.Type == OrderTypeLimit,
+	})
+
+	order.response.Status = paperStatusFilled
+	order.response.OrigQty = quantity
+	order.response.ExecutedQty = quantity
+	order.response.CummulativeQuoteQty = quoteQty
+	return nil
+}
+
+// lock holds the balance a resting limit order needs, must be called with the lock held
+func (p *PaperExchange) lock(order *paperOrder) error {
+	asset, amount := order.baseAsset, order.request.Quantity
+	if order.request.Side == OrderSideBuy {
+		asset = order.quoteAsset
+		amount = order.request.Quantity.Mul(order.request.Price)
+		amount = amount.Add(amount.Mul(p.fee))
+	}
+
+	if p.free[asset].LessThan(amount) {
+		return fmt.Errorf("%w: %s %v needed", ErrPaperInsufficientBalance, asset, amount)
+	}
+
+	p.free[asset] = p.free[asset].Sub(amount)
+	p.locked[asset] = p.locked[asset].Add(amount)
+	order.locked = amount
+	return nil
+}
+
+// unlock gives back what a resting order held, must be called with the lock held
+func (p *PaperExchange) unlock(order *paperOrder) {
+	if order.locked.IsZero() {
+		return
+	}
+
+	asset := order.baseAsset
+	if order.request.Side == OrderSideBuy {
+		asset = order.quoteAsset
+	}
+
+	p.free[asset] = p.free[asset].Add(order.locked)
+	p.locked[asset] = p.locked[asset].Sub(order.locked)
+	order.locked = decimal.Zero
+}
+
+// refresh tries to fill the resting orders of the symbol at the current price
+func (p *PaperExchange) refresh(symbol string) {
+	ticker, err := p.prices.GetTicker(symbol)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, order := range p.orders {
+		if order.response.Symbol == symbol && order.response.Status == paperStatusNew {
+			// a resting order that cannot be paid anymore keeps waiting
+			_ = p.match(order, ticker)
+		}
+	}
+}
+
+func (p *PaperExchange) order(symbol string, orderID string) (*paperOrder, error) {
+	order, ok := p.orders[orderID]
+	if !ok || order.response.Symbol != symbol {
+		return nil, fmt.Errorf("paper order %s on %s: %w", orderID, symbol, ErrOrderNotFound)
+	}
+	return order, nil
+}
+
+func (p *PaperExchange) CancelOrder(symbol string, orderID string) (OrderResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, err := p.order(symbol, orderID)
+	if err != nil {
+		return OrderResponse{}, err
+	}
+
+	if order.response.Status != paperStatusNew {
+		return order.response, fmt.Errorf("paper order %s is %s", orderID, order.response.Status)
+	}
+
+	p.unlock(order)
+	order.response.Status = paperStatusCanceled
+	return order.response, nil
+}
+
+func (p *PaperExchange) CancelAllOpenOrders(symbol string) ([]OrderResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var cancelled []OrderResponse
+	for _, order := range p.orders {
+		if order.response.Symbol == symbol && order.response.Status == paperStatusNew {
+			p.unlock(order)
+			order.response.Status = paperStatusCanceled
+			cancelled = append(cancelled, order.response)
+		}
+	}
+
+	return cancelled, nil
+}
+
+func (p *PaperExchange) GetOrder(symbol string, orderID string) (OrderResponse, error) {
+	p.refresh(symbol)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, err := p.order(symbol, orderID)
+	if err != nil {
+		return OrderResponse{}, err
+	}
+	return order.response, nil
+}
+
+func (p *PaperExchange) GetOrderByClientID(symbol string, clientOrderID string) (OrderResponse, error) {
+	p.mu.Lock()
+	orderID, ok := p.clientID[clientOrderID]
+	p.mu.Unlock()
+
+	if !ok {
+		return OrderResponse{}, fmt.Errorf("paper order %s on %s: %w", clientOrderID, symbol, ErrOrderNotFound)
+	}
+	return p.GetOrder(symbol, orderID)
+}
+
+func (p *PaperExchange) GetOpenOrders(symbol string) ([]OrderResponse, error) {
+	p.refresh(symbol)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var open []OrderResponse
+	for _, order := range p.orders {
+		if order.response.Symbol == symbol && order.response.Status == paperStatusNew {
+			open = append(open, order.response)
+		}
+	}
+
+	return open, nil
+}
+
+func (p *PaperExchange) GetMyTrades(symbol string, orderID string) ([]Trade, error) {
+	p.refresh(symbol)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, err := p.order(symbol, orderID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Trade(nil), order.trades...), nil
+}
+
+func (p *PaperExchange) GetBalances() ([]Balance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	balances := make([]Balance, 0, len(p.free))
+	for asset, free := range p.free {
+		balances = append(balances, Balance{Asset: asset, Free: free, Locked: p.locked[asset]})
+	}
+
+	return balances, nil
+}
+
+func (p *PaperExchange) GetTicker(symbol string) (Ticker, error) {
+	return p.prices.GetTicker(symbol)
+}
+
+func (p *PaperExchange) GetSymbolInfo(symbol string) (SymbolInfo, error) {
+	return p.venue.GetSymbolInfo(symbol)
+}
@@ -0,0 +1,189 @@
+package exchange
+
+import (
+	"NewListingBot/decimal"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamPriceMaxAge is how old a streamed book can be before the REST ticker is asked instead
+const streamPriceMaxAge = 2 * time.Second
+
+// PriceSource gives the prices the paper orders are filled at
+type PriceSource interface {
+	GetTicker(symbol string) (Ticker, error)
+}
+
+// LivePrices reads the prices of the venue, from the market stream when it runs and is fresh
+type LivePrices struct {
+	venue Exchange
+}
+
+func NewLivePrices(venue Exchange) *LivePrices {
+	return &LivePrices{venue: venue}
+}
+
+func (p *LivePrices) GetTicker(symbol string) (Ticker, error) {
+	if stream := MEXCMarketStream(); stream != nil && p.venue.Name() == VenueMEXC {
+		stream.WatchSymbol(symbol)
+
+		if book, ok := stream.Cache().BookTicker(symbol, streamPriceMaxAge); ok {
+			ticker := Ticker{
+				Symbol:   symbol,
+				BidPrice: book.BidPrice,
+				AskPrice: book.AskPrice,
+			}
+			ticker.LastPrice = ticker.AskPrice
+			if deal, ok := stream.Cache().LastDeal(symbol, streamPriceMaxAge); ok {
+				ticker.LastPrice = deal.Price
+			}
+			return ticker, nil
+		}
+	}
+
+	return p.venue.GetTicker(symbol)
+}
+
+// RecordedPrice is a price of a symbol at a time of a recording
+type RecordedPrice struct {
+	Time     time.Time
+	Symbol   string
+	Price    decimal.Decimal
+	BidPrice decimal.Decimal
+	AskPrice decimal.Decimal
+}
+
+// RecordedPrices replays a recording of prices from the moment it is loaded,
+// the first recorded price is played right away and the next ones keep their delays
+type RecordedPrices struct {
+	start    time.Time
+	origin   time.Time
+	mu       sync.RWMutex
+	bySymbol map[string][]RecordedPrice
+}
+
+func NewRecordedPrices(prices []RecordedPrice) *RecordedPrices {
+	recorded := &RecordedPrices{
+		start:    time.Now(),
+		bySymbol: map[string][]RecordedPrice{},
+	}
+
+	for _, price := range prices {
+		if recorded.origin.IsZero() || price.Time.Before(recorded.origin) {
+			recorded.origin = price.Time
+		}
+		recorded.bySymbol[price.Symbol] = append(recorded.bySymbol[price.Symbol], price)
+	}
+
+	for _, symbolPrices := range recorded.bySymbol {
+		sort.SliceStable(symbolPrices, func(i, j int) bool {
+			return symbolPrices[i].Time.Before(symbolPrices[j].Time)
+		})
+	}
+
+	return recorded
+}
+
+// LoadRecordedPrices reads a csv recording with the columns time, symbol, price and optionally bid and ask.
+// The time is either unix milliseconds or RFC3339, a header line is skipped.
+func LoadRecordedPrices(path string) (*RecordedPrices, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening recorded prices failed: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var prices []RecordedPrice
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading recorded prices failed: %v", err)
+		}
+
+		if len(record) < 3 {
+			return nil, fmt.Errorf("recorded prices line %d: expected time, symbol and price", line)
+		}
+
+		price, err := parseRecordedPrice(record)
+		if err != nil {
+			if line == 1 {
+				// header
+				continue
+			}
+			return nil, fmt.Errorf("recorded prices line %d: %v", line, err)
+		}
+		prices = append(prices, price)
+	}
+
+	return NewRecordedPrices(prices), nil
+}
+
+func parseRecordedPrice(record []string) (RecordedPrice, error) {
+	var price RecordedPrice
+
+	if millis, err := strconv.ParseInt(record[0], 10, 64); err == nil {
+		price.Time = time.UnixMilli(millis)
+	} else if parsed, err := time.Parse(time.RFC3339, record[0]); err == nil {
+		price.Time = parsed
+	} else {
+		return price, fmt.Errorf("invalid time %q", record[0])
+	}
+
+	price.Symbol = strings.ToUpper(strings.TrimSpace(record[1]))
+
+	var err error
+	if price.Price, err = decimal.NewFromString(record[2]); err != nil {
+		return price, err
+	}
+
+	price.BidPrice, price.AskPrice = price.Price, price.Price
+	if len(record) >= 5 {
+		if price.BidPrice, err = decimal.NewFromString(record[3]); err != nil {
+			return price, err
+		}
+		if price.AskPrice, err = decimal.NewFromString(record[4]); err != nil {
+			return price, err
+		}
+	}
+
+	return price, nil
+}
+
+// GetTicker returns the last recorded price of the symbol at this point of the replay
+func (p *RecordedPrices) GetTicker(symbol string) (Ticker, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	replayTime := p.origin.Add(time.Since(p.start))
+	symbolPrices := p.bySymbol[symbol]
+
+	// first price recorded after the replay time
+	next := sort.Search(len(symbolPrices), func(i int) bool {
+		return symbolPrices[i].Time.After(replayTime)
+	})
+	if next == 0 {
+		return Ticker{}, fmt.Errorf("no recorded price of %s yet", symbol)
+	}
+
+	price := symbolPrices[next-1]
+	return Ticker{
+		Symbol:    symbol,
+		LastPrice: price.Price,
+		BidPrice:  price.BidPrice,
+		AskPrice:  price.AskPrice,
+	}, nil
+}
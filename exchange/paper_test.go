@@ -0,0 +1,201 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// paperVenue is the real venue behind the paper exchange, it only knows the symbol
+type paperVenue struct {
+	Exchange
+}
+
+func (paperVenue) GetSymbolInfo(symbol string) (SymbolInfo, error) {
+	return SymbolInfo{Symbol: symbol, BaseAsset: "FOO", QuoteAsset: "USDT"}, nil
+}
+
+// testPrices is a price source the test moves
+type testPrices struct {
+	mu     sync.Mutex
+	ticker Ticker
+}
+
+func (p *testPrices) GetTicker(symbol string) (Ticker, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.ticker, nil
+}
+
+func (p *testPrices) set(bid string, ask string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ticker = Ticker{Symbol: "FOOUSDT", BidPrice: decimal.RequireFromString(bid), AskPrice: decimal.RequireFromString(ask), LastPrice: decimal.RequireFromString(ask)}
+}
+
+// newTestPaperExchange trades FOOUSDT with 1000 USDT, a 1% slippage and a 0.1% fee
+func newTestPaperExchange() (*PaperExchange, *testPrices) {
+	prices := &testPrices{}
+	prices.set("1.9", "2")
+
+	cfg := config.Config{}
+	cfg.PaperSlippagePercent = 1
+	cfg.PaperFeePercent = 0.1
+	cfg.PaperBalances = []string{"USDT:1000"}
+
+	return NewPaperExchange(paperVenue{}, prices, cfg), prices
+}
+
+// assertPaperBalance checks the free and locked balance of the asset
+func assertPaperBalance(t *testing.T, p *PaperExchange, asset string, free string, locked string) {
+	t.Helper()
+
+	balances, err := p.GetBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balance := Balance{Asset: asset}
+	for _, b := range balances {
+		if b.Asset == asset {
+			balance = b
+		}
+	}
+
+	if !balance.Free.Equal(decimal.RequireFromString(free)) || !balance.Locked.Equal(decimal.RequireFromString(locked)) {
+		t.Errorf("%s = %v free %v locked, want %s free %s locked", asset, balance.Free, balance.Locked, free, locked)
+	}
+}
+
+func TestPaperMarketOrdersFillWithSlippageAndFee(t *testing.T) {
+	p, _ := newTestPaperExchange()
+
+	// the ask of 2 slips to 2.02
+	buy, err := p.PlaceMarketOrder(OrderRequest{Symbol: "FOOUSDT", Side: OrderSideBuy, QuoteOrderQty: decimal.New(101), ClientOrderID: "buy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buy.Status != paperStatusFilled || buy.ExecutedQty.String() != "50" || buy.CummulativeQuoteQty.String() != "101" {
+		t.Errorf("buy = %+v, want 50 filled for 101", buy)
+	}
+
+	trades, err := p.GetMyTrades("FOOUSDT", buy.OrderId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 1 || trades[0].Price.String() != "2.02" || trades[0].Commission.String() != "0.101" || trades[0].CommissionAsset != "USDT" {
+		t.Errorf("trades = %+v, want one at 2.02 paying 0.101 USDT", trades)
+	}
+	assertPaperBalance(t, p, "USDT", "898.899", "0")
+	assertPaperBalance(t, p, "FOO", "50", "0")
+
+	// the bid of 1.9 slips to 1.881
+	sell, err := p.PlaceMarketOrder(OrderRequest{Symbol: "FOOUSDT", Side: OrderSideSell, Quantity: decimal.New(20), ClientOrderID: "sell"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sell.Status != paperStatusFilled || sell.CummulativeQuoteQty.String() != "37.62" {
+		t.Errorf("sell = %+v, want 20 filled for 37.62", sell)
+	}
+	// 898.899 + 37.62 - 0.03762
+	assertPaperBalance(t, p, "USDT", "936.48138", "0")
+	assertPaperBalance(t, p, "FOO", "30", "0")
+}
+
+func TestPaperLimitOrderRestsThenFills(t *testing.T) {
+	p, prices := newTestPaperExchange()
+
+	order, err := p.PlaceLimitOrder(OrderRequest{Symbol: "FOOUSDT", Side: OrderSideBuy, Quantity: decimal.New(10), Price: decimal.RequireFromString("1.5"), ClientOrderID: "limit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != paperStatusNew || !order.ExecutedQty.IsZero() {
+		t.Fatalf("order = %+v, want it resting", order)
+	}
+	// 10 at 1.5 and the fee
+	assertPaperBalance(t, p, "USDT", "984.985", "15.015")
+
+	open, err := p.GetOpenOrders("FOOUSDT")
+	if err != nil || len(open) != 1 {
+		t.Errorf("open orders = %v %v, want the resting one", open, err)
+	}
+
+	// the ask of 1.4 slips to 1.414, under the limit
+	prices.set("1.3", "1.4")
+	filled, err := p.GetOrder("FOOUSDT", order.OrderId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filled.Status != paperStatusFilled || filled.ExecutedQty.String() != "10" || filled.CummulativeQuoteQty.String() != "14.14" {
+		t.Errorf("order = %+v, want 10 filled for 14.14", filled)
+	}
+	// 1000 - 14.14 - 0.01414, the lock is given back
+	assertPaperBalance(t, p, "USDT", "985.84586", "0")
+	assertPaperBalance(t, p, "FOO", "10", "0")
+}
+
+func TestPaperCancelReleasesTheLockedBalance(t *testing.T) {
+	p, prices := newTestPaperExchange()
+
+	order, err := p.PlaceLimitOrder(OrderRequest{Symbol: "FOOUSDT", Side: OrderSideBuy, Quantity: decimal.New(10), Price: decimal.RequireFromString("1.5")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPaperBalance(t, p, "USDT", "984.985", "15.015")
+
+	cancelled, err := p.CancelOrder("FOOUSDT", order.OrderId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != paperStatusCanceled {
+		t.Errorf("status = %s, want %s", cancelled.Status, paperStatusCanceled)
+	}
+	assertPaperBalance(t, p, "USDT", "1000", "0")
+
+	// a cancelled order does not fill anymore
+	prices.set("1.3", "1.4")
+	if order, err = p.GetOrder("FOOUSDT", order.OrderId); err != nil || order.Status != paperStatusCanceled {
+		t.Errorf("order = %+v %v, want it still cancelled", order, err)
+	}
+	if _, err := p.CancelOrder("FOOUSDT", order.OrderId); err == nil {
+		t.Error("cancelled twice")
+	}
+	assertPaperBalance(t, p, "USDT", "1000", "0")
+	assertPaperBalance(t, p, "FOO", "0", "0")
+}
+
+func TestPaperInsufficientBalance(t *testing.T) {
+	p, _ := newTestPaperExchange()
+
+	requests := []struct {
+		name    string
+		limit   bool
+		request OrderRequest
+	}{
+		// 1000 of quote and the fee
+		{name: "market buy", request: OrderRequest{Symbol: "FOOUSDT", Side: OrderSideBuy, QuoteOrderQty: decimal.New(1000)}},
+		{name: "resting limit buy", limit: true, request: OrderRequest{Symbol: "FOOUSDT", Side: OrderSideBuy, Quantity: decimal.New(700), Price: decimal.RequireFromString("1.5")}},
+		{name: "market sell", request: OrderRequest{Symbol: "FOOUSDT", Side: OrderSideSell, Quantity: decimal.New(1)}},
+		{name: "resting limit sell", limit: true, request: OrderRequest{Symbol: "FOOUSDT", Side: OrderSideSell, Quantity: decimal.New(1), Price: decimal.New(3)}},
+	}
+
+	for _, test := range requests {
+		place := p.PlaceMarketOrder
+		if test.limit {
+			place = p.PlaceLimitOrder
+		}
+
+		if _, err := place(test.request); !errors.Is(err, ErrPaperInsufficientBalance) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrPaperInsufficientBalance)
+		}
+	}
+
+	assertPaperBalance(t, p, "USDT", "1000", "0")
+	if open, _ := p.GetOpenOrders("FOOUSDT"); len(open) != 0 {
+		t.Errorf("open orders = %v, want none", open)
+	}
+}
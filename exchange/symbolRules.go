@@ -0,0 +1,248 @@
+package exchange
+
+import (
+	"NewListingBot/decimal"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// minRulesRefresh throttles the reloads caused by symbols missing from the cache,
+// a symbol being listed is looked up by every buy attempt
+const minRulesRefresh = 30 * time.Second
+
+var ErrSymbolRules = errors.New("order breaks the symbol rules")
+
+// SymbolRules are the trading rules of a symbol taken from exchangeInfo
+type SymbolRules struct {
+	Symbol     string `json:"symbol"`
+	BaseAsset  string `json:"base_asset"`
+	QuoteAsset string `json:"quote_asset"`
+
+	QuantityStep      decimal.Decimal `json:"quantity_step"`      // quantities are a multiple of it, 0 when only the precision applies
+	QuantityPrecision int             `json:"quantity_precision"` // decimals allowed on quantities
+	PriceTick         decimal.Decimal `json:"price_tick"`         // prices are a multiple of it, 0 when only the precision applies
+	PricePrecision    int             `json:"price_precision"`    // decimals allowed on prices
+	QuotePrecision    int             `json:"quote_precision"`    // decimals allowed on quote amounts
+
+	MinNotional       decimal.Decimal `json:"min_notional"`
+	MaxNotional       decimal.Decimal `json:"max_notional"` // 0 when unlimited
+	MaxNotionalMarket decimal.Decimal `json:"max_notional_market"`
+}
+
+// NewSymbolRules reads the rules out of the symbol info, filters win over the precision fields when present
+func NewSymbolRules(info SymbolInfo) SymbolRules {
+	rules := SymbolRules{
+		Symbol:            info.Symbol,
+		BaseAsset:         info.BaseAsset,
+		QuoteAsset:        info.QuoteAsset,
+		QuantityStep:      parseRule(info.BaseSizePrecision),
+		QuantityPrecision: info.BaseAssetPrecision,
+		PricePrecision:    info.QuotePrecision,
+		QuotePrecision:    info.QuoteAssetPrecision,
+		MinNotional:       parseRule(info.QuoteAmountPrecision),
+		MaxNotional:       parseRule(info.MaxQuoteAmount),
+		MaxNotionalMarket: parseRule(info.MaxQuoteAmountMarket),
+	}
+
+	for _, filter := range info.Filters {
+		values, ok := filter.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		switch values["filterType"] {
+		case "PRICE_FILTER":
+			if tick := parseRuleValue(values["tickSize"]); tick.Sign() > 0 {
+				rules.PriceTick = tick
+			}
+		case "LOT_SIZE":
+			if step := parseRuleValue(values["stepSize"]); step.Sign() > 0 {
+				rules.QuantityStep = step
+			}
+		case "MIN_NOTIONAL", "NOTIONAL":
+			if minNotional := parseRuleValue(values["minNotional"]); minNotional.Sign() > 0 {
+				rules.MinNotional = minNotional
+			}
+		}
+	}
+
+	return rules
+}
+
+func parseRule(value string) decimal.Decimal {
+	rule, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Zero
+	}
+	return rule
+}
+
+func parseRuleValue(value interface{}) decimal.Decimal {
+	switch v := value.(type) {
+	case string:
+		return parseRule(v)
+	case float64:
+		return decimal.NewFromFloat(v)
+	}
+	return decimal.Zero
+}
+
+// floorTo rounds the value down to a multiple of step, or to the decimals when there is no step
+func floorTo(value decimal.Decimal, step decimal.Decimal, decimals int) decimal.Decimal {
+	if step.Sign() > 0 {
+		return value.FloorTo(step)
+	}
+	return value.Truncate(decimals)
+}
+
+func (r SymbolRules) RoundQuantity(quantity decimal.Decimal) decimal.Decimal {
+	return floorTo(quantity, r.QuantityStep, r.QuantityPrecision)
+}
+
+func (r SymbolRules) RoundPrice(price decimal.Decimal) decimal.Decimal {
+	return floorTo(price, r.PriceTick, r.PricePrecision)
+}
+
+func (r SymbolRules) RoundQuote(amount decimal.Decimal) decimal.Decimal {
+	return floorTo(amount, decimal.Zero, r.QuotePrecision)
+}
+
+// Apply rounds the amounts of the request down to what the symbol accepts and
+// refuses it when it is empty after rounding or out of the notional bounds
+func (r SymbolRules) Apply(request OrderRequest) (OrderRequest, error) {
+	if request.QuoteOrderQty.Sign() > 0 {
+		request.QuoteOrderQty = r.RoundQuote(request.QuoteOrderQty)
+	}
+	if request.Quantity.Sign() > 0 {
+		request.Quantity = r.RoundQuantity(request.Quantity)
+	}
+	if request.Price.Sign() > 0 {
+		request.Price = r.RoundPrice(request.Price)
+	}
+
+	// the notional of a market sell is only known once filled
+	notional := request.QuoteOrderQty
+	if notional.IsZero() && request.Price.Sign() > 0 {
+		notional = request.Quantity.Mul(request.Price)
+	}
+
+	maxNotional := r.MaxNotional
+	if request.Type == OrderTypeMarket && r.MaxNotionalMarket.Sign() > 0 {
+		maxNotional = r.MaxNotionalMarket
+	}
+
+	switch {
+	case request.QuoteOrderQty.IsZero() && request.Quantity.IsZero():
+		return request, fmt.Errorf("%w: %s amount rounds to zero", ErrSymbolRules, r.Symbol)
+	case notional.Sign() > 0 && r.MinNotional.Sign() > 0 && notional.LessThan(r.MinNotional):
+		return request, fmt.Errorf("%w: %s notional %v below min %v", ErrSymbolRules, r.Symbol, notional, r.MinNotional)
+	case notional.Sign() > 0 && maxNotional.Sign() > 0 && notional.GreaterThan(maxNotional):
+		return request, fmt.Errorf("%w: %s notional %v above max %v", ErrSymbolRules, r.Symbol, notional, maxNotional)
+	}
+
+	return request, nil
+}
+
+// SymbolRulesCache keeps the rules and the info of every symbol, reloading them from exchangeInfo once they are too old.
+// The download runs outside the lock, the callers needing a reload meanwhile wait for the one in flight.
+type SymbolRulesCache struct {
+	ttl  time.Duration
+	load func() (MarketData, error)
+
+	mu       sync.Mutex
+	rules    map[string]SymbolRules
+	infos    map[string]SymbolInfo
+	loadedAt time.Time
+	loading  *rulesLoad
+}
+
+// rulesLoad is a reload in flight, err is set before done is closed
+type rulesLoad struct {
+	done chan struct{}
+	err  error
+}
+
+func NewSymbolRulesCache(ttl time.Duration, load func() (MarketData, error)) *SymbolRulesCache {
+	return &SymbolRulesCache{
+		ttl:   ttl,
+		load:  load,
+		rules: map[string]SymbolRules{},
+		infos: map[string]SymbolInfo{},
+	}
+}
+
+// Get returns the rules of the symbol, false when the exchange does not know the symbol yet
+func (c *SymbolRulesCache) Get(symbol string) (SymbolRules, bool, error) {
+	rules, _, found, err := c.lookup(symbol)
+	return rules, found, err
+}
+
+// Info returns the exchangeInfo entry of the symbol, false when the exchange does not know the symbol yet
+func (c *SymbolRulesCache) Info(symbol string) (SymbolInfo, bool, error) {
+	_, info, found, err := c.lookup(symbol)
+	return info, found, err
+}
+
+func (c *SymbolRulesCache) lookup(symbol string) (SymbolRules, SymbolInfo, bool, error) {
+	c.mu.Lock()
+	rules, found := c.rules[symbol]
+	info := c.infos[symbol]
+	age := time.Since(c.loadedAt)
+	c.mu.Unlock()
+
+	if age < c.ttl && (found || age < minRulesRefresh) {
+		return rules, info, found, nil
+	}
+
+	if err := c.refresh(); err != nil {
+		// stale rules are better than none
+		return rules, info, found, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rules, found = c.rules[symbol]
+	return rules, c.infos[symbol], found, nil
+}
+
+// refresh reloads exchangeInfo, or waits for the reload already in flight
+func (c *SymbolRulesCache) refresh() error {
+	c.mu.Lock()
+	if load := c.loading; load != nil {
+		c.mu.Unlock()
+		<-load.done
+		return load.err
+	}
+	load := &rulesLoad{done: make(chan struct{})}
+	c.loading = load
+	c.mu.Unlock()
+
+	defer close(load.done)
+
+	marketData, err := c.load()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loading = nil
+	load.err = err
+	if err != nil {
+		return err
+	}
+
+	rules := make(map[string]SymbolRules, len(marketData.Symbols))
+	infos := make(map[string]SymbolInfo, len(marketData.Symbols))
+	for _, info := range marketData.Symbols {
+		rules[info.Symbol] = NewSymbolRules(info)
+		infos[info.Symbol] = info
+	}
+
+	c.rules = rules
+	c.infos = infos
+	c.loadedAt = time.Now()
+
+	return nil
+}
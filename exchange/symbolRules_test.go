@@ -0,0 +1,194 @@
+package exchange
+
+import (
+	"NewListingBot/decimal"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSymbolRulesCacheLoadsOnceForConcurrentLookups(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+
+	cache := NewSymbolRulesCache(time.Minute, func() (MarketData, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return MarketData{Symbols: []SymbolInfo{{Symbol: "FOOUSDT", BaseAsset: "FOO", QuoteAsset: "USDT"}}}, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make(chan bool, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, found, err := cache.Info("FOOUSDT")
+			results <- err == nil && found && info.BaseAsset == "FOO"
+		}()
+	}
+
+	// every lookup is waiting on the download by now
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for ok := range results {
+		if !ok {
+			t.Error("a lookup did not get the symbol")
+		}
+	}
+	if loads != 1 {
+		t.Errorf("exchangeInfo loaded %d times, want once", loads)
+	}
+
+	rules, found, err := cache.Get("FOOUSDT")
+	if err != nil || !found || rules.QuoteAsset != "USDT" || loads != 1 {
+		t.Errorf("rules = %+v %v %v after %d loads, want the cached ones", rules, found, err, loads)
+	}
+}
+
+// testSymbolInfos are exchangeInfo entries the way MEXC sends them, the second one with filters
+const testSymbolInfos = `[
+	{"symbol":"FOOUSDT","status":"1","baseAsset":"FOO","baseAssetPrecision":2,"quoteAsset":"USDT","quotePrecision":4,
+	"quoteAssetPrecision":4,"baseCommissionPrecision":2,"quoteCommissionPrecision":4,"orderTypes":["LIMIT","MARKET","LIMIT_MAKER"],
+	"isSpotTradingAllowed":true,"isMarginTradingAllowed":false,"quoteAmountPrecision":"5.000000000000000000","baseSizePrecision":"0.01",
+	"permissions":["SPOT"],"filters":[],"maxQuoteAmount":"2000000.000000000000000000","makerCommission":"0","takerCommission":"0.0005",
+	"quoteAmountPrecisionMarket":"5.000000000000000000","maxQuoteAmountMarket":"100000.000000000000000000","fullName":"Foo"},
+	{"symbol":"BARUSDT","status":"1","baseAsset":"BAR","baseAssetPrecision":4,"quoteAsset":"USDT","quotePrecision":6,
+	"quoteAssetPrecision":6,"quoteAmountPrecision":"1","baseSizePrecision":"0",
+	"filters":[{"filterType":"PRICE_FILTER","tickSize":"0.0005"},{"filterType":"LOT_SIZE","stepSize":"0.5"},{"filterType":"NOTIONAL","minNotional":10}],
+	"maxQuoteAmount":"0","maxQuoteAmountMarket":"0"}
+]`
+
+func testSymbolRules(t *testing.T) (SymbolRules, SymbolRules) {
+	t.Helper()
+
+	var infos []SymbolInfo
+	if err := json.Unmarshal([]byte(testSymbolInfos), &infos); err != nil {
+		t.Fatal(err)
+	}
+	return NewSymbolRules(infos[0]), NewSymbolRules(infos[1])
+}
+
+func TestNewSymbolRules(t *testing.T) {
+	foo, bar := testSymbolRules(t)
+
+	if foo.QuantityStep.String() != "0.01" || foo.PriceTick.Sign() != 0 || foo.PricePrecision != 4 || foo.QuotePrecision != 4 {
+		t.Errorf("FOOUSDT rounding = %+v, want a 0.01 step and 4 decimals on prices", foo)
+	}
+	if foo.MinNotional.String() != "5" || foo.MaxNotional.String() != "2000000" || foo.MaxNotionalMarket.String() != "100000" {
+		t.Errorf("FOOUSDT notional = %v to %v (%v market), want 5 to 2000000 (100000 market)", foo.MinNotional, foo.MaxNotional, foo.MaxNotionalMarket)
+	}
+
+	// the filters win over the precision fields
+	if bar.QuantityStep.String() != "0.5" || bar.PriceTick.String() != "0.0005" || bar.MinNotional.String() != "10" {
+		t.Errorf("BARUSDT rules = %+v, want the ones of the filters", bar)
+	}
+}
+
+func TestSymbolRulesApply(t *testing.T) {
+	foo, bar := testSymbolRules(t)
+
+	tests := []struct {
+		name     string
+		rules    SymbolRules
+		request  OrderRequest
+		quantity string
+		price    string
+		quote    string
+		err      bool
+	}{
+		{
+			name:     "limit rounded down to the step and the precision",
+			rules:    foo,
+			request:  OrderRequest{Type: OrderTypeLimit, Quantity: decimal.RequireFromString("12.3456"), Price: decimal.RequireFromString("1.23456")},
+			quantity: "12.34",
+			price:    "1.2345",
+		},
+		{
+			name:     "limit rounded down to the step and the tick",
+			rules:    bar,
+			request:  OrderRequest{Type: OrderTypeLimit, Quantity: decimal.RequireFromString("12.3"), Price: decimal.RequireFromString("1.2349")},
+			quantity: "12",
+			price:    "1.2345",
+		},
+		{
+			name:    "market buy rounded down to the quote precision",
+			rules:   foo,
+			request: OrderRequest{Type: OrderTypeMarket, QuoteOrderQty: decimal.RequireFromString("100.123456")},
+			quote:   "100.1234",
+		},
+		{
+			name:     "market sell without a notional",
+			rules:    foo,
+			request:  OrderRequest{Type: OrderTypeMarket, Quantity: decimal.RequireFromString("0.019")},
+			quantity: "0.01",
+		},
+		{
+			name:    "below the min notional",
+			rules:   foo,
+			request: OrderRequest{Type: OrderTypeLimit, Quantity: decimal.RequireFromString("4"), Price: decimal.RequireFromString("1.2")},
+			err:     true,
+		},
+		{
+			name:    "below the min notional once rounded",
+			rules:   bar,
+			request: OrderRequest{Type: OrderTypeLimit, Quantity: decimal.RequireFromString("10.2"), Price: decimal.RequireFromString("0.99")},
+			err:     true,
+		},
+		{
+			name:    "market buy below the min notional",
+			rules:   foo,
+			request: OrderRequest{Type: OrderTypeMarket, QuoteOrderQty: decimal.RequireFromString("4.99")},
+			err:     true,
+		},
+		{
+			name:    "above the max market notional",
+			rules:   foo,
+			request: OrderRequest{Type: OrderTypeMarket, QuoteOrderQty: decimal.RequireFromString("150000")},
+			err:     true,
+		},
+		{
+			name:    "rounds to zero",
+			rules:   foo,
+			request: OrderRequest{Type: OrderTypeMarket, Quantity: decimal.RequireFromString("0.009")},
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := test.rules.Apply(test.request)
+			if test.err {
+				if !errors.Is(err, ErrSymbolRules) {
+					t.Errorf("err = %v, want %v", err, ErrSymbolRules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := OrderRequest{
+				Quantity:      decimal.RequireFromString(orZero(test.quantity)),
+				Price:         decimal.RequireFromString(orZero(test.price)),
+				QuoteOrderQty: decimal.RequireFromString(orZero(test.quote)),
+			}
+			if !request.Quantity.Equal(want.Quantity) || !request.Price.Equal(want.Price) || !request.QuoteOrderQty.Equal(want.QuoteOrderQty) {
+				t.Errorf("request = %v at %v for %v, want %v at %v for %v", request.Quantity, request.Price, request.QuoteOrderQty, want.Quantity, want.Price, want.QuoteOrderQty)
+			}
+		})
+	}
+}
+
+func orZero(value string) string {
+	if value == "" {
+		return "0"
+	}
+	return value
+}
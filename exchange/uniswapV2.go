@@ -0,0 +1,134 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// ChainClient is what the on-chain trading needs from a node.
+// An *ethclient.Client implements it, the tests use a fake node with V2 pairs behind a router.
+type ChainClient interface {
+	ethereum.ContractCaller
+	ethereum.GasPricer
+	ethereum.GasEstimator
+	ethereum.TransactionSender
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+}
+
+var ErrNoLiquidity = errors.New("no liquidity for the swap")
+
+const uniswapV2RouterABI = `[
+	{"name":"getAmountsOut","type":"function","stateMutability":"view",
+	 "inputs":[{"name":"amountIn","type":"uint256"},{"name":"path","type":"address[]"}],
+	 "outputs":[{"name":"amounts","type":"uint256[]"}]},
+	{"name":"swapExactETHForTokens","type":"function","stateMutability":"payable",
+	 "inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],
+	 "outputs":[{"name":"amounts","type":"uint256[]"}]},
+	{"name":"swapExactTokensForETH","type":"function","stateMutability":"nonpayable",
+	 "inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],
+	 "outputs":[{"name":"amounts","type":"uint256[]"}]}
+]`
+
+// UniswapV2Router talks to a Uniswap V2 compatible router, like PancakeSwap on BSC or QuickSwap on Polygon
+type UniswapV2Router struct {
+	client  ChainClient
+	address common.Address
+	abi     abi.ABI
+}
+
+func NewUniswapV2Router(client ChainClient, address common.Address) (*UniswapV2Router, error) {
+	routerABI, err := abi.JSON(strings.NewReader(uniswapV2RouterABI))
+	if err != nil {
+		return nil, err
+	}
+
+	return &UniswapV2Router{client: client, address: address, abi: routerABI}, nil
+}
+
+func (r *UniswapV2Router) Address() common.Address {
+	return r.address
+}
+
+// GetAmountsOut returns the amounts out of every hop of the path for amountIn
+func (r *UniswapV2Router) GetAmountsOut(ctx context.Context, amountIn *big.Int, path []common.Address) ([]*big.Int, error) {
+	var amounts []*big.Int
+
+	err := callContract(ctx, r.client, r.abi, r.address, &amounts, "getAmountsOut", amountIn, path)
+	if err != nil {
+		// the router reverts when a pair of the path has no reserves yet
+		return nil, fmt.Errorf("%w: getAmountsOut failed: %v", ErrNoLiquidity, err)
+	}
+
+	if len(amounts) != len(path) || amounts[len(amounts)-1].Sign() == 0 {
+		return nil, ErrNoLiquidity
+	}
+
+	return amounts, nil
+}
+
+// SwapExactETHForTokens packs the buy of the tokens of the path with the value of the transaction
+func (r *UniswapV2Router) SwapExactETHForTokens(amountOutMin *big.Int, path []common.Address, to common.Address, deadline *big.Int) ([]byte, error) {
+	return r.abi.Pack("swapExactETHForTokens", amountOutMin, path, to, deadline)
+}
+
+// SwapExactTokensForETH packs the sell of amountIn tokens, the router must be allowed to spend them
+func (r *UniswapV2Router) SwapExactTokensForETH(amountIn *big.Int, amountOutMin *big.Int, path []common.Address, to common.Address, deadline *big.Int) ([]byte, error) {
+	return r.abi.Pack("swapExactTokensForETH", amountIn, amountOutMin, path, to, deadline)
+}
+
+// minAmountOut takes the slippage tolerance off the quoted amount, in basis points so the big ints stay exact
+func minAmountOut(quoted *big.Int, slippagePercent float64) *big.Int {
+	basisPoints := int64(math.Round(slippagePercent * 100))
+	if basisPoints < 0 {
+		basisPoints = 0
+	}
+	if basisPoints > 10000 {
+		basisPoints = 10000
+	}
+
+	minOut := new(big.Int).Mul(quoted, big.NewInt(10000-basisPoints))
+	return minOut.Quo(minOut, big.NewInt(10000))
+}
+
+// callContract calls a view method of the contract and unpacks its outputs into result
+func callContract(ctx context.Context, client ChainClient, contractABI abi.ABI, address common.Address, result interface{}, method string, args ...interface{}) error {
+	output, err := callContractRaw(ctx, client, contractABI, address, method, args...)
+	if err != nil {
+		return err
+	}
+
+	return contractABI.UnpackIntoInterface(result, method, output)
+}
+
+// callContractOutputs calls a method of the contract without sending a transaction and returns all its outputs
+func callContractOutputs(ctx context.Context, client ChainClient, contractABI abi.ABI, address common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	output, err := callContractRaw(ctx, client, contractABI, address, method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return contractABI.Unpack(method, output)
+}
+
+func callContractRaw(ctx context.Context, client ChainClient, contractABI abi.ABI, address common.Address, method string, args ...interface{}) ([]byte, error) {
+	input, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: input}, nil)
+}
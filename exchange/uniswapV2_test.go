@@ -0,0 +1,418 @@
+package exchange
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	testRouter = common.HexToAddress("0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D")
+	testWETH   = common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	testToken  = common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	// 10 WETH against 20000 tokens of 6 decimals
+	testWETHReserve = new(big.Int).Mul(big.NewInt(10), big.NewInt(1e18))
+)
+
+type pairKey struct {
+	a common.Address
+	b common.Address
+}
+
+// fakeChain is a node with V2 pairs behind a router and ERC20 tokens, the sent transactions only change the allowances
+type fakeChain struct {
+	t         *testing.T
+	chainID   *big.Int
+	routerABI abi.ABI
+	tokenABI  abi.ABI
+
+	mu         sync.Mutex
+	reserves   map[pairKey][2]*big.Int
+	decimals   map[common.Address]uint8
+	allowances map[common.Address]*big.Int
+	sent       []*types.Transaction
+	// sendErr is returned by the next send, which does not reach the pool
+	sendErr error
+}
+
+func newFakeChain(t *testing.T, chainID int64) *fakeChain {
+	routerABI, err := abi.JSON(strings.NewReader(uniswapV2RouterABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenABI, err := abi.JSON(strings.NewReader(erc20ABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fakeChain{
+		t:          t,
+		chainID:    big.NewInt(chainID),
+		routerABI:  routerABI,
+		tokenABI:   tokenABI,
+		reserves:   map[pairKey][2]*big.Int{},
+		decimals:   map[common.Address]uint8{},
+		allowances: map[common.Address]*big.Int{},
+	}
+}
+
+func (c *fakeChain) addPair(a common.Address, b common.Address, reserveA *big.Int, reserveB *big.Int) {
+	c.reserves[pairKey{a, b}] = [2]*big.Int{reserveA, reserveB}
+	c.reserves[pairKey{b, a}] = [2]*big.Int{reserveB, reserveA}
+}
+
+// amountOut is the constant product with the 0.3% fee of the V2 pairs
+func (c *fakeChain) amountOut(amountIn *big.Int, tokenIn common.Address, tokenOut common.Address) (*big.Int, error) {
+	reserves, ok := c.reserves[pairKey{tokenIn, tokenOut}]
+	if !ok || reserves[0].Sign() == 0 || reserves[1].Sign() == 0 {
+		return nil, errors.New("execution reverted: UniswapV2Library: INSUFFICIENT_LIQUIDITY")
+	}
+
+	amountInWithFee := new(big.Int).Mul(amountIn, big.NewInt(997))
+	numerator := new(big.Int).Mul(amountInWithFee, reserves[1])
+	denominator := new(big.Int).Add(new(big.Int).Mul(reserves[0], big.NewInt(1000)), amountInWithFee)
+	return numerator.Quo(numerator, denominator), nil
+}
+
+func (c *fakeChain) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if *msg.To == testRouter {
+		method, err := c.routerABI.MethodById(msg.Data[:4])
+		if err != nil {
+			return nil, err
+		}
+		args, err := method.Inputs.Unpack(msg.Data[4:])
+		if err != nil {
+			return nil, err
+		}
+
+		amount := args[0].(*big.Int)
+		path := args[1].([]common.Address)
+		amounts := []*big.Int{amount}
+		for i := 0; i < len(path)-1; i++ {
+			amount, err = c.amountOut(amount, path[i], path[i+1])
+			if err != nil {
+				return nil, err
+			}
+			amounts = append(amounts, amount)
+		}
+		return method.Outputs.Pack(amounts)
+	}
+
+	method, err := c.tokenABI.MethodById(msg.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	args, err := method.Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	switch method.Name {
+	case "decimals":
+		return method.Outputs.Pack(c.decimals[*msg.To])
+	case "allowance":
+		allowance, ok := c.allowances[args[1].(common.Address)]
+		if !ok {
+			allowance = big.NewInt(0)
+		}
+		return method.Outputs.Pack(allowance)
+	}
+	return nil, errors.New("execution reverted")
+}
+
+func (c *fakeChain) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.sendErr; err != nil {
+		c.sendErr = nil
+		return err
+	}
+
+	if _, err := types.Sender(types.NewLondonSigner(c.chainID), tx); err != nil {
+		c.t.Errorf("badly signed transaction: %v", err)
+	}
+
+	if method, err := c.tokenABI.MethodById(tx.Data()[:4]); err == nil && method.Name == "approve" {
+		args, err := method.Inputs.Unpack(tx.Data()[4:])
+		if err != nil {
+			return err
+		}
+		c.allowances[args[0].(common.Address)] = args[1].(*big.Int)
+	}
+
+	c.sent = append(c.sent, tx)
+	return nil
+}
+
+func (c *fakeChain) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return uint64(len(c.sent)), nil
+}
+
+func (c *fakeChain) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(5e9), nil
+}
+
+func (c *fakeChain) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1e9), nil
+}
+
+func (c *fakeChain) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return 150000, nil
+}
+
+// HeaderByNumber has no base fee, the transactions are legacy ones
+func (c *fakeChain) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{}, nil
+}
+
+func (c *fakeChain) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return &ethereum.FeeHistory{}, nil
+}
+
+func (c *fakeChain) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	return nil, false, ethereum.NotFound
+}
+
+func (c *fakeChain) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return nil, ethereum.NotFound
+}
+
+func (c *fakeChain) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return 0, nil
+}
+
+// decodeRouterCall returns the method and the arguments of a transaction to the router
+func (c *fakeChain) decodeRouterCall(tx *types.Transaction) (string, []interface{}) {
+	c.t.Helper()
+
+	method, err := c.routerABI.MethodById(tx.Data()[:4])
+	if err != nil {
+		c.t.Fatalf("not a router call: %v", err)
+	}
+	args, err := method.Inputs.Unpack(tx.Data()[4:])
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return method.Name, args
+}
+
+func newTestEthereumCompatible(t *testing.T, client *fakeChain) (*EthereumCompatible, common.Address) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Config{}
+	cfg.DEXSlippagePercent = 1
+	cfg.DEXDeadlineSeconds = 120
+	cfg.GasLimitMultiplier = 1.2
+	cfg.GasLimitFallback = 300000
+
+	e := NewEthereumCompatibleWithClient(client, hex.EncodeToString(crypto.FromECDSA(key)), int(client.chainID.Int64()),
+		DEXAddresses{Protocol: DEXProtocolV2, Router: testRouter.Hex(), WETH: testWETH.Hex()},
+		GasSettings{Strategy: GasStrategyLegacy}, cfg)
+
+	return e, crypto.PubkeyToAddress(key.PublicKey)
+}
+
+func TestGetAmountsOut(t *testing.T) {
+	client := newFakeChain(t, 1)
+	client.addPair(testWETH, testToken, testWETHReserve, big.NewInt(20000e6))
+
+	router, err := NewUniswapV2Router(client, testRouter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amounts, err := router.GetAmountsOut(context.Background(), big.NewInt(1e18), []common.Address{testWETH, testToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1e18 * 997 * 20000e6 / (10e18 * 1000 + 1e18 * 997)
+	if len(amounts) != 2 || amounts[1].Cmp(big.NewInt(1813221787)) != 0 {
+		t.Errorf("unexpected amounts %v", amounts)
+	}
+
+	_, err = router.GetAmountsOut(context.Background(), big.NewInt(1e18), []common.Address{testWETH, common.HexToAddress("0x02")})
+	if !errors.Is(err, ErrNoLiquidity) {
+		t.Errorf("expected no liquidity, got %v", err)
+	}
+}
+
+func TestMinAmountOut(t *testing.T) {
+	tests := []struct {
+		quoted   int64
+		slippage float64
+		expected int64
+	}{
+		{quoted: 10000, slippage: 1, expected: 9900},
+		{quoted: 10000, slippage: 0, expected: 10000},
+		// rounded down so the min out never asks for more than the tolerance allows
+		{quoted: 999, slippage: 0.5, expected: 994},
+		{quoted: 1, slippage: 1, expected: 0},
+		// the tolerance is rounded to basis points
+		{quoted: 1000000, slippage: 0.333, expected: 996700},
+		{quoted: 10000, slippage: -5, expected: 10000},
+		{quoted: 10000, slippage: 150, expected: 0},
+	}
+
+	for _, test := range tests {
+		got := minAmountOut(big.NewInt(test.quoted), test.slippage)
+		if got.Cmp(big.NewInt(test.expected)) != 0 {
+			t.Errorf("minAmountOut(%d, %v) = %v, expected %d", test.quoted, test.slippage, got, test.expected)
+		}
+	}
+}
+
+func TestBuySwapsExactETHForTokens(t *testing.T) {
+	client := newFakeChain(t, 1001)
+	client.addPair(testWETH, testToken, testWETHReserve, big.NewInt(20000e6))
+	e, own := newTestEthereumCompatible(t, client)
+
+	_, err := e.Buy(context.Background(), SwapRequest{Token: testToken.Hex(), AmountIn: decimal.RequireFromString("1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.sent) != 1 {
+		t.Fatalf("expected one transaction, got %d", len(client.sent))
+	}
+
+	tx := client.sent[0]
+	if *tx.To() != testRouter || tx.Value().Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("unexpected transaction to %s with value %v", tx.To().Hex(), tx.Value())
+	}
+	if tx.Gas() != 180000 {
+		t.Errorf("expected the estimate with its margin, got %d", tx.Gas())
+	}
+
+	method, args := client.decodeRouterCall(tx)
+	if method != "swapExactETHForTokens" {
+		t.Fatalf("unexpected method %s", method)
+	}
+
+	// 1% off the quote of 1813221787
+	if args[0].(*big.Int).Cmp(big.NewInt(1795089569)) != 0 {
+		t.Errorf("unexpected min out %v", args[0])
+	}
+	path := args[1].([]common.Address)
+	if len(path) != 2 || path[0] != testWETH || path[1] != testToken {
+		t.Errorf("unexpected path %v", path)
+	}
+	if args[2].(common.Address) != own {
+		t.Errorf("unexpected recipient %s", args[2].(common.Address).Hex())
+	}
+}
+
+func TestSellApprovesThenSwapsExactTokensForETH(t *testing.T) {
+	client := newFakeChain(t, 1002)
+	client.addPair(testWETH, testToken, testWETHReserve, big.NewInt(20000e6))
+	client.decimals[testToken] = 6
+	e, _ := newTestEthereumCompatible(t, client)
+
+	_, err := e.Sell(context.Background(), SwapRequest{Token: testToken.Hex(), AmountIn: decimal.RequireFromString("12.5")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.sent) != 2 {
+		t.Fatalf("expected the approval and the swap, got %d transactions", len(client.sent))
+	}
+
+	approval, swap := client.sent[0], client.sent[1]
+	if *approval.To() != testToken {
+		t.Errorf("the approval goes to %s", approval.To().Hex())
+	}
+	if approval.Nonce()+1 != swap.Nonce() {
+		t.Errorf("unexpected nonces %d and %d", approval.Nonce(), swap.Nonce())
+	}
+
+	allowance := client.allowances[testRouter]
+	if allowance == nil || allowance.Cmp(big.NewInt(12500000)) != 0 {
+		t.Errorf("unexpected allowance of the router %v", allowance)
+	}
+
+	method, args := client.decodeRouterCall(swap)
+	if method != "swapExactTokensForETH" {
+		t.Fatalf("unexpected method %s", method)
+	}
+	if args[0].(*big.Int).Cmp(big.NewInt(12500000)) != 0 {
+		t.Errorf("unexpected amount in %v", args[0])
+	}
+	path := args[2].([]common.Address)
+	if len(path) != 2 || path[0] != testToken || path[1] != testWETH {
+		t.Errorf("unexpected path %v", path)
+	}
+
+	// already allowed, the second sell swaps right away
+	_, err = e.Sell(context.Background(), SwapRequest{Token: testToken.Hex(), AmountIn: decimal.RequireFromString("12.5")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.sent) != 3 {
+		t.Fatalf("expected a single swap, got %d transactions", len(client.sent)-2)
+	}
+	if method, _ := client.decodeRouterCall(client.sent[2]); method != "swapExactTokensForETH" {
+		t.Errorf("unexpected method %s", method)
+	}
+}
+
+func TestSwapTransactionsCarryTheirOrder(t *testing.T) {
+	client := newFakeChain(t, 1003)
+	client.addPair(testWETH, testToken, testWETHReserve, big.NewInt(20000e6))
+	client.decimals[testToken] = 6
+	e, _ := newTestEthereumCompatible(t, client)
+
+	var mu sync.Mutex
+	var events []TransactionEvent
+	Events.OnTransaction(func(event TransactionEvent) {
+		if event.ChainID != 1003 {
+			return
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+
+	_, err := e.Buy(context.Background(), SwapRequest{Token: testToken.Hex(), AmountIn: decimal.RequireFromString("1"), OrderID: "order-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = e.Sell(context.Background(), SwapRequest{Token: testToken.Hex(), AmountIn: decimal.RequireFromString("12.5"), OrderID: "order-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	kinds := []string{TransactionKindBuy, TransactionKindApprove, TransactionKindSell}
+	if len(events) != len(kinds) {
+		t.Fatalf("%d transactions published, want %d", len(events), len(kinds))
+	}
+	for i, event := range events {
+		if event.Kind != kinds[i] || event.OrderID != "order-1" {
+			t.Errorf("transaction %d = %s of %q, want %s of order-1", i, event.Kind, event.OrderID, kinds[i])
+		}
+	}
+}
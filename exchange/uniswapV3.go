@@ -0,0 +1,304 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"strings"
+)
+
+// DefaultV3FeeTiers are the pool fees looked up, in hundredths of a basis point.
+// 2500 only exists on PancakeSwap and 3000 only on Uniswap, a missing tier is skipped.
+var DefaultV3FeeTiers = []uint32{100, 500, 2500, 3000, 10000}
+
+const uniswapV3FactoryABI = `[
+	{"name":"getPool","type":"function","stateMutability":"view",
+	 "inputs":[{"name":"tokenA","type":"address"},{"name":"tokenB","type":"address"},{"name":"fee","type":"uint24"}],
+	 "outputs":[{"name":"pool","type":"address"}]}
+]`
+
+// QuoterV2, its quotes revert on chain so they are only ever called
+const uniswapV3QuoterABI = `[
+	{"name":"quoteExactInputSingle","type":"function","stateMutability":"nonpayable",
+	 "inputs":[{"name":"params","type":"tuple","components":[
+		{"name":"tokenIn","type":"address"},{"name":"tokenOut","type":"address"},{"name":"amountIn","type":"uint256"},
+		{"name":"fee","type":"uint24"},{"name":"sqrtPriceLimitX96","type":"uint160"}]}],
+	 "outputs":[{"name":"amountOut","type":"uint256"},{"name":"sqrtPriceX96After","type":"uint160"},
+		{"name":"initializedTicksCrossed","type":"uint32"},{"name":"gasEstimate","type":"uint256"}]},
+	{"name":"quoteExactInput","type":"function","stateMutability":"nonpayable",
+	 "inputs":[{"name":"path","type":"bytes"},{"name":"amountIn","type":"uint256"}],
+	 "outputs":[{"name":"amountOut","type":"uint256"},{"name":"sqrtPriceX96AfterList","type":"uint160[]"},
+		{"name":"initializedTicksCrossedList","type":"uint32[]"},{"name":"gasEstimate","type":"uint256"}]}
+]`
+
+// SwapRouter of the V3 periphery, the one with a deadline in the params
+const uniswapV3RouterABI = `[
+	{"name":"exactInputSingle","type":"function","stateMutability":"payable",
+	 "inputs":[{"name":"params","type":"tuple","components":[
+		{"name":"tokenIn","type":"address"},{"name":"tokenOut","type":"address"},{"name":"fee","type":"uint24"},
+		{"name":"recipient","type":"address"},{"name":"deadline","type":"uint256"},{"name":"amountIn","type":"uint256"},
+		{"name":"amountOutMinimum","type":"uint256"},{"name":"sqrtPriceLimitX96","type":"uint160"}]}],
+	 "outputs":[{"name":"amountOut","type":"uint256"}]},
+	{"name":"exactInput","type":"function","stateMutability":"payable",
+	 "inputs":[{"name":"params","type":"tuple","components":[
+		{"name":"path","type":"bytes"},{"name":"recipient","type":"address"},{"name":"deadline","type":"uint256"},
+		{"name":"amountIn","type":"uint256"},{"name":"amountOutMinimum","type":"uint256"}]}],
+	 "outputs":[{"name":"amountOut","type":"uint256"}]},
+	{"name":"unwrapWETH9","type":"function","stateMutability":"payable",
+	 "inputs":[{"name":"amountMinimum","type":"uint256"},{"name":"recipient","type":"address"}],"outputs":[]},
+	{"name":"multicall","type":"function","stateMutability":"payable",
+	 "inputs":[{"name":"data","type":"bytes[]"}],"outputs":[{"name":"results","type":"bytes[]"}]}
+]`
+
+type v3QuoteSingleParams struct {
+	TokenIn           common.Address
+	TokenOut          common.Address
+	AmountIn          *big.Int
+	Fee               *big.Int
+	SqrtPriceLimitX96 *big.Int
+}
+
+type v3ExactInputSingleParams struct {
+	TokenIn           common.Address
+	TokenOut          common.Address
+	Fee               *big.Int
+	Recipient         common.Address
+	Deadline          *big.Int
+	AmountIn          *big.Int
+	AmountOutMinimum  *big.Int
+	SqrtPriceLimitX96 *big.Int
+}
+
+type v3ExactInputParams struct {
+	Path             []byte
+	Recipient        common.Address
+	Deadline         *big.Int
+	AmountIn         *big.Int
+	AmountOutMinimum *big.Int
+}
+
+// V3Route is a path of pools with the amount the quoter expects out of it
+type V3Route struct {
+	Tokens    []common.Address
+	Fees      []uint32
+	AmountOut *big.Int
+}
+
+// EncodeV3Path packs the tokens and the fees between them like the V3 contracts expect,
+// 20 bytes of token then 3 bytes of fee for every hop
+func EncodeV3Path(tokens []common.Address, fees []uint32) ([]byte, error) {
+	if len(tokens) < 2 || len(fees) != len(tokens)-1 {
+		return nil, fmt.Errorf("a path of %d tokens needs %d fees, got %d", len(tokens), len(tokens)-1, len(fees))
+	}
+
+	path := make([]byte, 0, len(tokens)*common.AddressLength+len(fees)*3)
+	for i, token := range tokens {
+		path = append(path, token.Bytes()...)
+		if i < len(fees) {
+			if fees[i] >= 1<<24 {
+				return nil, fmt.Errorf("invalid fee %d", fees[i])
+			}
+			path = append(path, byte(fees[i]>>16), byte(fees[i]>>8), byte(fees[i]))
+		}
+	}
+
+	return path, nil
+}
+
+// UniswapV3 finds the pools through the factory, quotes them through the quoter and swaps through the router
+type UniswapV3 struct {
+	client     ChainClient
+	router     common.Address
+	factory    common.Address
+	quoter     common.Address
+	routerABI  abi.ABI
+	factoryABI abi.ABI
+	quoterABI  abi.ABI
+}
+
+func NewUniswapV3(client ChainClient, router common.Address, factory common.Address, quoter common.Address) (*UniswapV3, error) {
+	routerABI, err := abi.JSON(strings.NewReader(uniswapV3RouterABI))
+	if err != nil {
+		return nil, err
+	}
+
+	factoryABI, err := abi.JSON(strings.NewReader(uniswapV3FactoryABI))
+	if err != nil {
+		return nil, err
+	}
+
+	quoterABI, err := abi.JSON(strings.NewReader(uniswapV3QuoterABI))
+	if err != nil {
+		return nil, err
+	}
+
+	return &UniswapV3{
+		client:     client,
+		router:     router,
+		factory:    factory,
+		quoter:     quoter,
+		routerABI:  routerABI,
+		factoryABI: factoryABI,
+		quoterABI:  quoterABI,
+	}, nil
+}
+
+func (u *UniswapV3) Address() common.Address {
+	return u.router
+}
+
+// GetPool returns the pool of the pair for the fee, the zero address when there is none
+func (u *UniswapV3) GetPool(ctx context.Context, tokenA common.Address, tokenB common.Address, fee uint32) (common.Address, error) {
+	var pool common.Address
+	err := callContract(ctx, u.client, u.factoryABI, u.factory, &pool, "getPool", tokenA, tokenB, big.NewInt(int64(fee)))
+	return pool, err
+}
+
+// QuoteExactInputSingle returns what swapping amountIn through the pool of the fee gives
+func (u *UniswapV3) QuoteExactInputSingle(ctx context.Context, tokenIn common.Address, tokenOut common.Address, fee uint32, amountIn *big.Int) (*big.Int, error) {
+	outputs, err := callContractOutputs(ctx, u.client, u.quoterABI, u.quoter, "quoteExactInputSingle", v3QuoteSingleParams{
+		TokenIn:           tokenIn,
+		TokenOut:          tokenOut,
+		AmountIn:          amountIn,
+		Fee:               big.NewInt(int64(fee)),
+		SqrtPriceLimitX96: big.NewInt(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return firstAmount(outputs)
+}
+
+// QuoteExactInput returns what swapping amountIn along the encoded path gives
+func (u *UniswapV3) QuoteExactInput(ctx context.Context, path []byte, amountIn *big.Int) (*big.Int, error) {
+	outputs, err := callContractOutputs(ctx, u.client, u.quoterABI, u.quoter, "quoteExactInput", path, amountIn)
+	if err != nil {
+		return nil, err
+	}
+	return firstAmount(outputs)
+}
+
+// BestFee looks for the pools of the pair in every fee tier and returns the one giving the most out of amountIn
+func (u *UniswapV3) BestFee(ctx context.Context, tokenIn common.Address, tokenOut common.Address, amountIn *big.Int, feeTiers []uint32) (uint32, *big.Int, error) {
+	var bestFee uint32
+	var bestOut *big.Int
+
+	for _, fee := range feeTiers {
+		pool, err := u.GetPool(ctx, tokenIn, tokenOut, fee)
+		if err != nil {
+			return 0, nil, fmt.Errorf("getPool failed: %v", err)
+		}
+		if pool == (common.Address{}) {
+			continue
+		}
+
+		// a pool without liquidity in range makes the quoter revert
+		amountOut, err := u.QuoteExactInputSingle(ctx, tokenIn, tokenOut, fee, amountIn)
+		if err != nil || amountOut.Sign() == 0 {
+			continue
+		}
+
+		if bestOut == nil || amountOut.Cmp(bestOut) > 0 {
+			bestFee, bestOut = fee, amountOut
+		}
+	}
+
+	if bestOut == nil {
+		return 0, nil, fmt.Errorf("%w: no V3 pool for %s and %s", ErrNoLiquidity, tokenIn.Hex(), tokenOut.Hex())
+	}
+
+	return bestFee, bestOut, nil
+}
+
+// Route picks the best fee tier of every hop of the tokens, hop after hop with what the previous one gives,
+// then quotes the whole path
+func (u *UniswapV3) Route(ctx context.Context, tokens []common.Address, amountIn *big.Int, feeTiers []uint32) (V3Route, error) {
+	route := V3Route{Tokens: tokens}
+	amount := amountIn
+
+	for i := 0; i < len(tokens)-1; i++ {
+		fee, amountOut, err := u.BestFee(ctx, tokens[i], tokens[i+1], amount, feeTiers)
+		if err != nil {
+			return route, err
+		}
+		route.Fees = append(route.Fees, fee)
+		amount = amountOut
+	}
+
+	if len(route.Fees) == 1 {
+		route.AmountOut = amount
+		return route, nil
+	}
+
+	path, err := EncodeV3Path(route.Tokens, route.Fees)
+	if err != nil {
+		return route, err
+	}
+
+	route.AmountOut, err = u.QuoteExactInput(ctx, path, amountIn)
+	if err != nil {
+		return route, fmt.Errorf("%w: quoteExactInput failed: %v", ErrNoLiquidity, err)
+	}
+
+	return route, nil
+}
+
+// Swap packs the swap of amountIn along the route, a single pool goes through exactInputSingle
+func (u *UniswapV3) Swap(route V3Route, amountIn *big.Int, amountOutMin *big.Int, recipient common.Address, deadline *big.Int) ([]byte, error) {
+	if len(route.Fees) == 1 {
+		return u.routerABI.Pack("exactInputSingle", v3ExactInputSingleParams{
+			TokenIn:           route.Tokens[0],
+			TokenOut:          route.Tokens[1],
+			Fee:               big.NewInt(int64(route.Fees[0])),
+			Recipient:         recipient,
+			Deadline:          deadline,
+			AmountIn:          amountIn,
+			AmountOutMinimum:  amountOutMin,
+			SqrtPriceLimitX96: big.NewInt(0),
+		})
+	}
+
+	path, err := EncodeV3Path(route.Tokens, route.Fees)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.routerABI.Pack("exactInput", v3ExactInputParams{
+		Path:             path,
+		Recipient:        recipient,
+		Deadline:         deadline,
+		AmountIn:         amountIn,
+		AmountOutMinimum: amountOutMin,
+	})
+}
+
+// SwapToNative packs the swap of the route ending on the wrapped native coin followed by its unwrap to the recipient,
+// the router keeps the wrapped coins in between
+func (u *UniswapV3) SwapToNative(route V3Route, amountIn *big.Int, amountOutMin *big.Int, recipient common.Address, deadline *big.Int) ([]byte, error) {
+	swap, err := u.Swap(route, amountIn, amountOutMin, u.router, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	unwrap, err := u.routerABI.Pack("unwrapWETH9", amountOutMin, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.routerABI.Pack("multicall", [][]byte{swap, unwrap})
+}
+
+func firstAmount(outputs []interface{}) (*big.Int, error) {
+	if len(outputs) == 0 {
+		return nil, errors.New("empty quote")
+	}
+
+	amount, ok := outputs[0].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("unexpected quote %T", outputs[0])
+	}
+	return amount, nil
+}
@@ -3,6 +3,7 @@ package migrate
 import (
 	"NewListingBot/database"
 	"NewListingBot/models"
+	"gorm.io/gorm"
 	"log"
 )
 
@@ -16,9 +17,45 @@ func MigrateDatabase() {
 	// Migrate the models
 	err := db.AutoMigrate(
 		&models.Order{},
+		&models.ScheduledJob{},
+		&models.OrderEvent{},
+		&models.SymbolSnapshot{},
+		&models.OrderFill{},
+		&models.ChainTransaction{},
 	)
 	if err != nil {
 		log.Println(err)
 	}
 
+	err = backfillOrderStatus(db)
+	if err != nil {
+		log.Println("error backfilling order status", err)
+	}
+}
+
+// backfillOrderStatus moves the bought and sold flags the orders had before the status into it, then drops them.
+// Nothing happens once they are gone.
+func backfillOrderStatus(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&models.Order{}, "bought") || !migrator.HasColumn(&models.Order{}, "sold") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Order{}).Where("sold = ?", true).Update("status", models.StatusSold).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.Order{}).Where("bought = ? AND (sold IS NULL OR sold = ?)", true, false).
+			Update("status", models.StatusBought).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().DropColumn(&models.Order{}, "bought"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Order{}, "sold")
+	})
 }
@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"NewListingBot/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// legacyOrder is an order as saved before the status, with its bought and sold flags
+type legacyOrder struct {
+	models.BaseModel
+	Bought *bool
+	Sold   *bool
+}
+
+func (legacyOrder) TableName() string {
+	return "orders"
+}
+
+func TestBackfillOrderStatus(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.AutoMigrate(&legacyOrder{}); err != nil {
+		t.Fatal(err)
+	}
+
+	yes, no := true, false
+	legacy := []legacyOrder{
+		{Bought: &no, Sold: &no},
+		{Bought: &yes, Sold: &no},
+		{Bought: &yes},
+		{Bought: &yes, Sold: &yes},
+	}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.AutoMigrate(&models.Order{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := backfillOrderStatus(db); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.OrderStatus{models.StatusPending, models.StatusBought, models.StatusBought, models.StatusSold}
+	for i, order := range legacy {
+		var migrated models.Order
+		if err := db.Model(&models.Order{}).Where("id = ?", order.ID).First(&migrated).Error; err != nil {
+			t.Fatal(err)
+		}
+		if migrated.Status != want[i] {
+			t.Errorf("order %d = %s, want %s", i, migrated.Status, want[i])
+		}
+	}
+
+	if db.Migrator().HasColumn(&models.Order{}, "bought") || db.Migrator().HasColumn(&models.Order{}, "sold") {
+		t.Error("the flags are still there")
+	}
+
+	// the second run finds nothing to do
+	if err := backfillOrderStatus(db); err != nil {
+		t.Fatal(err)
+	}
+}
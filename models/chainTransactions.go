@@ -0,0 +1,307 @@
+package models
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/exchange"
+	"NewListingBot/logger"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type ChainTransactionStatus string
+
+const (
+	ChainTxPending  ChainTransactionStatus = exchange.TransactionPending
+	ChainTxMined    ChainTransactionStatus = exchange.TransactionMined
+	ChainTxReverted ChainTransactionStatus = exchange.TransactionReverted
+	ChainTxDropped  ChainTransactionStatus = exchange.TransactionDropped
+	ChainTxReplaced ChainTransactionStatus = exchange.TransactionReplaced
+)
+
+// timeout actions of the tracker
+const (
+	ChainTxActionSpeedUp = "speed_up"
+	ChainTxActionCancel  = "cancel"
+	ChainTxActionNone    = "none"
+)
+
+// droppedGrace is how long a transaction missing from the node is given to reach it before it is dropped
+const droppedGrace = time.Minute
+
+// ChainTransaction is a transaction we broadcast on a chain, the replacements of a stuck one share its nonce
+type ChainTransaction struct {
+	BaseModel
+	OrderID           *uuid.UUID             `json:"order_id" gorm:"type:uuid;index"`
+	ChainID           int                    `json:"chain_id" gorm:"index:idx_chain_tx_nonce"`
+	Hash              string                 `json:"hash" gorm:"uniqueIndex"`
+	Kind              string                 `json:"kind"`
+	FromAddress       string                 `json:"from_address" gorm:"index:idx_chain_tx_nonce"`
+	ToAddress         string                 `json:"to_address"`
+	Nonce             uint64                 `json:"nonce" gorm:"index:idx_chain_tx_nonce"`
+	Value             string                 `json:"value"`
+	Status            ChainTransactionStatus `json:"status" gorm:"default:pending;index"`
+	BlockNumber       *uint64                `json:"block_number"`
+	GasUsed           *uint64                `json:"gas_used"`
+	EffectiveGasPrice *string                `json:"effective_gas_price"`
+	Replaces          *string                `json:"replaces"`
+	ReplacedBy        *string                `json:"replaced_by"`
+	SentTime          time.Time              `json:"sent_time"`
+	SettledTime       *time.Time             `json:"settled_time"`
+}
+
+// chainForID resolves the chain a transaction was sent on, it is a variable so fakes can be swapped in
+var chainForID = func(chainID int) (exchange.EthereumCompatibleInstance, error) {
+	return exchange.EthereumCompatibleForChain(chainID)
+}
+
+// ListenChainTransactions records the transactions broadcast on the chains so the tracker follows them
+func ListenChainTransactions(db *gorm.DB) {
+	exchange.Events.OnTransaction(func(event exchange.TransactionEvent) {
+		err := recordChainTransaction(context.Background(), db, event)
+		if err != nil {
+			logger.Error(context.Background(), "error recording chain transaction", zap.String("hash", event.Hash), zap.Error(err))
+		}
+	})
+}
+
+// recordChainTransaction saves a broadcast transaction, a replacement belongs to the order of the one it replaces
+func recordChainTransaction(ctx context.Context, db *gorm.DB, event exchange.TransactionEvent) error {
+	tx := ChainTransaction{
+		ChainID:     event.ChainID,
+		Hash:        event.Hash,
+		Kind:        event.Kind,
+		FromAddress: event.From,
+		ToAddress:   event.To,
+		Nonce:       event.Nonce,
+		Value:       event.Value,
+		Status:      ChainTxPending,
+		SentTime:    event.Time,
+	}
+
+	if orderID, err := uuid.Parse(event.OrderID); err == nil {
+		tx.OrderID = &orderID
+	}
+
+	if event.Replaces != "" {
+		tx.Replaces = &event.Replaces
+
+		var replaced ChainTransaction
+		err := db.WithContext(ctx).Model(&ChainTransaction{}).Where("hash = ?", event.Replaces).First(&replaced).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && tx.OrderID == nil {
+			tx.OrderID = replaced.OrderID
+		}
+	}
+
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&tx).Error
+}
+
+// GetOrderTransactions returns the transactions sent for the order, oldest first
+func GetOrderTransactions(ctx context.Context, db *gorm.DB, orderID uuid.UUID) ([]ChainTransaction, error) {
+	var transactions []ChainTransaction
+
+	err := db.WithContext(ctx).Model(&ChainTransaction{}).Where("order_id = ?", orderID).
+		Order("sent_time asc").Find(&transactions).Error
+
+	return transactions, err
+}
+
+// TransactionTracker polls the node for the pending transactions until they are mined, reverted, dropped or replaced,
+// and speeds up or cancels the ones stuck for longer than the timeout
+type TransactionTracker struct {
+	db              *gorm.DB
+	ctx             context.Context
+	interval        time.Duration
+	timeout         time.Duration
+	action          string
+	maxReplacements int
+}
+
+var transactionTracker *TransactionTracker
+
+func NewTransactionTracker(ctx context.Context, db *gorm.DB, cfg config.Config) *TransactionTracker {
+	interval := time.Duration(cfg.TransactionTrackerIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	action := cfg.TransactionTrackerTimeoutAction
+	if action == "" {
+		action = ChainTxActionNone
+	}
+
+	return &TransactionTracker{
+		db:              db,
+		ctx:             ctx,
+		interval:        interval,
+		timeout:         time.Duration(cfg.TransactionTrackerTimeoutSeconds) * time.Second,
+		action:          action,
+		maxReplacements: cfg.TransactionTrackerMaxReplacements,
+	}
+}
+
+// StartTransactionTracker starts the shared tracker, the transactions still pending from before a restart are picked up
+// on its first poll and everything stops with the context
+func StartTransactionTracker(ctx context.Context, db *gorm.DB, cfg config.Config) *TransactionTracker {
+	transactionTracker = NewTransactionTracker(ctx, db, cfg)
+
+	go func() {
+		ticker := time.NewTicker(transactionTracker.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				transactionTracker.CheckPending()
+			}
+		}
+	}()
+
+	return transactionTracker
+}
+
+// CheckPending looks up every pending transaction once
+func (t *TransactionTracker) CheckPending() {
+	var pending []ChainTransaction
+	err := t.db.WithContext(t.ctx).Model(&ChainTransaction{}).Where("status = ?", ChainTxPending).
+		Order("sent_time asc").Find(&pending).Error
+	if err != nil {
+		logger.Error(t.ctx, "error fetching pending transactions", zap.Error(err))
+		return
+	}
+
+	for _, tx := range pending {
+		if t.ctx.Err() != nil {
+			return
+		}
+
+		err := t.check(tx)
+		if err != nil {
+			logger.Error(t.ctx, "error checking transaction", zap.String("hash", tx.Hash), zap.Error(err))
+		}
+	}
+}
+
+func (t *TransactionTracker) check(tx ChainTransaction) error {
+	chain, err := chainForID(tx.ChainID)
+	if err != nil {
+		return err
+	}
+
+	state, err := chain.TransactionState(t.ctx, tx.Hash, tx.FromAddress, tx.Nonce)
+	if err != nil {
+		return err
+	}
+
+	switch ChainTransactionStatus(state.Status) {
+	case ChainTxPending:
+		return t.handleTimeout(chain, tx)
+	case ChainTxDropped:
+		// the node it was sent to may not have passed it on yet
+		if time.Since(tx.SentTime) < droppedGrace {
+			return nil
+		}
+	}
+
+	return t.settle(tx, state)
+}
+
+// settle saves the final state of the transaction, the other transactions of its nonce are replaced by a mined one
+func (t *TransactionTracker) settle(tx ChainTransaction, state exchange.TransactionState) error {
+	now := time.Now()
+	status := ChainTransactionStatus(state.Status)
+
+	updates := map[string]interface{}{
+		"status":       status,
+		"settled_time": now,
+	}
+	if status == ChainTxMined || status == ChainTxReverted {
+		updates["block_number"] = state.BlockNumber
+		updates["gas_used"] = state.GasUsed
+		if state.EffectiveGasPrice != "" {
+			updates["effective_gas_price"] = state.EffectiveGasPrice
+		}
+	}
+
+	return t.db.WithContext(t.ctx).Transaction(func(db *gorm.DB) error {
+		err := db.Model(&ChainTransaction{}).Where("id = ? AND status = ?", tx.ID, ChainTxPending).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+
+		if status == ChainTxDropped {
+			// its nonce was never used, the next transaction must take it
+			exchange.ResyncNonce(tx.ChainID, tx.FromAddress)
+		}
+
+		if status != ChainTxMined && status != ChainTxReverted {
+			logger.Info(t.ctx, "chain transaction not mined", zap.String("hash", tx.Hash), zap.String("status", string(status)))
+			return nil
+		}
+
+		if status == ChainTxReverted {
+			logger.Info(t.ctx, "chain transaction reverted", zap.String("hash", tx.Hash), zap.String("kind", tx.Kind))
+		}
+
+		return db.Model(&ChainTransaction{}).
+			Where("chain_id = ? AND from_address = ? AND nonce = ? AND hash <> ? AND status IN ?",
+				tx.ChainID, tx.FromAddress, tx.Nonce, tx.Hash, []ChainTransactionStatus{ChainTxPending, ChainTxDropped, ChainTxReplaced}).
+			Updates(map[string]interface{}{"status": ChainTxReplaced, "replaced_by": tx.Hash, "settled_time": now}).Error
+	})
+}
+
+// handleTimeout replaces the transaction once it is stuck for longer than the timeout, unless it was already replaced
+// or its nonce reached the max replacements
+func (t *TransactionTracker) handleTimeout(chain exchange.EthereumCompatibleInstance, tx ChainTransaction) error {
+	if t.action == ChainTxActionNone || t.timeout <= 0 || time.Since(tx.SentTime) < t.timeout {
+		return nil
+	}
+
+	var sameNonce []ChainTransaction
+	err := t.db.WithContext(t.ctx).Model(&ChainTransaction{}).
+		Where("chain_id = ? AND from_address = ? AND nonce = ?", tx.ChainID, tx.FromAddress, tx.Nonce).
+		Find(&sameNonce).Error
+	if err != nil {
+		return err
+	}
+
+	for _, other := range sameNonce {
+		if other.SentTime.After(tx.SentTime) {
+			// the latest one is the one to replace
+			return nil
+		}
+	}
+	if len(sameNonce)-1 >= t.maxReplacements {
+		return nil
+	}
+
+	var replacement string
+	switch t.action {
+	case ChainTxActionSpeedUp:
+		replacement, err = chain.ReplaceTransaction(t.ctx, tx.Hash)
+	case ChainTxActionCancel:
+		replacement, err = chain.CancelTransaction(t.ctx, tx.Hash)
+	default:
+		return nil
+	}
+	if errors.Is(err, exchange.ErrTransactionNotPending) {
+		// mined in between, the next poll settles it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info(t.ctx, "stuck chain transaction replaced", zap.String("hash", tx.Hash),
+		zap.String("replacement", replacement), zap.String("action", t.action))
+	return nil
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"NewListingBot/exchange"
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeChain answers the tracker with the states set by the test, the replacements it sends are pending
+type fakeChain struct {
+	mu       sync.Mutex
+	db       *gorm.DB
+	states   map[string]exchange.TransactionState
+	replaced []string
+}
+
+func (c *fakeChain) Buy(ctx context.Context, request exchange.SwapRequest) (string, error) {
+	return "", fmt.Errorf("not supported")
+}
+
+func (c *fakeChain) Sell(ctx context.Context, request exchange.SwapRequest) (string, error) {
+	return "", fmt.Errorf("not supported")
+}
+
+func (c *fakeChain) Withdraw(tokenABI string, ownerAddress string, contractAddress string) (string, error) {
+	return "", fmt.Errorf("not supported")
+}
+
+func (c *fakeChain) ReplaceTransaction(ctx context.Context, txHash string) (string, error) {
+	return c.replace(ctx, txHash, "speed_up")
+}
+
+func (c *fakeChain) CancelTransaction(ctx context.Context, txHash string) (string, error) {
+	return c.replace(ctx, txHash, "cancel")
+}
+
+func (c *fakeChain) replace(ctx context.Context, txHash string, kind string) (string, error) {
+	var original ChainTransaction
+	if err := c.db.Model(&ChainTransaction{}).Where("hash = ?", txHash).First(&original).Error; err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.replaced = append(c.replaced, txHash)
+	replacement := fmt.Sprintf("%s-r%d", txHash, len(c.replaced))
+	c.mu.Unlock()
+
+	// the real chain publishes its replacements the same way
+	return replacement, recordChainTransaction(ctx, c.db, exchange.TransactionEvent{
+		ChainID:  original.ChainID,
+		Hash:     replacement,
+		From:     original.FromAddress,
+		To:       original.ToAddress,
+		Nonce:    original.Nonce,
+		Kind:     kind,
+		Replaces: txHash,
+		Time:     time.Now(),
+	})
+}
+
+func (c *fakeChain) TransactionState(ctx context.Context, txHash string, from string, nonce uint64) (exchange.TransactionState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, ok := c.states[txHash]; ok {
+		return state, nil
+	}
+	return exchange.TransactionState{Status: exchange.TransactionPending}, nil
+}
+
+func (c *fakeChain) setState(txHash string, state exchange.TransactionState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.states[txHash] = state
+}
+
+// useFakeChain makes the tracker follow every chain on the fake one for the test
+func useFakeChain(t *testing.T, db *gorm.DB) *fakeChain {
+	t.Helper()
+
+	chain := &fakeChain{db: db, states: map[string]exchange.TransactionState{}}
+
+	previous := chainForID
+	chainForID = func(chainID int) (exchange.EthereumCompatibleInstance, error) {
+		return chain, nil
+	}
+	t.Cleanup(func() {
+		chainForID = previous
+	})
+
+	return chain
+}
+
+func chainTransaction(t *testing.T, db *gorm.DB, hash string) ChainTransaction {
+	t.Helper()
+
+	var tx ChainTransaction
+	if err := db.Model(&ChainTransaction{}).Where("hash = ?", hash).First(&tx).Error; err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestTransactionTrackerSpeedsUpThenSettles(t *testing.T) {
+	db := newTestDB(t)
+	chain := useFakeChain(t, db)
+	order := createTestOrder(t, db, StatusBuying)
+
+	err := recordChainTransaction(context.Background(), db, exchange.TransactionEvent{
+		ChainID: 1,
+		Hash:    "0xbuy",
+		From:    "0xfrom",
+		To:      "0xrouter",
+		Nonce:   7,
+		Kind:    "buy",
+		OrderID: order.ID.String(),
+		Time:    time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracker := &TransactionTracker{
+		db:              db,
+		ctx:             context.Background(),
+		timeout:         time.Minute,
+		action:          ChainTxActionSpeedUp,
+		maxReplacements: 3,
+	}
+
+	// stuck for an hour, it gets replaced once and the replacement is not stuck yet
+	tracker.CheckPending()
+	tracker.CheckPending()
+
+	if len(chain.replaced) != 1 || chain.replaced[0] != "0xbuy" {
+		t.Fatalf("replaced = %v, want 0xbuy once", chain.replaced)
+	}
+
+	replacement := chainTransaction(t, db, "0xbuy-r1")
+	if replacement.OrderID == nil || *replacement.OrderID != order.ID || replacement.Nonce != 7 {
+		t.Errorf("replacement = %+v, want the order and the nonce of 0xbuy", replacement)
+	}
+
+	chain.setState("0xbuy-r1", exchange.TransactionState{Status: exchange.TransactionMined, BlockNumber: 100, GasUsed: 21000})
+	chain.setState("0xbuy", exchange.TransactionState{Status: exchange.TransactionReplaced})
+	tracker.CheckPending()
+
+	mined := chainTransaction(t, db, "0xbuy-r1")
+	if mined.Status != ChainTxMined || mined.BlockNumber == nil || *mined.BlockNumber != 100 {
+		t.Errorf("replacement = %s at %v, want mined at 100", mined.Status, mined.BlockNumber)
+	}
+
+	original := chainTransaction(t, db, "0xbuy")
+	if original.Status != ChainTxReplaced || original.ReplacedBy == nil || *original.ReplacedBy != "0xbuy-r1" {
+		t.Errorf("original = %s by %v, want replaced by 0xbuy-r1", original.Status, original.ReplacedBy)
+	}
+
+	transactions, err := GetOrderTransactions(context.Background(), db, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 2 {
+		t.Errorf("%d transactions for the order, want 2", len(transactions))
+	}
+}
+
+func TestTransactionTrackerWaitsBeforeDropping(t *testing.T) {
+	db := newTestDB(t)
+	chain := useFakeChain(t, db)
+
+	for hash, sent := range map[string]time.Time{"0xfresh": time.Now(), "0xold": time.Now().Add(-time.Hour)} {
+		err := recordChainTransaction(context.Background(), db, exchange.TransactionEvent{
+			ChainID: 1, Hash: hash, From: "0xfrom", Kind: "approve", Time: sent,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain.setState(hash, exchange.TransactionState{Status: exchange.TransactionDropped})
+	}
+
+	tracker := &TransactionTracker{db: db, ctx: context.Background(), action: ChainTxActionNone}
+	tracker.CheckPending()
+
+	if status := chainTransaction(t, db, "0xfresh").Status; status != ChainTxPending {
+		t.Errorf("fresh transaction = %s, want pending", status)
+	}
+	if status := chainTransaction(t, db, "0xold").Status; status != ChainTxDropped {
+		t.Errorf("old transaction = %s, want dropped", status)
+	}
+}
+
+func TestGetOrderTransactions(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	order := createTestOrder(t, db, StatusBuying)
+	other := createTestOrder(t, db, StatusBuying)
+
+	events := []exchange.TransactionEvent{
+		{ChainID: 1, Hash: "0xapprove", Nonce: 1, Kind: "approve", OrderID: order.ID.String(), Time: time.Now().Add(-2 * time.Minute)},
+		{ChainID: 1, Hash: "0xsell", Nonce: 2, Kind: "sell", OrderID: order.ID.String(), Time: time.Now().Add(-time.Minute)},
+		{ChainID: 1, Hash: "0xother", Nonce: 3, Kind: "buy", OrderID: other.ID.String(), Time: time.Now()},
+		{ChainID: 1, Hash: "0xwithdraw", Nonce: 4, Kind: "withdraw", Time: time.Now()},
+	}
+	for _, event := range events {
+		if err := recordChainTransaction(ctx, db, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transactions, err := GetOrderTransactions(ctx, db, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transactions) != 2 || transactions[0].Hash != "0xapprove" || transactions[1].Hash != "0xsell" {
+		t.Fatalf("transactions = %+v, want the approval then the sell", transactions)
+	}
+	if transactions[1].OrderID == nil || *transactions[1].OrderID != order.ID {
+		t.Errorf("order = %v, want %s", transactions[1].OrderID, order.ID)
+	}
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"NewListingBot/announcements"
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"NewListingBot/logger"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrNotDraft = errors.New("order is not a draft")
+
+// DraftApproval holds what can be set on a draft when approving it, nil keeps the draft value
+type DraftApproval struct {
+	ScheduleTime    *time.Time
+	Price           *decimal.Decimal
+	MaxPrice        *decimal.Decimal
+	MaxPricePercent *float64
+}
+
+// StartAnnouncementIngestion polls the announcement feeds in the background when it is enabled
+// and proposes a draft order for every listing found
+func StartAnnouncementIngestion(ctx context.Context, db *gorm.DB, cfg config.Config) *announcements.Ingester {
+	if !cfg.AnnouncementsEnabled {
+		return nil
+	}
+
+	var sources []announcements.Source
+	for _, feed := range cfg.AnnouncementFeeds {
+		sources = append(sources, announcements.NewFeedSource(feed, feed))
+	}
+	for _, feed := range cfg.AnnouncementJSONFeeds {
+		sources = append(sources, announcements.NewJSONSource(feed, feed))
+	}
+
+	ingester := announcements.NewIngester(
+		announcements.NewParser(cfg.AnnouncementQuoteAssets),
+		time.Duration(cfg.AnnouncementsIntervalSeconds)*time.Second,
+		sources...,
+	)
+
+	go ingester.Start(ctx, func(listing announcements.Listing) {
+		err := CreateDraftOrder(ctx, db, listing, cfg.AnnouncementVenue, cfg.AnnouncementDraftBudget)
+		if err != nil {
+			logger.Error(ctx, "error creating draft order", zap.String("symbol", listing.Symbol), zap.Error(err))
+		}
+	})
+
+	return ingester
+}
+
+// CreateDraftOrder proposes an order for the listing, waiting for an approval to be armed.
+// An announcement only ever gets one draft and listings that already opened are left out.
+func CreateDraftOrder(ctx context.Context, db *gorm.DB, listing announcements.Listing, venue string, budget decimal.Decimal) error {
+	if listing.OpenTime != nil && listing.OpenTime.Before(time.Now()) {
+		return nil
+	}
+
+	key := listing.Announcement.Key()
+
+	var count int64
+	err := db.WithContext(ctx).Model(&Order{}).Where("announcement_key = ?", key).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+
+	order := Order{
+		Symbol:          &listing.Symbol,
+		Venue:           &venue,
+		ScheduleTime:    listing.OpenTime,
+		Status:          StatusDraft,
+		AnnouncementKey: &key,
+	}
+	if listing.Announcement.URL != "" {
+		order.AnnouncementURL = &listing.Announcement.URL
+	}
+	if budget.Sign() > 0 {
+		order.Price = &budget
+	}
+	order.applyPaperDefault()
+
+	err = db.WithContext(ctx).Model(&Order{}).Create(&order).Error
+	if err != nil {
+		return err
+	}
+
+	logger.Info(ctx, "draft order proposed", zap.String("symbol", listing.Symbol),
+		zap.String("announcement", listing.Announcement.Title), zap.String("order_id", order.ID.String()))
+	return nil
+}
+
+// ApproveDraftOrder moves the draft to pending with the approved values and arms it like a new order
+func ApproveDraftOrder(ctx context.Context, db *gorm.DB, orderID uuid.UUID, approval DraftApproval) (Order, error) {
+	var order Order
+
+	err := db.WithContext(ctx).Model(&Order{}).Where("id = ?", orderID).First(&order).Error
+	if err != nil {
+		return order, err
+	}
+
+	if order.Status != StatusDraft {
+		return order, fmt.Errorf("%w: order %s is %s", ErrNotDraft, order.ID, order.Status)
+	}
+
+	if approval.ScheduleTime != nil {
+		order.ScheduleTime = approval.ScheduleTime
+	}
+	if approval.Price != nil {
+		order.Price = approval.Price
+	}
+	if approval.MaxPrice != nil {
+		order.MaxPrice = approval.MaxPrice
+	}
+	if approval.MaxPricePercent != nil {
+		order.MaxPricePercent = approval.MaxPricePercent
+	}
+
+	if order.ScheduleTime == nil || order.Price == nil {
+		return order, errors.New("schedule_time and price are required to approve a draft")
+	}
+
+	scheduleSellTime := order.ScheduleTime.Add(time.Minute * 1)
+	order.ScheduleSellTime = &scheduleSellTime
+
+	err = order.Transition(ctx, db, StatusPending, "draft approved", nil, map[string]interface{}{
+		"schedule_time":      order.ScheduleTime,
+		"schedule_sell_time": order.ScheduleSellTime,
+		"price":              order.Price,
+		"max_price":          order.MaxPrice,
+		"max_price_percent":  order.MaxPricePercent,
+	})
+	if err != nil {
+		return order, err
+	}
+
+	order.ScheduleBuyScheduler(ctx, db)
+	order.ScheduleSellScheduler(ctx, db)
+
+	return order, nil
+}
+
+// RejectDraftOrder cancels a draft the operator does not want, the announcement keeps it so no new draft is proposed
+func RejectDraftOrder(ctx context.Context, db *gorm.DB, orderID uuid.UUID) (Order, error) {
+	var order Order
+
+	err := db.WithContext(ctx).Model(&Order{}).Where("id = ?", orderID).First(&order).Error
+	if err != nil {
+		return order, err
+	}
+
+	if order.Status != StatusDraft {
+		return order, fmt.Errorf("%w: order %s is %s", ErrNotDraft, order.ID, order.Status)
+	}
+
+	err = order.Transition(ctx, db, StatusCancelled, "draft rejected", nil, nil)
+	return order, err
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"NewListingBot/announcements"
+	"NewListingBot/decimal"
+	"NewListingBot/logger"
+	"context"
+	"errors"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+// newTestDB opens a fresh in-memory database with the tables of the orders
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	logger.InitLogger()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AutoMigrate(&Order{}, &ScheduledJob{}, &OrderEvent{}, &OrderFill{}, &ChainTransaction{}, &SymbolSnapshot{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func testListing(openTime time.Time) announcements.Listing {
+	return announcements.Listing{
+		Announcement: announcements.Announcement{
+			Source: "rss",
+			ID:     "rss-1001",
+			Title:  "New Listing: FOO/USDT",
+			URL:    "https://exchange.example/announcements/1001",
+		},
+		Symbol:     "FOOUSDT",
+		BaseAsset:  "FOO",
+		QuoteAsset: "USDT",
+		OpenTime:   &openTime,
+	}
+}
+
+func draftOrders(t *testing.T, db *gorm.DB) []Order {
+	t.Helper()
+
+	var orders []Order
+	if err := db.Model(&Order{}).Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	return orders
+}
+
+func TestCreateDraftOrder(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	listing := testListing(time.Now().Add(time.Hour))
+
+	err := CreateDraftOrder(ctx, db, listing, "mexc", decimal.RequireFromString("50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same announcement never gets a second draft
+	err = CreateDraftOrder(ctx, db, listing, "mexc", decimal.RequireFromString("50"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orders := draftOrders(t, db)
+	if len(orders) != 1 {
+		t.Fatalf("%d orders, want 1", len(orders))
+	}
+
+	order := orders[0]
+	if order.Status != StatusDraft || *order.Symbol != "FOOUSDT" || *order.AnnouncementKey != "rss:rss-1001" {
+		t.Errorf("draft = %s %s %s", order.Status, *order.Symbol, *order.AnnouncementKey)
+	}
+	if order.Price == nil || order.Price.Cmp(decimal.RequireFromString("50")) != 0 {
+		t.Errorf("price = %v, want the budget", order.Price)
+	}
+}
+
+func TestCreateDraftOrderSkipsOpenedListings(t *testing.T) {
+	db := newTestDB(t)
+
+	err := CreateDraftOrder(context.Background(), db, testListing(time.Now().Add(-time.Minute)), "mexc", decimal.Decimal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if orders := draftOrders(t, db); len(orders) != 0 {
+		t.Errorf("%d orders, want none", len(orders))
+	}
+}
+
+func TestRejectDraftOrder(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	listing := testListing(time.Now().Add(time.Hour))
+
+	err := CreateDraftOrder(ctx, db, listing, "mexc", decimal.Decimal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	draft := draftOrders(t, db)[0]
+
+	order, err := RejectDraftOrder(ctx, db, draft.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != StatusCancelled {
+		t.Errorf("status = %s, want %s", order.Status, StatusCancelled)
+	}
+
+	events, err := GetOrderEvents(ctx, db, draft.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].FromStatus != StatusDraft || events[0].ToStatus != StatusCancelled {
+		t.Errorf("events = %+v, want draft to cancelled", events)
+	}
+
+	_, err = RejectDraftOrder(ctx, db, draft.ID)
+	if !errors.Is(err, ErrNotDraft) {
+		t.Errorf("rejecting twice = %v, want ErrNotDraft", err)
+	}
+
+	// a rejected announcement is not proposed again
+	err = CreateDraftOrder(ctx, db, listing, "mexc", decimal.Decimal{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orders := draftOrders(t, db); len(orders) != 1 {
+		t.Errorf("%d orders, want 1", len(orders))
+	}
+
+	_, err = ApproveDraftOrder(ctx, db, draft.ID, DraftApproval{})
+	if !errors.Is(err, ErrNotDraft) {
+		t.Errorf("approving a rejected draft = %v, want ErrNotDraft", err)
+	}
+}
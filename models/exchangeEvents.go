@@ -0,0 +1,97 @@
+package models
+
+import (
+	"NewListingBot/exchange"
+	"NewListingBot/logger"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// finalExchangeStatuses are the exchange order statuses after which nothing executes anymore
+var finalExchangeStatuses = map[string]bool{
+	"FILLED":             true,
+	"CANCELED":           true,
+	"PARTIALLY_CANCELED": true,
+}
+
+// ListenExchangeEvents feeds the order updates pushed by the venues into the orders
+func ListenExchangeEvents(db *gorm.DB) {
+	exchange.Events.OnOrderUpdate(func(update exchange.OrderUpdate) {
+		if update.Side != exchange.OrderSideBuy || update.ClientOrderID == "" || !finalExchangeStatuses[update.Status] {
+			return
+		}
+
+		// the stream must not wait on the database nor the REST api
+		go func() {
+			err := applyBuyUpdate(context.Background(), db, update)
+			if err != nil {
+				logger.Error(context.Background(), "error applying buy update", zap.String("client_order_id", update.ClientOrderID), zap.Error(err))
+			}
+		}()
+	})
+}
+
+// applyBuyUpdate records the buy of the order as soon as the exchange says it is done executing,
+// without waiting for the placement response
+func applyBuyUpdate(ctx context.Context, db *gorm.DB, update exchange.OrderUpdate) error {
+	if update.ExecutedQty.IsZero() {
+		return nil
+	}
+
+	var order Order
+	err := db.WithContext(ctx).Model(&Order{}).Where("client_order_id = ?", update.ClientOrderID).First(&order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// not one of ours, or placed by hand
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ex, err := exchangeForOrder(order)
+	if err != nil {
+		return err
+	}
+
+	response := exchange.OrderResponse{
+		Symbol:              update.Symbol,
+		OrderId:             update.OrderID,
+		ClientOrderId:       update.ClientOrderID,
+		Price:               update.Price,
+		OrigQty:             update.ExecutedQty,
+		ExecutedQty:         update.ExecutedQty,
+		CummulativeQuoteQty: update.ExecutedAmount,
+		Status:              update.Status,
+		Side:                string(update.Side),
+	}
+
+	switch order.Status {
+	case StatusBuying:
+		return recordBuy(ctx, db, ex, order, response, update.Time)
+
+	case StatusBought:
+		// the placement response may have come before the last executions
+		fills, err := reconcileFills(ex, *order.Symbol, update.OrderID)
+		if err != nil || fills.Quantity.IsZero() {
+			return err
+		}
+
+		quantity := fills.Quantity
+		symbolInfo, err := ex.GetSymbolInfo(*order.Symbol)
+		if err == nil {
+			quantity = fills.netQuantity(symbolInfo.BaseAsset)
+		}
+
+		err = db.WithContext(ctx).Model(&Order{}).Where("id = ? AND status = ?", order.ID, StatusBought).
+			Update("quantity", quantity).Error
+		if err != nil {
+			return err
+		}
+
+		return recordFills(ctx, db, ex, order, exchange.OrderSideBuy, update.OrderID)
+	}
+
+	return nil
+}
@@ -0,0 +1,398 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"NewListingBot/logger"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+// TakeProfitLevel sells SellPercent of the bought quantity once the price is Percent over the entry price
+type TakeProfitLevel struct {
+	Percent     float64 `json:"percent" validate:"gt=0"`
+	SellPercent float64 `json:"sell_percent" validate:"gt=0,lte=100"`
+}
+
+// TrailingStop sells everything left once the price falls back from its highest point since the buy,
+// by TrailPercent or by TrailDistance in quote units. It only arms once the high is ActivationPercent over the entry.
+type TrailingStop struct {
+	ActivationPercent float64         `json:"activation_percent" validate:"gte=0"`
+	TrailPercent      float64         `json:"trail_percent" validate:"required_without=TrailDistance,omitempty,gt=0,lt=100"`
+	TrailDistance     decimal.Decimal `json:"trail_distance" validate:"required_without=TrailPercent,omitempty,gt=0"`
+}
+
+// ExitPlan describes how a bought order is exited.
+// The take profit levels are hit in order, the stop loss, the trailing stop and the max hold sell everything left.
+type ExitPlan struct {
+	TakeProfits     []TakeProfitLevel `json:"take_profits" validate:"max=10,dive"`
+	StopLossPercent float64           `json:"stop_loss_percent" validate:"omitempty,gt=0,lt=100"`
+	TrailingStop    *TrailingStop     `json:"trailing_stop"`
+	MaxHoldSeconds  int64             `json:"max_hold_seconds" validate:"omitempty,gt=0"`
+}
+
+// DefaultExitPlan is used when an order does not carry its own plan, it sells everything at 10%
+var DefaultExitPlan = ExitPlan{
+	TakeProfits: []TakeProfitLevel{{Percent: 10, SellPercent: 100}},
+}
+
+// position is what the exit plan is evaluated against
+type position struct {
+	EntryPrice    decimal.Decimal
+	HighWaterMark decimal.Decimal
+	BoughtTime    time.Time
+	LevelsDone    int
+}
+
+// exitDecision is what the exit plan asks to do at a price
+type exitDecision struct {
+	Reason string
+	// share of the bought quantity to sell, ignored when Final sells everything left
+	Fraction float64
+	// take profit levels hit once the sell is done
+	LevelsDone int
+	Final      bool
+}
+
+// PendingSell is the exit sell of an order in selling, kept until the sell is settled so a restart can find it.
+// OrderID is only known once the sell was placed.
+type PendingSell struct {
+	ClientOrderID string          `json:"client_order_id"`
+	OrderID       string          `json:"order_id"`
+	Quantity      decimal.Decimal `json:"quantity"`
+	LevelsDone    int             `json:"levels_done"`
+	Final         bool            `json:"final"`
+}
+
+// Value saves the pending sell as json, it can be set in the updates of a transition
+func (pending PendingSell) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(pending)
+	return string(encoded), err
+}
+
+func (pending *PendingSell) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), pending)
+	case []byte:
+		return json.Unmarshal(v, pending)
+	}
+	return fmt.Errorf("unsupported pending sell value: %T", value)
+}
+
+func (PendingSell) GormDataType() string {
+	return "string"
+}
+
+// exitPlan returns the plan of the order or the default one
+func (order *Order) exitPlan() ExitPlan {
+	if order.ExitPlan != nil {
+		return *order.ExitPlan
+	}
+	return DefaultExitPlan
+}
+
+// stopPrice returns the price the trailing stop sells at for the high water mark, false while it is not armed
+func (trailing TrailingStop) stopPrice(entryPrice decimal.Decimal, highWaterMark decimal.Decimal) (decimal.Decimal, bool) {
+	if highWaterMark.LessThan(entryPrice.Mul(decimal.NewFromFloat(1 + trailing.ActivationPercent/100))) {
+		return decimal.Zero, false
+	}
+
+	stop := highWaterMark.Mul(decimal.NewFromFloat(1 - trailing.TrailPercent/100))
+	distanceStop := highWaterMark.Sub(trailing.TrailDistance)
+	if trailing.TrailDistance.Sign() > 0 && (trailing.TrailPercent == 0 || distanceStop.LessThan(stop)) {
+		stop = distanceStop
+	}
+
+	return stop, true
+}
+
+// maxHoldExit returns the exit of a position held for longer than the plan allows
+func (plan ExitPlan) maxHoldExit(current position, now time.Time) (exitDecision, bool) {
+	if plan.MaxHoldSeconds > 0 && !current.BoughtTime.IsZero() && now.Sub(current.BoughtTime) >= time.Duration(plan.MaxHoldSeconds)*time.Second {
+		return exitDecision{Reason: "max hold time reached", LevelsDone: current.LevelsDone, Final: true}, true
+	}
+	return exitDecision{}, false
+}
+
+// decide returns the exit to make at the price, false when the position is kept
+func (plan ExitPlan) decide(current position, price decimal.Decimal, now time.Time) (exitDecision, bool) {
+	levelsDone := current.LevelsDone
+
+	if decision, ok := plan.maxHoldExit(current, now); ok {
+		return decision, true
+	}
+
+	entryPrice := current.EntryPrice
+	if entryPrice.Sign() <= 0 || price.Sign() <= 0 {
+		return exitDecision{}, false
+	}
+
+	// the percentages are compared as floats, they are never sent anywhere
+	change := price.Sub(entryPrice).Div(entryPrice).Float64() * 100
+
+	if plan.StopLossPercent > 0 && change <= -plan.StopLossPercent {
+		return exitDecision{Reason: fmt.Sprintf("stop loss hit at %.2f%%", change), LevelsDone: levelsDone, Final: true}, true
+	}
+
+	if plan.TrailingStop != nil {
+		stop, armed := plan.TrailingStop.stopPrice(entryPrice, current.HighWaterMark)
+		if armed && !price.GreaterThan(stop) {
+			reason := fmt.Sprintf("trailing stop hit at %v from a high of %v", price, current.HighWaterMark)
+			return exitDecision{Reason: reason, LevelsDone: levelsDone, Final: true}, true
+		}
+	}
+
+	// every level the price went through since the last check is sold at once
+	decision := exitDecision{LevelsDone: levelsDone}
+	for decision.LevelsDone < len(plan.TakeProfits) && change >= plan.TakeProfits[decision.LevelsDone].Percent {
+		decision.Fraction += plan.TakeProfits[decision.LevelsDone].SellPercent / 100
+		decision.LevelsDone++
+	}
+
+	if decision.LevelsDone == levelsDone {
+		return exitDecision{}, false
+	}
+
+	decision.Reason = fmt.Sprintf("take profit %d reached at %.2f%%", decision.LevelsDone, change)
+	decision.Final = decision.LevelsDone == len(plan.TakeProfits) || decision.Fraction >= 1
+	return decision, true
+}
+
+// checkExit evaluates the exit plan of the order at the last price and sells when it asks to.
+// It returns true once the order has nothing left to watch.
+func checkExit(ctx context.Context, db *gorm.DB, ex exchange.Exchange, orderID uuid.UUID) (bool, error) {
+	var order Order
+
+	err := db.WithContext(ctx).Model(&Order{}).Where("id = ?", orderID).First(&order).Error
+	if err != nil {
+		return false, err
+	}
+
+	switch order.Status {
+	case StatusBought:
+	case StatusSelling:
+		// a sell is in flight, its outcome is seen on the next check unless it was placed but could not be settled
+		if order.PendingSell == nil || order.PendingSell.OrderID == "" {
+			return false, nil
+		}
+
+		sellResponse, err := ex.GetOrder(*order.Symbol, order.PendingSell.OrderID)
+		if err == nil {
+			err = settleSell(context.Background(), db, ex, order, *order.PendingSell, sellResponse)
+		}
+		if err != nil {
+			logger.Error(ctx, fmt.Sprintf("error settling sell of %s", *order.Symbol), zap.Error(err))
+			return false, nil
+		}
+		return orderStatus(ctx, db, order.ID) == StatusSold, nil
+	default:
+		return true, nil
+	}
+
+	current := position{
+		EntryPrice: calculateAveragePrice(order),
+		LevelsDone: order.TakeProfitsDone,
+	}
+	if order.BoughtTime != nil {
+		current.BoughtTime = *order.BoughtTime
+	}
+	// the high is kept on the order so the trailing stop survives a restart
+	if order.HighWaterMark != nil {
+		current.HighWaterMark = *order.HighWaterMark
+	}
+
+	plan := order.exitPlan()
+	now := time.Now()
+
+	// the max hold needs no price, it still sells when the price cannot be read
+	decision, ok := plan.maxHoldExit(current, now)
+	if !ok {
+		price, err := lastPrice(ex, order)
+		if err != nil {
+			logger.Error(ctx, "Error getting market price", zap.Error(err))
+			return false, nil
+		}
+
+		if price.GreaterThan(current.HighWaterMark) {
+			current.HighWaterMark = price
+			err = db.WithContext(ctx).Model(&Order{}).Where("id = ?", order.ID).Update("high_water_mark", price).Error
+			if err != nil {
+				logger.Error(ctx, "error saving high water mark", zap.Error(err))
+			}
+		}
+
+		decision, ok = plan.decide(current, price, now)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	// once started the sell must be recorded even if the order gets untracked meanwhile
+	err = exitPosition(context.Background(), db, ex, order, decision)
+	if err != nil {
+		logger.Error(ctx, fmt.Sprintf("error selling %s", *order.Symbol), zap.Error(err))
+		return false, nil
+	}
+
+	// a final sell that only partly filled leaves the order bought with the rest to sell
+	return orderStatus(ctx, db, order.ID) == StatusSold, nil
+}
+
+// exitPosition sells the part of the order the decision asks for, the order goes back to bought
+// while some quantity is left or when the sell executed nothing
+func exitPosition(ctx context.Context, db *gorm.DB, ex exchange.Exchange, order Order, decision exitDecision) error {
+	bought := *order.Quantity
+	soldQuantity := decimal.Zero
+	if order.SoldQuantity != nil {
+		soldQuantity = *order.SoldQuantity
+	}
+
+	remaining := bought.Sub(soldQuantity)
+	quantity := remaining
+	if share := bought.Mul(decimal.NewFromFloat(decision.Fraction)); !decision.Final && share.LessThan(remaining) {
+		quantity = share
+	}
+
+	pending := PendingSell{
+		ClientOrderID: order.sellClientOrderID(),
+		Quantity:      sellQuantity(ex, order, quantity),
+		LevelsDone:    decision.LevelsDone,
+		Final:         decision.Final,
+	}
+
+	err := order.Transition(ctx, db, StatusSelling, decision.Reason, nil, map[string]interface{}{
+		"pending_sell": pending,
+	})
+	if err != nil {
+		return err
+	}
+
+	sellResponse, err := placeSellOrder(ex, order, pending.Quantity, pending.ClientOrderID)
+	if errors.Is(err, exchange.ErrOrderStateUnknown) {
+		// the sell may have gone through
+		placedOrder, lookupErr := ex.GetOrderByClientID(*order.Symbol, pending.ClientOrderID)
+		if lookupErr == nil && placedOrder.OrderId != "" {
+			sellResponse, err = placedOrder, nil
+		}
+	}
+	if err != nil {
+		transitionErr := order.Transition(ctx, db, StatusBought, err.Error(), nil, map[string]interface{}{
+			"pending_sell": nil,
+		})
+		if transitionErr != nil {
+			logger.Error(ctx, "error reverting order to bought", zap.Error(transitionErr))
+		}
+		return err
+	}
+
+	return settleSell(ctx, db, ex, order, pending, sellResponse)
+}
+
+// settleSell moves the order out of selling with what its sell executed, back to bought while some quantity is left
+// or when the sell executed nothing. What a limit sell leaves on the book is cancelled first.
+// When the sell can't be read the order stays in selling and the next check settles it.
+func settleSell(ctx context.Context, db *gorm.DB, ex exchange.Exchange, order Order, pending PendingSell, sellResponse exchange.OrderResponse) error {
+	pending.OrderID = sellResponse.OrderId
+
+	// an immediate or cancel sell may execute part of the quantity or nothing at all
+	fills, err := reconcileFills(ex, *order.Symbol, sellResponse.OrderId)
+	if err == nil && order.sellOrderType() == exchange.OrderTypeLimit && fills.Quantity.LessThan(pending.Quantity) {
+		err = cancelRemainder(ex, *order.Symbol, sellResponse.OrderId)
+		if err == nil {
+			fills, err = reconcileFills(ex, *order.Symbol, sellResponse.OrderId)
+		}
+	}
+	if err != nil {
+		updateErr := db.WithContext(ctx).Model(&Order{}).Where("id = ? AND status = ?", order.ID, StatusSelling).
+			Update("pending_sell", pending).Error
+		if updateErr != nil {
+			logger.Error(ctx, "error saving pending sell", zap.Error(updateErr))
+		}
+		return fmt.Errorf("settling sell %s failed: %v", sellResponse.OrderId, err)
+	}
+
+	executed := fills.Quantity
+	if executed.Sign() <= 0 {
+		err = order.Transition(ctx, db, StatusBought, "sell order not filled", sellResponse, map[string]interface{}{
+			"pending_sell": nil,
+		})
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s sell of %v", ErrNotFilled, order.sellOrderType(), pending.Quantity)
+	}
+
+	soldQuantity := decimal.Zero
+	if order.SoldQuantity != nil {
+		soldQuantity = *order.SoldQuantity
+	}
+	remaining := order.Quantity.Sub(soldQuantity)
+
+	updates := map[string]interface{}{
+		"sold_quantity":     soldQuantity.Add(executed),
+		"take_profits_done": pending.LevelsDone,
+		"pending_sell":      nil,
+	}
+
+	// a final sell is done once it executed everything it could, what the balance did not cover is not ours to sell
+	if remaining.Sub(executed).Sign() <= 0 || (pending.Final && !executed.LessThan(pending.Quantity)) {
+		updates["sold_time"] = time.Now()
+		err = order.Transition(ctx, db, StatusSold, "sell order placed", sellResponse, updates)
+	} else {
+		err = order.Transition(ctx, db, StatusBought, "partial sell order placed", sellResponse, updates)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = recordFills(ctx, db, ex, order, exchange.OrderSideSell, sellResponse.OrderId)
+	if err != nil {
+		logger.Error(ctx, "error recording sell fills", zap.Error(err))
+	}
+
+	return nil
+}
+
+// reconcileSellingOrder settles an order left in selling by a restart with its sell on the exchange,
+// without a sell it goes back to bought and its exit plan decides again.
+// When the exchange cannot be asked the order stays in selling, the sell may still be live.
+func reconcileSellingOrder(ctx context.Context, db *gorm.DB, order *Order) error {
+	ex, err := exchangeForOrder(*order)
+	if err != nil {
+		return err
+	}
+
+	var placedOrder exchange.OrderResponse
+	pending := order.PendingSell
+	if pending != nil && pending.OrderID != "" {
+		placedOrder, err = ex.GetOrder(*order.Symbol, pending.OrderID)
+	} else if pending != nil {
+		placedOrder, err = ex.GetOrderByClientID(*order.Symbol, pending.ClientOrderID)
+	}
+
+	if err != nil && !exchange.IsOrderNotFound(err) {
+		return fmt.Errorf("looking up the sell failed: %v", err)
+	}
+
+	if pending == nil || err != nil || placedOrder.OrderId == "" {
+		return order.Transition(ctx, db, StatusBought, "no sell found on the exchange", nil, map[string]interface{}{
+			"pending_sell": nil,
+		})
+	}
+
+	err = settleSell(ctx, db, ex, *order, *pending, placedOrder)
+	if err != nil && !errors.Is(err, ErrNotFilled) {
+		return err
+	}
+
+	order.Status = orderStatus(ctx, db, order.ID)
+	return nil
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExitPlanDecide(t *testing.T) {
+	now := time.Now()
+	ladder := []TakeProfitLevel{{Percent: 10, SellPercent: 30}, {Percent: 20, SellPercent: 30}, {Percent: 50, SellPercent: 40}}
+	plan := ExitPlan{TakeProfits: ladder, StopLossPercent: 5, MaxHoldSeconds: 3600}
+
+	tests := []struct {
+		name       string
+		plan       ExitPlan
+		levelsDone int
+		boughtAgo  time.Duration
+		price      string
+		exit       bool
+		fraction   float64
+		want       int
+		final      bool
+		reason     string
+	}{
+		{name: "below the first step", plan: plan, price: "1.05"},
+		{name: "first step", plan: plan, price: "1.11", exit: true, fraction: 0.3, want: 1, reason: "take profit 1"},
+		{name: "second step", plan: plan, levelsDone: 1, price: "1.21", exit: true, fraction: 0.3, want: 2, reason: "take profit 2"},
+		{name: "first step already sold", plan: plan, levelsDone: 1, price: "1.15"},
+		{name: "two steps at once", plan: plan, price: "1.25", exit: true, fraction: 0.6, want: 2, reason: "take profit 2"},
+		{name: "last step", plan: plan, levelsDone: 2, price: "1.6", exit: true, fraction: 0.4, want: 3, final: true, reason: "take profit 3"},
+		{name: "ladder done", plan: plan, levelsDone: 3, price: "2"},
+		{
+			name:     "partial ladder selling everything",
+			plan:     ExitPlan{TakeProfits: []TakeProfitLevel{{Percent: 10, SellPercent: 50}, {Percent: 20, SellPercent: 50}, {Percent: 50, SellPercent: 10}}},
+			price:    "1.3",
+			exit:     true,
+			fraction: 1,
+			want:     2,
+			final:    true,
+			reason:   "take profit 2",
+		},
+		{name: "above the stop loss", plan: plan, price: "0.96"},
+		{name: "stop loss", plan: plan, levelsDone: 1, price: "0.9", exit: true, want: 1, final: true, reason: "stop loss"},
+		{name: "max hold", plan: plan, levelsDone: 1, boughtAgo: 2 * time.Hour, price: "1.05", exit: true, want: 1, final: true, reason: "max hold"},
+		{name: "max hold without a price", plan: plan, boughtAgo: 2 * time.Hour, price: "0", exit: true, final: true, reason: "max hold"},
+		{name: "held shorter than the max", plan: plan, boughtAgo: 30 * time.Minute, price: "1.05"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := position{EntryPrice: decimal.New(1), LevelsDone: test.levelsDone, BoughtTime: now.Add(-time.Minute)}
+			if test.boughtAgo > 0 {
+				current.BoughtTime = now.Add(-test.boughtAgo)
+			}
+
+			decision, ok := test.plan.decide(current, decimal.RequireFromString(test.price), now)
+			if ok != test.exit {
+				t.Fatalf("exit = %v (%+v), want %v", ok, decision, test.exit)
+			}
+			if !ok {
+				return
+			}
+
+			if math.Abs(decision.Fraction-test.fraction) > 1e-9 || decision.LevelsDone != test.want || decision.Final != test.final {
+				t.Errorf("decision = %+v, want %v of it with %d levels done, final %v", decision, test.fraction, test.want, test.final)
+			}
+			if !strings.HasPrefix(decision.Reason, test.reason) {
+				t.Errorf("reason = %q, want %s", decision.Reason, test.reason)
+			}
+		})
+	}
+}
+
+func TestCheckExitSellsOnMaxHoldWithoutAPrice(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := boughtTestOrder(t, db, ex)
+
+	boughtTime := time.Now().Add(-2 * time.Hour)
+	plan := ExitPlan{TakeProfits: DefaultExitPlan.TakeProfits, MaxHoldSeconds: 3600}
+	if err := db.Model(&order).Updates(Order{BoughtTime: &boughtTime, ExitPlan: &plan}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ex.tickerErr = errors.New("ticker unavailable")
+	done, err := checkExit(context.Background(), db, ex, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded := reloadOrder(t, db, order); !done || reloaded.Status != StatusSold {
+		t.Errorf("done = %v with status %s, want sold on the max hold", done, reloaded.Status)
+	}
+}
+
+func TestTrailingStopPrice(t *testing.T) {
+	entry := decimal.New(2)
+
+	tests := []struct {
+		name  string
+		stop  TrailingStop
+		high  string
+		armed bool
+		want  string
+	}{
+		{name: "not activated", stop: TrailingStop{ActivationPercent: 10, TrailPercent: 5}, high: "2.19"},
+		{name: "activated", stop: TrailingStop{ActivationPercent: 10, TrailPercent: 5}, high: "2.2", armed: true, want: "2.09"},
+		{name: "armed right away", stop: TrailingStop{TrailPercent: 10}, high: "2", armed: true, want: "1.8"},
+		{name: "distance", stop: TrailingStop{ActivationPercent: 10, TrailDistance: decimal.RequireFromString("0.3")}, high: "3", armed: true, want: "2.7"},
+		// with both the stop is the lower of the two
+		{name: "percent below the distance", stop: TrailingStop{TrailPercent: 20, TrailDistance: decimal.RequireFromString("0.3")}, high: "3", armed: true, want: "2.4"},
+		{name: "distance below the percent", stop: TrailingStop{TrailPercent: 5, TrailDistance: decimal.RequireFromString("0.3")}, high: "3", armed: true, want: "2.7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stop, armed := test.stop.stopPrice(entry, decimal.RequireFromString(test.high))
+			if armed != test.armed {
+				t.Fatalf("armed = %v, want %v", armed, test.armed)
+			}
+			if armed && stop.Cmp(decimal.RequireFromString(test.want)) != 0 {
+				t.Errorf("stop = %v, want %s", stop, test.want)
+			}
+		})
+	}
+}
+
+func TestTrailingStopRatchetsUp(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := boughtTestOrder(t, db, ex)
+
+	plan := ExitPlan{TrailingStop: &TrailingStop{ActivationPercent: 10, TrailPercent: 5}}
+	if err := db.Model(&order).Updates(Order{ExitPlan: &plan}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// the stop arms at 2.4, follows the high to 2.6 and stays there while the price falls back above it
+	steps := []struct {
+		price string
+		armed bool
+		stop  string
+	}{
+		{price: "2.1"},
+		{price: "2.4", armed: true, stop: "2.28"},
+		{price: "2.6", armed: true, stop: "2.47"},
+		{price: "2.5", armed: true, stop: "2.47"},
+		{price: "2.55", armed: true, stop: "2.47"},
+	}
+
+	for _, step := range steps {
+		ex.price = decimal.RequireFromString(step.price)
+		done, err := checkExit(context.Background(), db, ex, order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done {
+			t.Fatalf("sold at %s, above the stop", step.price)
+		}
+
+		reloaded := reloadOrder(t, db, order)
+		stop, armed := plan.TrailingStop.stopPrice(calculateAveragePrice(reloaded), *reloaded.HighWaterMark)
+		if armed != step.armed || (armed && stop.Cmp(decimal.RequireFromString(step.stop)) != 0) {
+			t.Errorf("at %s the stop is %v armed %v, want %s armed %v", step.price, stop, armed, step.stop, step.armed)
+		}
+	}
+
+	ex.price = decimal.RequireFromString("2.45")
+	done, err := checkExit(context.Background(), db, ex, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done || reloadOrder(t, db, order).Status != StatusSold {
+		t.Error("not sold below the stop")
+	}
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// fakeExchange is an in-memory venue trading one symbol at a fixed price.
+// Orders fill at the price unless fill says otherwise, the buys pay the commission rate in the base asset
+// and the sells in the quote asset.
+type fakeExchange struct {
+	mu sync.Mutex
+
+	symbol     string
+	baseAsset  string
+	quoteAsset string
+	price      decimal.Decimal
+	commission decimal.Decimal
+
+	// fill returns the quantity of a limit order executing right away, everything when nil
+	fill func(request exchange.OrderRequest) decimal.Decimal
+	// placeErr is returned by the next placement, the order is still placed when it is ErrOrderStateUnknown
+	placeErr  error
+	cancelErr error
+	// getErr is returned by the order lookups, like a venue that does not answer
+	getErr error
+	// tickerErr is returned by the price lookups
+	tickerErr error
+	// hideTrades makes the trades not visible yet, like right after a fill
+	hideTrades bool
+
+	nextID    int
+	requests  []exchange.OrderRequest
+	orders    map[string]exchange.OrderResponse
+	trades    map[string][]exchange.Trade
+	cancelled []string
+	balances  map[string]decimal.Decimal
+}
+
+func newFakeExchange(price string) *fakeExchange {
+	return &fakeExchange{
+		symbol:     "FOOUSDT",
+		baseAsset:  "FOO",
+		quoteAsset: "USDT",
+		price:      decimal.RequireFromString(price),
+		commission: decimal.RequireFromString("0.001"),
+		orders:     map[string]exchange.OrderResponse{},
+		trades:     map[string][]exchange.Trade{},
+		balances:   map[string]decimal.Decimal{},
+	}
+}
+
+func (f *fakeExchange) Name() string {
+	return "fake"
+}
+
+func (f *fakeExchange) PlaceMarketOrder(request exchange.OrderRequest) (exchange.OrderResponse, error) {
+	quantity := request.Quantity
+	if request.Side == exchange.OrderSideBuy && request.QuoteOrderQty.Sign() > 0 {
+		quantity = request.QuoteOrderQty.Div(f.price)
+	}
+	return f.place(request, quantity)
+}
+
+func (f *fakeExchange) PlaceLimitOrder(request exchange.OrderRequest) (exchange.OrderResponse, error) {
+	quantity := request.Quantity
+	if f.fill != nil {
+		quantity = f.fill(request)
+	}
+	return f.place(request, quantity)
+}
+
+func (f *fakeExchange) place(request exchange.OrderRequest, executed decimal.Decimal) (exchange.OrderResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, request)
+
+	err := f.placeErr
+	f.placeErr = nil
+	if err != nil && !errors.Is(err, exchange.ErrOrderStateUnknown) {
+		return exchange.OrderResponse{}, err
+	}
+
+	f.nextID++
+	orderID := fmt.Sprintf("fake-%d", f.nextID)
+
+	origQty := request.Quantity
+	if origQty.IsZero() {
+		origQty = executed
+	}
+
+	status := "FILLED"
+	switch {
+	case executed.IsZero() && (request.Type == exchange.OrderTypeImmediateOrCancel || request.Type == exchange.OrderTypeFillOrKill):
+		status = "EXPIRED"
+	case executed.IsZero():
+		status = "NEW"
+	case executed.LessThan(origQty):
+		status = "PARTIALLY_FILLED"
+	}
+
+	response := exchange.OrderResponse{
+		Symbol:              request.Symbol,
+		OrderId:             orderID,
+		ClientOrderId:       request.ClientOrderID,
+		Price:               f.price,
+		OrigQty:             origQty,
+		ExecutedQty:         executed,
+		CummulativeQuoteQty: executed.Mul(f.price),
+		Status:              status,
+		Type:                string(request.Type),
+		Side:                string(request.Side),
+	}
+	f.orders[orderID] = response
+
+	if executed.Sign() > 0 {
+		commission, commissionAsset := executed.Mul(f.commission), f.baseAsset
+		if request.Side == exchange.OrderSideSell {
+			commission, commissionAsset = executed.Mul(f.price).Mul(f.commission), f.quoteAsset
+		}
+
+		f.trades[orderID] = append(f.trades[orderID], exchange.Trade{
+			Symbol:          request.Symbol,
+			Id:              orderID + "-1",
+			OrderId:         orderID,
+			ClientOrderId:   request.ClientOrderID,
+			Price:           f.price,
+			Qty:             executed,
+			QuoteQty:        executed.Mul(f.price),
+			Commission:      commission,
+			CommissionAsset: commissionAsset,
+			IsBuyer:         request.Side == exchange.OrderSideBuy,
+		})
+
+		if request.Side == exchange.OrderSideBuy {
+			f.balances[f.baseAsset] = f.balances[f.baseAsset].Add(executed).Sub(commission)
+		} else {
+			f.balances[f.baseAsset] = f.balances[f.baseAsset].Sub(executed)
+		}
+	}
+
+	if err != nil {
+		return exchange.OrderResponse{}, err
+	}
+	return response, nil
+}
+
+func (f *fakeExchange) CancelOrder(symbol string, orderID string) (exchange.OrderResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cancelErr != nil {
+		return exchange.OrderResponse{}, f.cancelErr
+	}
+
+	order, ok := f.orders[orderID]
+	if !ok {
+		return exchange.OrderResponse{}, fmt.Errorf("order %s: %w", orderID, exchange.ErrOrderNotFound)
+	}
+
+	order.Status = "CANCELED"
+	f.orders[orderID] = order
+	f.cancelled = append(f.cancelled, orderID)
+	return order, nil
+}
+
+func (f *fakeExchange) CancelAllOpenOrders(symbol string) ([]exchange.OrderResponse, error) {
+	return nil, nil
+}
+
+func (f *fakeExchange) GetOrder(symbol string, orderID string) (exchange.OrderResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.getErr != nil {
+		return exchange.OrderResponse{}, f.getErr
+	}
+
+	order, ok := f.orders[orderID]
+	if !ok {
+		return exchange.OrderResponse{}, fmt.Errorf("order %s: %w", orderID, exchange.ErrOrderNotFound)
+	}
+	return order, nil
+}
+
+func (f *fakeExchange) GetOrderByClientID(symbol string, clientOrderID string) (exchange.OrderResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.getErr != nil {
+		return exchange.OrderResponse{}, f.getErr
+	}
+
+	for _, order := range f.orders {
+		if order.ClientOrderId == clientOrderID {
+			return order, nil
+		}
+	}
+	return exchange.OrderResponse{}, fmt.Errorf("client order %s: %w", clientOrderID, exchange.ErrOrderNotFound)
+}
+
+func (f *fakeExchange) GetOpenOrders(symbol string) ([]exchange.OrderResponse, error) {
+	return nil, nil
+}
+
+func (f *fakeExchange) GetMyTrades(symbol string, orderID string) ([]exchange.Trade, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.hideTrades {
+		return nil, nil
+	}
+	return f.trades[orderID], nil
+}
+
+func (f *fakeExchange) GetBalances() ([]exchange.Balance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var balances []exchange.Balance
+	for asset, free := range f.balances {
+		balances = append(balances, exchange.Balance{Asset: asset, Free: free})
+	}
+	return balances, nil
+}
+
+func (f *fakeExchange) GetTicker(symbol string) (exchange.Ticker, error) {
+	if f.tickerErr != nil {
+		return exchange.Ticker{}, f.tickerErr
+	}
+	return exchange.Ticker{Symbol: symbol, LastPrice: f.price, BidPrice: f.price, AskPrice: f.price}, nil
+}
+
+func (f *fakeExchange) GetSymbolInfo(symbol string) (exchange.SymbolInfo, error) {
+	return exchange.SymbolInfo{Symbol: symbol, Status: "1", BaseAsset: f.baseAsset, QuoteAsset: f.quoteAsset}, nil
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"fmt"
+)
+
+// fillSummary is what actually executed for an exchange order
+type fillSummary struct {
+	Quantity     decimal.Decimal            // base asset quantity executed
+	QuoteQty     decimal.Decimal            // quote asset amount executed
+	AveragePrice decimal.Decimal            // QuoteQty / Quantity
+	Commissions  map[string]decimal.Decimal // commissions paid by asset
+}
+
+func summarizeTrades(trades []exchange.Trade) fillSummary {
+	summary := fillSummary{Commissions: map[string]decimal.Decimal{}}
+
+	for _, trade := range trades {
+		summary.Quantity = summary.Quantity.Add(trade.Qty)
+		summary.QuoteQty = summary.QuoteQty.Add(trade.QuoteQty)
+		if trade.CommissionAsset != "" {
+			summary.Commissions[trade.CommissionAsset] = summary.Commissions[trade.CommissionAsset].Add(trade.Commission)
+		}
+	}
+
+	if summary.Quantity.Sign() > 0 {
+		summary.AveragePrice = summary.QuoteQty.Div(summary.Quantity)
+	}
+
+	return summary
+}
+
+// reconcileFills looks up the executions of an exchange order.
+// The trades carry the fees, when they are not visible yet the order itself gives the executed amounts.
+func reconcileFills(ex exchange.Exchange, symbol string, orderID string) (fillSummary, error) {
+	trades, err := ex.GetMyTrades(symbol, orderID)
+	if err == nil && len(trades) > 0 {
+		return summarizeTrades(trades), nil
+	}
+
+	placedOrder, orderErr := ex.GetOrder(symbol, orderID)
+	if orderErr != nil {
+		if err != nil {
+			return fillSummary{}, fmt.Errorf("error fetching fills of order %s: %v", orderID, err)
+		}
+		return fillSummary{}, orderErr
+	}
+
+	summary := fillSummary{
+		Quantity:    placedOrder.ExecutedQty,
+		QuoteQty:    placedOrder.CummulativeQuoteQty,
+		Commissions: map[string]decimal.Decimal{},
+	}
+	if summary.Quantity.Sign() > 0 {
+		summary.AveragePrice = summary.QuoteQty.Div(summary.Quantity)
+	}
+
+	return summary, nil
+}
+
+// netQuantity is the base quantity we actually hold after the commissions taken in the base asset
+func (summary fillSummary) netQuantity(baseAsset string) decimal.Decimal {
+	return summary.Quantity.Sub(summary.Commissions[baseAsset])
+}
+
+// freeBalance returns the free balance of the asset on the exchange,
+// the last one pushed on the user stream when there is one
+func freeBalance(ex exchange.Exchange, asset string) (decimal.Decimal, error) {
+	if balance, ok := exchange.Events.Balance(ex.Name(), asset); ok {
+		return balance.Free, nil
+	}
+
+	balances, err := ex.GetBalances()
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	for _, balance := range balances {
+		if balance.Asset == asset {
+			return balance.Free, nil
+		}
+	}
+
+	return decimal.Zero, nil
+}
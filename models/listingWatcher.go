@@ -0,0 +1,316 @@
+package models
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"NewListingBot/logger"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SymbolSnapshot is the last state seen of a symbol in the exchange info of a venue
+type SymbolSnapshot struct {
+	BaseModel
+	Venue                string     `json:"venue" gorm:"uniqueIndex:idx_symbol_snapshot_venue_symbol"`
+	Symbol               string     `json:"symbol" gorm:"uniqueIndex:idx_symbol_snapshot_venue_symbol"`
+	Status               string     `json:"status"`
+	BaseAsset            string     `json:"base_asset"`
+	QuoteAsset           string     `json:"quote_asset"`
+	IsSpotTradingAllowed bool       `json:"is_spot_trading_allowed"`
+	FirstSeenAt          *time.Time `json:"first_seen_at"`
+	LastSeenAt           *time.Time `json:"last_seen_at"` // last poll that changed the symbol
+}
+
+// tradingEnabled reports whether the symbol can be traded, MEXC uses "1" for an online symbol
+func (snapshot SymbolSnapshot) tradingEnabled() bool {
+	return snapshot.IsSpotTradingAllowed && (snapshot.Status == "1" || snapshot.Status == "ENABLED")
+}
+
+type ListingEventKind string
+
+const (
+	ListingEventNewSymbol      ListingEventKind = "new_symbol"
+	ListingEventStatusChanged  ListingEventKind = "status_changed"
+	ListingEventTradingEnabled ListingEventKind = "trading_enabled"
+)
+
+// ListingEvent is a change seen between two snapshots of the exchange info, Previous is nil for a new symbol
+type ListingEvent struct {
+	Kind     ListingEventKind `json:"kind"`
+	Previous *SymbolSnapshot  `json:"previous"`
+	Current  SymbolSnapshot   `json:"current"`
+}
+
+// ListingWatcher polls the symbols of a venue, keeps their snapshots and tells the new ones and the status changes
+type ListingWatcher struct {
+	venue    string
+	symbols  func() ([]exchange.SymbolInfo, error)
+	interval time.Duration
+
+	mu       sync.RWMutex
+	handlers []func(ListingEvent)
+}
+
+func NewListingWatcher(venue string, symbols func() ([]exchange.SymbolInfo, error), interval time.Duration) *ListingWatcher {
+	return &ListingWatcher{
+		venue:    venue,
+		symbols:  symbols,
+		interval: interval,
+	}
+}
+
+// StartListingWatcher watches the MEXC listings in the background when it is enabled,
+// creating the orders of the listings that follow the auto order rules
+func StartListingWatcher(ctx context.Context, db *gorm.DB, cfg config.Config) *ListingWatcher {
+	if !cfg.ListingWatcherEnabled {
+		return nil
+	}
+
+	mexc := exchange.NewMXCExchange(cfg)
+	watcher := NewListingWatcher(exchange.VenueMEXC, func() ([]exchange.SymbolInfo, error) {
+		marketData, err := mexc.GetMarketData()
+		return marketData.Symbols, err
+	}, time.Duration(cfg.ListingWatcherIntervalSeconds)*time.Second)
+
+	watcher.OnListing(func(event ListingEvent) {
+		logger.Info(ctx, "listing event", zap.String("kind", string(event.Kind)),
+			zap.String("venue", event.Current.Venue), zap.String("symbol", event.Current.Symbol),
+			zap.String("status", event.Current.Status))
+	})
+
+	rules := NewListingOrderRules(cfg)
+	if rules.MaxBudget.Sign() > 0 {
+		watcher.OnListing(func(event ListingEvent) {
+			err := autoCreateListingOrder(ctx, db, rules, event)
+			if err != nil {
+				logger.Error(ctx, "error creating listing order", zap.String("symbol", event.Current.Symbol), zap.Error(err))
+			}
+		})
+	}
+
+	go watcher.Start(ctx, db)
+
+	return watcher
+}
+
+func (w *ListingWatcher) OnListing(handler func(ListingEvent)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.handlers = append(w.handlers, handler)
+}
+
+// Start polls the venue every interval until the context is done
+func (w *ListingWatcher) Start(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.Poll(ctx, db); err != nil {
+			logger.Error(ctx, "error polling listings", zap.String("venue", w.venue), zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll takes a snapshot of the symbols, diffs it with the stored one and hands the changes to the handlers.
+// Only the new and changed symbols are written, nothing is when the snapshot did not change.
+// The first snapshot of a venue only seeds the table, every symbol would look new otherwise.
+func (w *ListingWatcher) Poll(ctx context.Context, db *gorm.DB) ([]ListingEvent, error) {
+	infos, err := w.symbols()
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []SymbolSnapshot
+	err = db.WithContext(ctx).Model(&SymbolSnapshot{}).Where("venue = ?", w.venue).Find(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seeded := len(stored) > 0
+	known := make(map[string]SymbolSnapshot, len(stored))
+	for _, snapshot := range stored {
+		known[snapshot.Symbol] = snapshot
+	}
+
+	now := time.Now()
+	var events []ListingEvent
+	var created, changed []SymbolSnapshot
+
+	for _, info := range infos {
+		current := SymbolSnapshot{
+			Venue:                w.venue,
+			Symbol:               info.Symbol,
+			Status:               info.Status,
+			BaseAsset:            info.BaseAsset,
+			QuoteAsset:           info.QuoteAsset,
+			IsSpotTradingAllowed: info.IsSpotTradingAllowed,
+			LastSeenAt:           &now,
+		}
+
+		previous, ok := known[info.Symbol]
+		if !ok {
+			current.FirstSeenAt = &now
+			created = append(created, current)
+
+			if seeded {
+				events = append(events, ListingEvent{Kind: ListingEventNewSymbol, Current: current})
+				if current.tradingEnabled() {
+					events = append(events, ListingEvent{Kind: ListingEventTradingEnabled, Current: current})
+				}
+			}
+			continue
+		}
+
+		if previous.Status == current.Status && previous.IsSpotTradingAllowed == current.IsSpotTradingAllowed &&
+			previous.BaseAsset == current.BaseAsset && previous.QuoteAsset == current.QuoteAsset {
+			continue
+		}
+
+		current.ID = previous.ID
+		current.FirstSeenAt = previous.FirstSeenAt
+		changed = append(changed, current)
+
+		if previous.Status != current.Status || previous.IsSpotTradingAllowed != current.IsSpotTradingAllowed {
+			previous := previous
+			events = append(events, ListingEvent{Kind: ListingEventStatusChanged, Previous: &previous, Current: current})
+			if !previous.tradingEnabled() && current.tradingEnabled() {
+				events = append(events, ListingEvent{Kind: ListingEventTradingEnabled, Previous: &previous, Current: current})
+			}
+		}
+	}
+
+	if len(created) == 0 && len(changed) == 0 {
+		return nil, nil
+	}
+
+	// the changes are saved together so a failure leaves the stored snapshot as it was and they are seen again
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(created) > 0 {
+			if err := tx.Model(&SymbolSnapshot{}).CreateInBatches(&created, 200).Error; err != nil {
+				return fmt.Errorf("error saving new snapshots: %v", err)
+			}
+		}
+
+		for _, current := range changed {
+			err := tx.Model(&SymbolSnapshot{}).Where("id = ?", current.ID).Updates(map[string]interface{}{
+				"status":                  current.Status,
+				"base_asset":              current.BaseAsset,
+				"quote_asset":             current.QuoteAsset,
+				"is_spot_trading_allowed": current.IsSpotTradingAllowed,
+				"last_seen_at":            now,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("error saving snapshot of %s: %v", current.Symbol, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.RLock()
+	handlers := w.handlers
+	w.mu.RUnlock()
+
+	for _, event := range events {
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+
+	return events, nil
+}
+
+// ListingOrderRules decide which listings get an order created automatically and with which budget
+type ListingOrderRules struct {
+	QuoteAssets     []string
+	MaxBudget       decimal.Decimal
+	MaxPricePercent float64 // the buys stop above the first trade price plus this percentage
+	Blacklist       []string
+}
+
+func NewListingOrderRules(cfg config.Config) ListingOrderRules {
+	return ListingOrderRules{
+		QuoteAssets:     cfg.ListingAutoOrderQuoteAssets,
+		MaxBudget:       cfg.ListingAutoOrderMaxBudget,
+		MaxPricePercent: cfg.ListingAutoOrderMaxPricePercent,
+		Blacklist:       cfg.ListingAutoOrderBlacklist,
+	}
+}
+
+// Allows reports whether the symbol is quoted in one of the assets and is not blacklisted,
+// the blacklist takes symbols as well as base assets. Nothing is allowed without a budget and a max price.
+func (rules ListingOrderRules) Allows(snapshot SymbolSnapshot) bool {
+	if rules.MaxBudget.Sign() <= 0 || rules.MaxPricePercent <= 0 {
+		return false
+	}
+
+	quoted := len(rules.QuoteAssets) == 0
+	for _, quoteAsset := range rules.QuoteAssets {
+		if strings.EqualFold(strings.TrimSpace(quoteAsset), snapshot.QuoteAsset) {
+			quoted = true
+			break
+		}
+	}
+	if !quoted {
+		return false
+	}
+
+	for _, blacklisted := range rules.Blacklist {
+		blacklisted = strings.TrimSpace(blacklisted)
+		if strings.EqualFold(blacklisted, snapshot.Symbol) || strings.EqualFold(blacklisted, snapshot.BaseAsset) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// autoCreateListingOrder buys a symbol as soon as it can be traded when the rules allow it,
+// never above the max price of the rules over its first trade
+func autoCreateListingOrder(ctx context.Context, db *gorm.DB, rules ListingOrderRules, event ListingEvent) error {
+	if event.Kind != ListingEventTradingEnabled || !rules.Allows(event.Current) {
+		return nil
+	}
+
+	// an order may already have been created by hand for the listing
+	var count int64
+	err := db.WithContext(ctx).Model(&Order{}).
+		Where("symbol = ? AND venue = ? AND status IN ?", event.Current.Symbol, event.Current.Venue,
+			[]OrderStatus{StatusPending, StatusArmed, StatusBuying, StatusBought, StatusSelling}).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+
+	symbol := event.Current.Symbol
+	venue := event.Current.Venue
+	budget := rules.MaxBudget
+	maxPricePercent := rules.MaxPricePercent
+	scheduleTime := time.Now()
+
+	order := Order{
+		Symbol:          &symbol,
+		Venue:           &venue,
+		ScheduleTime:    &scheduleTime,
+		Price:           &budget,
+		MaxPricePercent: &maxPricePercent,
+	}
+
+	return CreateOrder(ctx, db, &order)
+}
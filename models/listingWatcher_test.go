@@ -0,0 +1,115 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"context"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func storedSnapshots(t *testing.T, db *gorm.DB) map[string]SymbolSnapshot {
+	t.Helper()
+
+	var snapshots []SymbolSnapshot
+	if err := db.Model(&SymbolSnapshot{}).Find(&snapshots).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	bySymbol := map[string]SymbolSnapshot{}
+	for _, snapshot := range snapshots {
+		bySymbol[snapshot.Symbol] = snapshot
+	}
+	return bySymbol
+}
+
+func TestListingWatcherPollWritesOnlyTheChanges(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	infos := []exchange.SymbolInfo{
+		{Symbol: "FOOUSDT", Status: "1", BaseAsset: "FOO", QuoteAsset: "USDT", IsSpotTradingAllowed: true},
+		{Symbol: "BARUSDT", Status: "2", BaseAsset: "BAR", QuoteAsset: "USDT", IsSpotTradingAllowed: true},
+	}
+	watcher := NewListingWatcher("mexc", func() ([]exchange.SymbolInfo, error) {
+		return infos, nil
+	}, time.Minute)
+
+	var handled []ListingEvent
+	watcher.OnListing(func(event ListingEvent) {
+		handled = append(handled, event)
+	})
+
+	// the first poll seeds the table
+	events, err := watcher.Poll(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeded := storedSnapshots(t, db)
+	if len(events) != 0 || len(seeded) != 2 {
+		t.Fatalf("%d events and %d snapshots, want none and 2", len(events), len(seeded))
+	}
+
+	// nothing changed, nothing is written
+	events, err = watcher.Poll(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("%d events, want none", len(events))
+	}
+	for symbol, snapshot := range storedSnapshots(t, db) {
+		if !snapshot.LastSeenAt.Equal(*seeded[symbol].LastSeenAt) {
+			t.Errorf("%s written again without a change", symbol)
+		}
+	}
+
+	infos[1].Status = "1"
+	infos = append(infos, exchange.SymbolInfo{Symbol: "BAZUSDT", Status: "2", BaseAsset: "BAZ", QuoteAsset: "USDT"})
+
+	events, err = watcher.Poll(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	for _, event := range events {
+		kinds = append(kinds, string(event.Kind)+":"+event.Current.Symbol)
+	}
+	want := []string{"status_changed:BARUSDT", "trading_enabled:BARUSDT", "new_symbol:BAZUSDT"}
+	if len(kinds) != len(want) {
+		t.Fatalf("events = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("events = %v, want %v", kinds, want)
+			break
+		}
+	}
+	if len(handled) != len(events) {
+		t.Errorf("%d events handled, want %d", len(handled), len(events))
+	}
+
+	stored := storedSnapshots(t, db)
+	if stored["BARUSDT"].Status != "1" || stored["BAZUSDT"].ID == seeded["FOOUSDT"].ID || len(stored) != 3 {
+		t.Errorf("snapshots = %+v", stored)
+	}
+	if !stored["FOOUSDT"].LastSeenAt.Equal(*seeded["FOOUSDT"].LastSeenAt) {
+		t.Error("FOOUSDT written again without a change")
+	}
+}
+
+func TestListingOrderRulesNeedAMaxPrice(t *testing.T) {
+	snapshot := SymbolSnapshot{Symbol: "FOOUSDT", BaseAsset: "FOO", QuoteAsset: "USDT"}
+	rules := ListingOrderRules{QuoteAssets: []string{"USDT"}, MaxBudget: decimal.New(50), MaxPricePercent: 20}
+
+	if !rules.Allows(snapshot) {
+		t.Error("a listing within the rules is refused")
+	}
+
+	rules.MaxPricePercent = 0
+	if rules.Allows(snapshot) {
+		t.Error("a listing is allowed without a max price")
+	}
+}
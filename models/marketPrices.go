@@ -0,0 +1,79 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"time"
+)
+
+// streamMaxAge is how old a streamed book can be before the REST ticker is asked instead
+const streamMaxAge = 2 * time.Second
+
+// marketCache returns the cache of the MEXC market stream when the order trades on MEXC and the stream runs.
+// A paper order takes its prices from the paper exchange, which may replay a recording.
+func marketCache(order Order) *exchange.MarketCache {
+	if order.isPaper() || (order.Venue != nil && *order.Venue != exchange.VenueMEXC) {
+		return nil
+	}
+
+	stream := exchange.MEXCMarketStream()
+	if stream == nil {
+		return nil
+	}
+	return stream.Cache()
+}
+
+// watchSymbol subscribes the market stream to the symbol of the order
+func watchSymbol(order Order) {
+	stream := exchange.MEXCMarketStream()
+	if stream == nil || order.Symbol == nil || marketCache(order) == nil {
+		return
+	}
+	stream.WatchSymbol(*order.Symbol)
+}
+
+// lastPrice returns the last traded price of the symbol, from the stream when it is fresh
+func lastPrice(ex exchange.Exchange, order Order) (decimal.Decimal, error) {
+	if cache := marketCache(order); cache != nil {
+		if deal, ok := cache.LastDeal(*order.Symbol, streamMaxAge); ok {
+			return deal.Price, nil
+		}
+	}
+
+	ticker, err := ex.GetTicker(*order.Symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return ticker.LastPrice, nil
+}
+
+// bestPrices returns the best bid and ask of the symbol, from the stream when they are fresh
+func bestPrices(ex exchange.Exchange, order Order) (bid decimal.Decimal, ask decimal.Decimal, err error) {
+	if cache := marketCache(order); cache != nil {
+		if book, ok := cache.BookTicker(*order.Symbol, streamMaxAge); ok {
+			return book.BidPrice, book.AskPrice, nil
+		}
+	}
+
+	ticker, err := ex.GetTicker(*order.Symbol)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+
+	ask = ticker.AskPrice
+	if ask.Sign() <= 0 {
+		ask = ticker.LastPrice
+	}
+	return ticker.BidPrice, ask, nil
+}
+
+// firstTradePrice returns the price of the first trade seen on the stream, else the last price
+func firstTradePrice(ex exchange.Exchange, order Order) (decimal.Decimal, error) {
+	if cache := marketCache(order); cache != nil {
+		if deal, ok := cache.FirstDeal(*order.Symbol); ok {
+			return deal.Price, nil
+		}
+	}
+
+	return lastPrice(ex, order)
+}
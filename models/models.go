@@ -2,37 +2,23 @@ package models
 
 import (
 	"NewListingBot/config"
+	"NewListingBot/decimal"
 	"NewListingBot/exchange"
 	"NewListingBot/logger"
+	"NewListingBot/scheduler"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
-	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"log"
-	"strconv"
+	"strings"
 	"time"
 )
 
-var cronScheduler *cron.Cron
-var timeLocation time.Location
-
-func init() {
-	timeLocation, err := time.LoadLocation("Africa/Lagos") // Use the appropriate time zone for West Africa
-	if err != nil {
-		// Handle error, maybe log it
-		fmt.Println("Error loading location:", err)
-		return
-	}
-
-	cronScheduler = cron.New(cron.WithLocation(timeLocation))
-	go cronScheduler.Start()
-}
-
-func timeToCron(t time.Time) string {
-	return fmt.Sprintf("%d %d %d %d *", t.Minute(), t.Hour(), t.Day(), t.Month())
-}
+// newExchange resolves the venue an order is traded on, it is a variable so fakes can be swapped in
+var newExchange = exchange.New
 
 // BaseModel / This is actually used to create most used fields like timestamp, uuid and do some custom process **/
 type BaseModel struct {
@@ -48,174 +34,466 @@ func (m *BaseModel) BeforeCreate(db *gorm.DB) (err error) {
 
 type Order struct {
 	BaseModel
-	Symbol           *string       `json:"symbol"`
-	ScheduleTime     *time.Time    `json:"schedule_time"`
-	ScheduleSellTime *time.Time    `json:"schedule_sell_time"`
-	BoughtTime       *time.Time    `json:"bought_time"`
-	SoldTime         *time.Time    `json:"sold_time"`
-	Bought           *bool         `json:"bought"`
-	Sold             *bool         `json:"sold"`
-	Price            *float64      `json:"price"`
-	Quantity         *float64      `json:"quantity"`
-	SoldPrice        *float64      `json:"sold_price"`
-	Profit           *float64      `json:"profit"`
-	BuyComplete      chan struct{} `json:"-" gorm:"-"`
-}
-
-func (order *Order) ScheduleBuyScheduler(ctx context.Context, db *gorm.DB, orderID uuid.UUID, scheduleTime time.Time) {
-	var foundOrder Order
+	Symbol           *string              `json:"symbol"`
+	Venue            *string              `json:"venue" gorm:"default:mexc"`
+	ScheduleTime     *time.Time           `json:"schedule_time"`
+	ScheduleSellTime *time.Time           `json:"schedule_sell_time"`
+	BoughtTime       *time.Time           `json:"bought_time"`
+	SoldTime         *time.Time           `json:"sold_time"`
+	Status           OrderStatus          `json:"status" gorm:"default:pending;index"`
+	ClientOrderID    *string              `json:"client_order_id"`
+	ExchangeOrderID  *string              `json:"exchange_order_id"`
+	Price            *decimal.Decimal     `json:"price"`
+	Quantity         *decimal.Decimal     `json:"quantity"`
+	SoldPrice        *decimal.Decimal     `json:"sold_price"`
+	Profit           *decimal.Decimal     `json:"profit"`
+	EntryPrice       *decimal.Decimal     `json:"entry_price"`
+	Fees             *decimal.Decimal     `json:"fees"`
+	CostBasis        *decimal.Decimal     `json:"cost_basis"`
+	ROI              *float64             `json:"roi"`
+	BurstPlan        *scheduler.BurstPlan `json:"burst_plan" gorm:"serializer:json"`
+	MissedPolicy     *string              `json:"missed_policy" gorm:"default:skip"`
+	BuyOrderType     *string              `json:"buy_order_type" gorm:"default:MARKET"`
+	SellOrderType    *string              `json:"sell_order_type" gorm:"default:MARKET"`
+	MaxPrice         *decimal.Decimal     `json:"max_price"`
+	MaxPricePercent  *float64             `json:"max_price_percent"`
+	FirstTradePrice  *decimal.Decimal     `json:"first_trade_price"`
+	ExitPlan         *ExitPlan            `json:"exit_plan" gorm:"serializer:json"`
+	TakeProfitsDone  int                  `json:"take_profits_done"`
+	SoldQuantity     *decimal.Decimal     `json:"sold_quantity"`
+	HighWaterMark    *decimal.Decimal     `json:"high_water_mark"`
+	PendingSell      *PendingSell         `json:"pending_sell"`
+	AnnouncementKey  *string              `json:"announcement_key" gorm:"index"`
+	AnnouncementURL  *string              `json:"announcement_url"`
+	// simulated on the paper exchange, its results are kept apart from the real ones
+	Paper *bool `json:"paper" gorm:"default:false;index"`
+}
 
-	cfg, err := config.Load()
+func buyJobKey(orderID uuid.UUID) string {
+	return "buy:" + orderID.String()
+}
+
+func sellJobKey(orderID uuid.UUID) string {
+	return "sell:" + orderID.String()
+}
+
+// buyClientOrderID returns a new client order id for a buy attempt of the order. The suffix differs on every attempt
+// so an attempt is not refused as the duplicate of an earlier one, the id is kept on the order before it is sent
+// so a lost response, the user stream and a restart can find the buy.
+func (order *Order) buyClientOrderID() string {
+	suffix := strings.ReplaceAll(uuid.New().String(), "-", "")[:8]
+	return "nlb" + strings.ReplaceAll(order.ID.String(), "-", "")[:21] + suffix
+}
+
+// sellClientOrderID returns a new client order id for an exit sell of the order, kept on the order
+// so a restart in the middle of the sell can find it
+func (order *Order) sellClientOrderID() string {
+	suffix := strings.ReplaceAll(uuid.New().String(), "-", "")[:8]
+	return "nls" + strings.ReplaceAll(order.ID.String(), "-", "")[:21] + suffix
+}
+
+// burstPlan returns the plan of the order or the default one
+func (order *Order) burstPlan() scheduler.BurstPlan {
+	if order.BurstPlan != nil {
+		return *order.BurstPlan
+	}
+	return scheduler.DefaultBurstPlan
+}
+
+// CreateOrder saves a new order and arms its buy and sell jobs,
+// the sell is scheduled a minute after the buy when the order has no sell time
+func CreateOrder(ctx context.Context, db *gorm.DB, order *Order) error {
+	order.applyPaperDefault()
+
+	if order.ScheduleSellTime == nil && order.ScheduleTime != nil {
+		scheduleSellTime := order.ScheduleTime.Add(time.Minute * 1)
+		order.ScheduleSellTime = &scheduleSellTime
+	}
+
+	err := db.WithContext(ctx).Model(&Order{}).Create(order).Error
 	if err != nil {
-		logger.Error(context.Background(), "error loading config on scheduler", zap.Error(err))
-		return
+		return err
 	}
 
-	mexc := exchange.NewMXCExchange(cfg)
+	// arm the buy attempts of the burst plan around the schedule time
+	order.ScheduleBuyScheduler(ctx, db)
 
-	err = db.WithContext(ctx).Model(&Order{}).Where("id = ?", orderID).First(&foundOrder).Error
+	// make the schedule for all sell operations
+	order.ScheduleSellScheduler(ctx, db)
+
+	return nil
+}
+
+// ScheduleBuyScheduler persists the buy job of the order and arms every attempt of its burst plan
+func (order *Order) ScheduleBuyScheduler(ctx context.Context, db *gorm.DB) {
+	var foundOrder Order
+
+	err := db.WithContext(ctx).Model(&Order{}).Where("id = ?", order.ID).First(&foundOrder).Error
 	if err != nil {
 		log.Println("error fetching order", err)
 		return
 	}
 
-	// If the order is not sold and has a scheduled time
-	if foundOrder.ScheduleTime != nil && foundOrder.BoughtTime == nil {
-		// Schedule a task to buy at the specified time
-		_, err := cronScheduler.AddFunc(timeToCron(scheduleTime), func() {
-			err := buy(ctx, db, *mexc, foundOrder)
-			if err != nil {
-				logger.Error(ctx, "error buying and selling", zap.Error(err))
-			}
-		})
-		if err != nil {
-			logger.Error(ctx, "error on cron scheduler buy", zap.Error(err))
-			return
-		}
+	// Only a pending order with a scheduled time can be armed
+	if foundOrder.ScheduleTime == nil || foundOrder.Status != StatusPending {
+		return
+	}
 
+	job, err := createScheduledJob(ctx, db, foundOrder.ID, JobKindBuy, *foundOrder.ScheduleTime)
+	if err != nil {
+		logger.Error(ctx, "error persisting buy job", zap.Error(err))
+		return
+	}
+
+	err = foundOrder.Transition(ctx, db, StatusArmed, "buy attempts armed", nil, nil)
+	if err != nil {
+		logger.Error(ctx, "error arming order", zap.Error(err))
+		return
 	}
+
+	armBuyJob(db, foundOrder, job)
 }
 
+// ScheduleSellScheduler persists the sell job of the order and arms it at its schedule sell time
 func (order *Order) ScheduleSellScheduler(ctx context.Context, db *gorm.DB) {
 
-	cfg, err := config.Load()
+	if order.ScheduleSellTime == nil {
+		return
+	}
+
+	job, err := createScheduledJob(ctx, db, order.ID, JobKindSell, *order.ScheduleSellTime)
 	if err != nil {
-		logger.Error(context.Background(), "error loading config on scheduler", zap.Error(err))
+		logger.Error(ctx, "error persisting sell job", zap.Error(err))
+		return
 	}
-	mexc := exchange.NewMXCExchange(cfg)
 
-	// Schedule a task to sell at the specified time
-	if order.ScheduleSellTime != nil && order.Bought != nil && *order.Bought == true {
-		_, err := cronScheduler.AddFunc(timeToCron(*order.ScheduleSellTime), func() {
-			err := sell(ctx, db, *mexc, order.ID)
-			if err != nil {
-				logger.Error(ctx, "error selling", zap.Error(err))
+	armSellJob(db, *order, job)
+}
+
+func armBuyJob(db *gorm.DB, order Order, job ScheduledJob) {
+	// the request context is gone once the jobs fire
+	jobCtx := context.Background()
+
+	ex, err := exchangeForOrder(order)
+	if err != nil {
+		logger.Error(jobCtx, "error resolving exchange on scheduler", zap.Error(err))
+		return
+	}
+
+	// the stream gives the first trade and the book without asking the REST api on every attempt
+	watchSymbol(order)
+
+	scheduler.Default.ScheduleBurst(buyJobKey(order.ID), *job.RunAt, order.burstPlan(), func(attempt int) {
+		err := buy(jobCtx, db, ex, order)
+		if errors.Is(err, errBuyAttemptSkipped) {
+			// another attempt holds the order, it takes care of the outcome
+			return
+		}
+
+		if err != nil {
+			logger.Error(jobCtx, "error buying", zap.Int("attempt", attempt),
+				zap.String("category", string(exchange.ClassifyError(err))), zap.Error(err))
+
+			reason := "every buy attempt failed"
+			if !isRetryableBuyError(err) {
+				// the next attempts would get the same answer
+				scheduler.Default.Cancel(buyJobKey(order.ID))
+				reason = err.Error()
 			}
-		})
+
+			if scheduler.Default.Pending(buyJobKey(order.ID)) == 0 {
+				markScheduledJob(jobCtx, db, job.ID, JobStatusDone)
+				// a late attempt may still be running so a conflict is fine
+				err = TransitionOrder(jobCtx, db, order.ID, StatusArmed, StatusFailed, reason, nil, nil)
+				if err != nil && !errors.Is(err, ErrOrderStatusConflict) {
+					logger.Error(jobCtx, "error failing order", zap.Error(err))
+				}
+			}
+			return
+		}
+
+		// the order is bought, the remaining attempts are not needed
+		scheduler.Default.Cancel(buyJobKey(order.ID))
+		markScheduledJob(jobCtx, db, job.ID, JobStatusDone)
+	})
+}
+
+func armSellJob(db *gorm.DB, order Order, job ScheduledJob) {
+	jobCtx := context.Background()
+
+	// sell checks the order was bought once it fires, the job stays pending for the next start when it fails
+	scheduler.Default.Schedule(sellJobKey(order.ID), *job.RunAt, func() {
+		err := sell(jobCtx, db, order.ID)
 		if err != nil {
-			logger.Error(ctx, "error on cron scheduler sell", zap.Error(err))
+			logger.Error(jobCtx, "error selling", zap.Error(err))
 			return
 		}
+
+		markScheduledJob(jobCtx, db, job.ID, JobStatusDone)
+	})
+}
+
+// exchangeForOrder returns the exchange the order was created for, the paper exchange of its venue for a paper order
+func exchangeForOrder(order Order) (exchange.Exchange, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
 	}
+
+	venue := exchange.VenueMEXC
+	if order.Venue != nil {
+		venue = *order.Venue
+	}
+
+	if order.isPaper() {
+		return exchange.PaperExchangeFor(venue, cfg)
+	}
+
+	return newExchange(venue, cfg)
+}
+
+func (order *Order) isPaper() bool {
+	return order.Paper != nil && *order.Paper
 }
 
-func buy(ctx context.Context, db *gorm.DB, mexc exchange.MEXCExchange, order Order) error {
+// closeLostPaperOrder settles a paper order cut by a restart. The paper exchange keeps its orders and
+// balances in memory, so a buy or a sell in flight and a bought position are gone with the previous process.
+// It reports whether the order was closed.
+func closeLostPaperOrder(ctx context.Context, db *gorm.DB, order *Order) (bool, error) {
+	if !order.isPaper() {
+		return false, nil
+	}
+
+	switch order.Status {
+	case StatusBuying:
+		return true, order.Transition(ctx, db, StatusArmed, "paper buy lost with the restart", nil, nil)
+	case StatusBought:
+		return true, order.Transition(ctx, db, StatusCancelled, "paper position lost with the restart", nil, nil)
+	case StatusSelling:
+		return true, order.Transition(ctx, db, StatusFailed, "paper sell lost with the restart", nil, map[string]interface{}{
+			"pending_sell": nil,
+		})
+	}
+
+	return false, nil
+}
 
-	quoteOrderQty := *order.Price
-	buyResponse, err := mexc.Buy(*order.Symbol, int(quoteOrderQty))
+// applyPaperDefault makes the new order a paper one when paper trading is on globally
+// and the order did not choose
+func (order *Order) applyPaperDefault() {
+	if order.Paper != nil {
+		return
+	}
+
+	cfg, err := config.Load()
+	if err == nil {
+		order.Paper = &cfg.PaperTrading
+	}
+}
+
+// errBuyAttemptSkipped is returned by buy when the order is not armed anymore,
+// another attempt is buying it or already bought it
+var errBuyAttemptSkipped = errors.New("buy attempt skipped")
+
+// isRetryableBuyError reports whether the next attempts of the burst can succeed where this one failed.
+// The exchange errors are only worth retrying while the symbol is not listed yet.
+func isRetryableBuyError(err error) bool {
+	switch {
+	case errors.Is(err, ErrNoTradeYet), errors.Is(err, ErrPriceAboveMax), errors.Is(err, ErrNotFilled):
+		return true
+	case errors.Is(err, exchange.ErrOrderStateUnknown):
+		return true
+	case errors.Is(err, ErrBuyNotCancelled):
+		// a new buy could fill along with the one still on the book
+		return false
+	}
+
+	var mexcError *exchange.MEXCError
+	if errors.As(err, &mexcError) {
+		return exchange.IsNotListedYet(err)
+	}
+
+	// failures before reaching the exchange, like the network, are worth another try
+	return !errors.Is(err, exchange.ErrSymbolRules)
+}
+
+func buy(ctx context.Context, db *gorm.DB, ex exchange.Exchange, order Order) error {
+
+	clientOrderID := order.buyClientOrderID()
+
+	// only one attempt at a time can hold the order in buying, the others have nothing to do.
+	// The client order id is kept first so the user stream can match the executions to the order.
+	err := TransitionOrder(ctx, db, order.ID, StatusArmed, StatusBuying, "buy attempt started", nil, map[string]interface{}{
+		"client_order_id": clientOrderID,
+	})
+	if errors.Is(err, ErrOrderStatusConflict) {
+		return errBuyAttemptSkipped
+	}
+	if err != nil {
+		return err
+	}
+
+	buyResponse, err := placeBuyOrder(ctx, db, ex, &order, clientOrderID)
 	boughtTime := time.Now()
 
+	if errors.Is(err, exchange.ErrOrderStateUnknown) {
+		// the order may have gone through, look it up before giving it back to the next attempts
+		placedOrder, lookupErr := ex.GetOrderByClientID(*order.Symbol, clientOrderID)
+		if lookupErr == nil && placedOrder.OrderId != "" && placedOrder.ExecutedQty.Sign() > 0 {
+			buyResponse, err = placedOrder, nil
+		}
+	}
+
 	if err != nil {
 		logger.Error(context.Background(), fmt.Sprintf("error buying %s", *order.Symbol), zap.Error(err))
+
+		// give the order back to the next attempts
+		transitionErr := TransitionOrder(ctx, db, order.ID, StatusBuying, StatusArmed, err.Error(), nil, nil)
+		if transitionErr != nil {
+			logger.Error(ctx, "error re-arming order", zap.Error(transitionErr))
+		}
 		return err
 	}
 
-	quantity, err := strconv.ParseFloat(buyResponse.OrigQty, 64)
+	return recordBuy(ctx, db, ex, order, buyResponse, boughtTime)
+}
+
+// recordBuy moves the order from buying to bought with what actually executed on the exchange
+func recordBuy(ctx context.Context, db *gorm.DB, ex exchange.Exchange, order Order, buyResponse exchange.OrderResponse, boughtTime time.Time) error {
+	quantity := buyResponse.OrigQty
+
+	// the placement response does not tell what was filled nor the fees, the trades do
+	fills, err := reconcileFills(ex, *order.Symbol, buyResponse.OrderId)
 	if err != nil {
-		logger.Error(context.Background(), "error converting quantity to float", zap.Error(err))
-		return nil
+		logger.Error(ctx, "error reconciling buy fills", zap.Error(err))
+	} else if fills.Quantity.Sign() > 0 {
+		quantity = fills.Quantity
+
+		symbolInfo, err := ex.GetSymbolInfo(*order.Symbol)
+		if err == nil {
+			quantity = fills.netQuantity(symbolInfo.BaseAsset)
+		}
 	}
 
-	err = db.WithContext(ctx).Model(Order{}).Where("id = ?", order.ID).
-		Update("bought", true).
-		Update("bought_time", boughtTime).
-		Update("quantity", quantity).
-		Error
+	err = TransitionOrder(ctx, db, order.ID, StatusBuying, StatusBought, "buy order placed", buyResponse, map[string]interface{}{
+		"bought_time":       boughtTime,
+		"quantity":          quantity,
+		"exchange_order_id": buyResponse.OrderId,
+	})
+	if errors.Is(err, ErrOrderStatusConflict) && orderStatus(ctx, db, order.ID) == StatusBought {
+		// the user stream saw the executions first and already recorded the buy
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	// Signal completion through the channel
-	order.BuyComplete <- struct{}{}
+	err = recordFills(ctx, db, ex, order, exchange.OrderSideBuy, buyResponse.OrderId)
+	if err != nil {
+		logger.Error(ctx, "error recording buy fills", zap.Error(err))
+	}
+
+	// a buy landing after the sell time is not picked up by the sell job anymore
+	if order.ScheduleSellTime == nil || !order.ScheduleSellTime.After(time.Now()) {
+		if err := sell(ctx, db, order.ID); err != nil {
+			logger.Error(ctx, "error tracking bought order", zap.Error(err))
+		}
+	}
+
 	return nil
 }
 
-func IsProfitAvailable(ctx context.Context, mexc exchange.MEXCExchange, order Order, targetPercentage float64) (bool, error) {
-	marketPrice, err := mexc.GetMarketPrice(*order.Symbol)
+// orderStatus returns the current status of the order in the database
+func orderStatus(ctx context.Context, db *gorm.DB, orderID uuid.UUID) OrderStatus {
+	var order Order
+	if err := db.WithContext(ctx).Model(&Order{}).Select("status").Where("id = ?", orderID).First(&order).Error; err != nil {
+		return ""
+	}
+	return order.Status
+}
+
+// sellQuantity caps the quantity to what is really available to sell on the exchange
+func sellQuantity(ex exchange.Exchange, order Order, quantity decimal.Decimal) decimal.Decimal {
+
+	symbolInfo, err := ex.GetSymbolInfo(*order.Symbol)
 	if err != nil {
-		logger.Error(ctx, "Error getting market price", zap.Error(err))
-		return false, err
+		return quantity
+	}
+
+	free, err := freeBalance(ex, symbolInfo.BaseAsset)
+	if err != nil || !free.LessThan(quantity) {
+		return quantity
 	}
 
-	lastPrice, err := strconv.ParseFloat(marketPrice.LastPrice, 64)
+	return free
+}
+
+// reconcileBuyingOrder settles an order left in buying, for example by a restart in the middle of an attempt,
+// by looking its buy up on the exchange
+func reconcileBuyingOrder(ctx context.Context, db *gorm.DB, order *Order) error {
+	ex, err := exchangeForOrder(*order)
 	if err != nil {
-		logger.Error(ctx, "Error converting LastPrice to float64", zap.Error(err))
-		return false, err
+		return err
 	}
 
-	averagePrice := calculateAveragePrice(order)
+	if order.ClientOrderID == nil {
+		return order.Transition(ctx, db, StatusArmed, "no buy sent before the restart", nil, nil)
+	}
 
-	percentageIncrease := ((lastPrice - averagePrice) / averagePrice) * 100
+	placedOrder, err := ex.GetOrderByClientID(*order.Symbol, *order.ClientOrderID)
+	if err == nil && placedOrder.OrderId != "" {
+		if openExchangeStatuses[placedOrder.Status] {
+			// a limit buy left on the book, what did not fill is not wanted anymore
+			err = cancelBuyRemainder(ex, *order.Symbol, placedOrder.OrderId)
+			if err != nil {
+				return err
+			}
+			if refreshed, err := ex.GetOrder(*order.Symbol, placedOrder.OrderId); err == nil {
+				placedOrder = refreshed
+			}
+		}
 
-	if percentageIncrease >= targetPercentage {
-		return true, nil
+		if placedOrder.ExecutedQty.Sign() > 0 {
+			err = recordBuy(ctx, db, ex, *order, placedOrder, time.Now())
+			if err != nil {
+				return err
+			}
+			order.Status = StatusBought
+			return nil
+		}
 	}
 
-	return false, nil
+	return order.Transition(ctx, db, StatusArmed, "no buy found on the exchange", nil, nil)
 }
 
-func sell(ctx context.Context, db *gorm.DB, mexc exchange.MEXCExchange, orderID uuid.UUID) error {
+// sell hands the bought order to the position monitor which exits it following its exit plan
+func sell(ctx context.Context, db *gorm.DB, orderID uuid.UUID) error {
 	var order Order
 
-	err := db.WithContext(ctx).Model(Order{}).Where("id = ?", orderID).First(&order).Error
+	err := db.WithContext(ctx).Model(&Order{}).Where("id = ?", orderID).First(&order).Error
 	if err != nil {
 		return err
 	}
 
-	if order.Bought != nil && *order.Bought == true {
-
-		targetPercentage := 10.0
-		available, err := IsProfitAvailable(ctx, mexc, order, targetPercentage)
-		if err != nil {
-			return err
-		}
-
-		if !available {
-			time.Sleep(60)
-			return sell(ctx, db, mexc, orderID)
-		}
-		sellResponse, err := mexc.Sell(*order.Symbol, *order.Quantity)
-		soldTime := time.Now()
-		if err != nil {
-			logger.Error(context.Background(), fmt.Sprintf("error selling %s", *order.Symbol), zap.Error(err))
-			return err
-		}
-		log.Println("sellResponse", sellResponse)
+	if order.Status != StatusBought && order.Status != StatusSelling {
+		return nil
+	}
 
-		err = db.WithContext(ctx).Model(Order{}).Where("id = ?", order.ID).
-			Update("sold", true).
-			Update("sold_time", soldTime).Error
-		if err != nil {
-			return err
-		}
+	if positionMonitor == nil {
+		return errPositionMonitorStopped
 	}
 
-	return nil
+	return positionMonitor.Track(order)
 }
 
-func calculateAveragePrice(order Order) float64 {
-	if order.Quantity != nil && *order.Quantity != 0 && order.Price != nil {
-		return *order.Price / *order.Quantity
+// calculateAveragePrice returns the entry price of the order from its fills,
+// the budget over the quantity while the fills are not known
+func calculateAveragePrice(order Order) decimal.Decimal {
+	if order.EntryPrice != nil && order.EntryPrice.Sign() > 0 {
+		return *order.EntryPrice
+	}
+	if order.Quantity != nil && order.Quantity.Sign() > 0 && order.Price != nil {
+		return order.Price.Div(*order.Quantity)
 	}
-	return 0
+	return decimal.Zero
 }
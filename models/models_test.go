@@ -0,0 +1,426 @@
+package models
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+// createTestOrder saves a real order of the fake exchange in the status, its sell is due in an hour
+func createTestOrder(t *testing.T, db *gorm.DB, status OrderStatus) Order {
+	t.Helper()
+
+	symbol, venue, paper := "FOOUSDT", "fake", false
+	price := decimal.RequireFromString("50")
+	scheduleTime := time.Now()
+	scheduleSellTime := scheduleTime.Add(time.Hour)
+
+	order := Order{
+		Symbol:           &symbol,
+		Venue:            &venue,
+		ScheduleTime:     &scheduleTime,
+		ScheduleSellTime: &scheduleSellTime,
+		Status:           status,
+		Price:            &price,
+		Paper:            &paper,
+	}
+	if err := db.Model(&Order{}).Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func reloadOrder(t *testing.T, db *gorm.DB, order Order) Order {
+	t.Helper()
+
+	var reloaded Order
+	if err := db.Model(&Order{}).Where("id = ?", order.ID).First(&reloaded).Error; err != nil {
+		t.Fatal(err)
+	}
+	return reloaded
+}
+
+// useFakeExchange makes every real order trade on the fake exchange for the test
+func useFakeExchange(t *testing.T, ex exchange.Exchange) {
+	t.Helper()
+
+	previous := newExchange
+	newExchange = func(venue string, cfg config.Config) (exchange.Exchange, error) {
+		return ex, nil
+	}
+	t.Cleanup(func() {
+		newExchange = previous
+	})
+}
+
+func TestBuyRecordsTheExecutedQuantity(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := createTestOrder(t, db, StatusArmed)
+
+	err := buy(context.Background(), db, ex, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bought := reloadOrder(t, db, order)
+	if bought.Status != StatusBought {
+		t.Fatalf("status = %s, want %s", bought.Status, StatusBought)
+	}
+
+	// 50 USDT at 2 is 25 FOO, less the commission taken in FOO
+	if want := decimal.RequireFromString("24.975"); bought.Quantity == nil || bought.Quantity.Cmp(want) != 0 {
+		t.Errorf("quantity = %v, want %v", bought.Quantity, want)
+	}
+	if bought.ExchangeOrderID == nil || *bought.ExchangeOrderID != "fake-1" {
+		t.Errorf("exchange order id = %v, want fake-1", bought.ExchangeOrderID)
+	}
+	if bought.ClientOrderID == nil || ex.orders["fake-1"].ClientOrderId != *bought.ClientOrderID {
+		t.Errorf("client order id = %v, want the one of fake-1", bought.ClientOrderID)
+	}
+	if bought.EntryPrice == nil || bought.EntryPrice.Cmp(decimal.New(2)) != 0 {
+		t.Errorf("entry price = %v, want 2", bought.EntryPrice)
+	}
+
+	var fills []OrderFill
+	if err := db.Model(&OrderFill{}).Where("order_id = ?", order.ID).Find(&fills).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(fills) != 1 || fills[0].TradeID != "fake-1-1" || fills[0].Side != exchange.OrderSideBuy {
+		t.Errorf("fills = %+v, want the buy trade", fills)
+	}
+
+	events, err := GetOrderEvents(context.Background(), db, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].ToStatus != StatusBuying || events[1].ToStatus != StatusBought {
+		t.Errorf("events = %+v, want armed to buying to bought", events)
+	}
+}
+
+func TestBuyReArmsAfterAFailure(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	ex.placeErr = errors.New("connection reset")
+	order := createTestOrder(t, db, StatusArmed)
+
+	err := buy(context.Background(), db, ex, order)
+	if err == nil || err.Error() != "connection reset" {
+		t.Fatalf("err = %v, want the placement error", err)
+	}
+
+	if status := reloadOrder(t, db, order).Status; status != StatusArmed {
+		t.Errorf("status = %s, want %s", status, StatusArmed)
+	}
+}
+
+func TestBuyLooksUpAnOrderInUnknownState(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	ex.placeErr = exchange.ErrOrderStateUnknown
+	order := createTestOrder(t, db, StatusArmed)
+
+	err := buy(context.Background(), db, ex, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bought := reloadOrder(t, db, order)
+	if bought.Status != StatusBought || *bought.ExchangeOrderID != "fake-1" {
+		t.Errorf("order = %s %v, want bought by fake-1", bought.Status, bought.ExchangeOrderID)
+	}
+}
+
+func TestBuySkippedWhenNotArmed(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+
+	for _, status := range []OrderStatus{StatusPending, StatusBuying, StatusBought, StatusCancelled} {
+		order := createTestOrder(t, db, status)
+
+		err := buy(context.Background(), db, ex, order)
+		if !errors.Is(err, errBuyAttemptSkipped) {
+			t.Errorf("%s: err = %v, want errBuyAttemptSkipped", status, err)
+		}
+	}
+
+	if len(ex.requests) != 0 {
+		t.Errorf("%d orders placed, want none", len(ex.requests))
+	}
+}
+
+func TestReconcileBuyingOrder(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	useFakeExchange(t, ex)
+
+	buyingOrder := func(clientOrderID string) Order {
+		order := createTestOrder(t, db, StatusBuying)
+		if clientOrderID != "" {
+			order.ClientOrderID = &clientOrderID
+			if err := db.Model(&Order{}).Where("id = ?", order.ID).Update("client_order_id", clientOrderID).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		return order
+	}
+
+	// the buy went through before the restart
+	placed := buyingOrder("nlbplaced")
+	_, err := ex.PlaceMarketOrder(exchange.OrderRequest{
+		Symbol:        "FOOUSDT",
+		Side:          exchange.OrderSideBuy,
+		Type:          exchange.OrderTypeMarket,
+		QuoteOrderQty: decimal.RequireFromString("50"),
+		ClientOrderID: "nlbplaced",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a limit buy was resting on the book
+	resting := buyingOrder("nlbresting")
+	ex.fill = func(request exchange.OrderRequest) decimal.Decimal {
+		return decimal.Zero
+	}
+	_, err = ex.PlaceLimitOrder(exchange.OrderRequest{
+		Symbol:        "FOOUSDT",
+		Side:          exchange.OrderSideBuy,
+		Type:          exchange.OrderTypeLimit,
+		Quantity:      decimal.New(25),
+		Price:         decimal.New(2),
+		ClientOrderID: "nlbresting",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the restart happened before the buy was sent
+	lost := buyingOrder("nlblost")
+	unsent := buyingOrder("")
+
+	for _, order := range []Order{placed, resting, lost, unsent} {
+		if err := reconcileBuyingOrder(context.Background(), db, &order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if status := reloadOrder(t, db, placed).Status; status != StatusBought {
+		t.Errorf("placed order status = %s, want %s", status, StatusBought)
+	}
+	for name, order := range map[string]Order{"resting": resting, "lost": lost, "unsent": unsent} {
+		if status := reloadOrder(t, db, order).Status; status != StatusArmed {
+			t.Errorf("%s order status = %s, want %s", name, status, StatusArmed)
+		}
+	}
+	if len(ex.cancelled) != 1 || ex.cancelled[0] != "fake-2" {
+		t.Errorf("cancelled = %v, want the resting buy fake-2", ex.cancelled)
+	}
+}
+
+func TestExitPositionSellsTheBoughtOrder(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := createTestOrder(t, db, StatusArmed)
+
+	if err := buy(context.Background(), db, ex, order); err != nil {
+		t.Fatal(err)
+	}
+
+	ex.price = decimal.RequireFromString("3")
+	order = reloadOrder(t, db, order)
+
+	// half of it first, the order stays bought
+	err := exitPosition(context.Background(), db, ex, order, exitDecision{Reason: "take profit 1", Fraction: 0.5, LevelsDone: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order = reloadOrder(t, db, order)
+	if order.Status != StatusBought || order.TakeProfitsDone != 1 {
+		t.Fatalf("order = %s with %d levels, want bought with 1", order.Status, order.TakeProfitsDone)
+	}
+	if want := decimal.RequireFromString("12.4875"); order.SoldQuantity == nil || order.SoldQuantity.Cmp(want) != 0 {
+		t.Errorf("sold quantity = %v, want %v", order.SoldQuantity, want)
+	}
+
+	err = exitPosition(context.Background(), db, ex, order, exitDecision{Reason: "take profit 2", LevelsDone: 2, Final: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order = reloadOrder(t, db, order)
+	if order.Status != StatusSold || order.SoldTime == nil {
+		t.Fatalf("order = %s, want sold", order.Status)
+	}
+	if order.SoldQuantity.Cmp(*order.Quantity) != 0 {
+		t.Errorf("sold quantity = %v, want all of %v", order.SoldQuantity, order.Quantity)
+	}
+	if order.SoldPrice == nil || order.SoldPrice.Cmp(decimal.New(3)) != 0 {
+		t.Errorf("sold price = %v, want 3", order.SoldPrice)
+	}
+	if order.Profit == nil || order.Profit.Sign() <= 0 {
+		t.Errorf("profit = %v, want a gain", order.Profit)
+	}
+}
+
+func TestExitPositionRevertsWhenTheSellFails(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := createTestOrder(t, db, StatusArmed)
+
+	if err := buy(context.Background(), db, ex, order); err != nil {
+		t.Fatal(err)
+	}
+	order = reloadOrder(t, db, order)
+
+	ex.placeErr = errors.New("insufficient balance")
+	err := exitPosition(context.Background(), db, ex, order, exitDecision{Reason: "stop loss", Final: true})
+	if err == nil {
+		t.Fatal("the sell error was not returned")
+	}
+
+	order = reloadOrder(t, db, order)
+	if order.Status != StatusBought || order.SoldQuantity != nil {
+		t.Errorf("order = %s sold %v, want bought with nothing sold", order.Status, order.SoldQuantity)
+	}
+}
+
+func TestSellNeedsABoughtOrder(t *testing.T) {
+	db := newTestDB(t)
+
+	previous := positionMonitor
+	positionMonitor = nil
+	t.Cleanup(func() {
+		positionMonitor = previous
+	})
+
+	armed := createTestOrder(t, db, StatusArmed)
+	if err := sell(context.Background(), db, armed.ID); err != nil {
+		t.Errorf("selling an armed order = %v, want nothing done", err)
+	}
+
+	bought := createTestOrder(t, db, StatusBought)
+	if err := sell(context.Background(), db, bought.ID); !errors.Is(err, errPositionMonitorStopped) {
+		t.Errorf("selling without a monitor = %v, want errPositionMonitorStopped", err)
+	}
+}
+
+// boughtTestOrder is an order of the fake exchange bought for 50 USDT at 2
+func boughtTestOrder(t *testing.T, db *gorm.DB, ex *fakeExchange) Order {
+	t.Helper()
+
+	order := createTestOrder(t, db, StatusArmed)
+	if err := buy(context.Background(), db, ex, order); err != nil {
+		t.Fatal(err)
+	}
+	return reloadOrder(t, db, order)
+}
+
+func TestExitPositionRecordsTheQuantitySold(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := boughtTestOrder(t, db, ex)
+
+	// some of it was moved away by hand, only the balance left is sold
+	ex.balances["FOO"] = decimal.New(20)
+
+	err := exitPosition(context.Background(), db, ex, order, exitDecision{Reason: "stop loss", Final: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order = reloadOrder(t, db, order)
+	if order.Status != StatusSold {
+		t.Fatalf("status = %s, want %s", order.Status, StatusSold)
+	}
+	if order.SoldQuantity.Cmp(decimal.New(20)) != 0 {
+		t.Errorf("sold quantity = %v, want the 20 sold", order.SoldQuantity)
+	}
+}
+
+func TestExitPositionKeepsAnUnfilledSell(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := boughtTestOrder(t, db, ex)
+
+	sellOrderType := string(exchange.OrderTypeImmediateOrCancel)
+	order.SellOrderType = &sellOrderType
+
+	tests := []struct {
+		name   string
+		filled string
+		status OrderStatus
+		sold   string
+		levels int
+	}{
+		{name: "expired", filled: "0", status: StatusBought, levels: 0},
+		{name: "partially filled", filled: "10", status: StatusBought, sold: "10", levels: 1},
+	}
+
+	for _, test := range tests {
+		ex.fill = func(request exchange.OrderRequest) decimal.Decimal {
+			return decimal.RequireFromString(test.filled)
+		}
+
+		err := exitPosition(context.Background(), db, ex, order, exitDecision{Reason: "take profit 1", LevelsDone: 1, Final: true})
+		if test.sold == "" && !errors.Is(err, ErrNotFilled) {
+			t.Errorf("%s: err = %v, want ErrNotFilled", test.name, err)
+		}
+		if test.sold != "" && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+
+		reloaded := reloadOrder(t, db, order)
+		if reloaded.Status != test.status || reloaded.TakeProfitsDone != test.levels {
+			t.Errorf("%s: order = %s with %d levels, want %s with %d", test.name, reloaded.Status, reloaded.TakeProfitsDone, test.status, test.levels)
+		}
+		if test.sold == "" && reloaded.SoldQuantity != nil {
+			t.Errorf("%s: sold quantity = %v, want nothing", test.name, reloaded.SoldQuantity)
+		}
+		if test.sold != "" && (reloaded.SoldQuantity == nil || reloaded.SoldQuantity.Cmp(decimal.RequireFromString(test.sold)) != 0) {
+			t.Errorf("%s: sold quantity = %v, want %s", test.name, reloaded.SoldQuantity, test.sold)
+		}
+	}
+}
+
+func TestCheckExitWatchesWhatAFinalSellLeft(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := boughtTestOrder(t, db, ex)
+
+	// stop loss at 10%, the price fell 50%
+	sellOrderType := string(exchange.OrderTypeImmediateOrCancel)
+	err := db.Model(&Order{}).Where("id = ?", order.ID).Updates(&Order{
+		SellOrderType: &sellOrderType,
+		ExitPlan:      &ExitPlan{StopLossPercent: 10},
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.price = decimal.New(1)
+
+	ex.fill = func(request exchange.OrderRequest) decimal.Decimal {
+		return decimal.New(10)
+	}
+	done, err := checkExit(context.Background(), db, ex, order.ID)
+	if err != nil || done {
+		t.Fatalf("done = %v %v after a partial stop loss, want the order still watched", done, err)
+	}
+
+	ex.fill = nil
+	done, err = checkExit(context.Background(), db, ex, order.ID)
+	if err != nil || !done {
+		t.Fatalf("done = %v %v after the rest was sold, want done", done, err)
+	}
+
+	if order = reloadOrder(t, db, order); order.Status != StatusSold || order.SoldQuantity.Cmp(*order.Quantity) != 0 {
+		t.Errorf("order = %s sold %v, want all of %v sold", order.Status, order.SoldQuantity, order.Quantity)
+	}
+}
@@ -0,0 +1,217 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPriceAboveMax = errors.New("price is above the max acceptable price")
+	ErrNoTradeYet    = errors.New("no trade on the symbol yet")
+	ErrNotFilled     = errors.New("order was not filled")
+	// ErrBuyNotCancelled is returned when the rest of a limit buy could not be taken off the book,
+	// another attempt could buy a second time while it is still there
+	ErrBuyNotCancelled = errors.New("buy could not be cancelled")
+)
+
+// openExchangeStatuses are the exchange order statuses of an order still on the book
+var openExchangeStatuses = map[string]bool{
+	"NEW":              true,
+	"PARTIALLY_FILLED": true,
+}
+
+func (order *Order) buyOrderType() exchange.OrderType {
+	if order.BuyOrderType != nil && *order.BuyOrderType != "" {
+		return exchange.OrderType(*order.BuyOrderType)
+	}
+	return exchange.OrderTypeMarket
+}
+
+func (order *Order) sellOrderType() exchange.OrderType {
+	if order.SellOrderType != nil && *order.SellOrderType != "" {
+		return exchange.OrderType(*order.SellOrderType)
+	}
+	return exchange.OrderTypeMarket
+}
+
+// maxBuyPrice returns the highest price the order accepts to buy at, 0 when it has no limit.
+// A percentage is applied over the first trade price seen on the symbol which is kept on the order.
+func maxBuyPrice(ctx context.Context, db *gorm.DB, ex exchange.Exchange, order *Order) (decimal.Decimal, error) {
+	maxPrice := decimal.Zero
+	if order.MaxPrice != nil {
+		maxPrice = *order.MaxPrice
+	}
+
+	if order.MaxPricePercent == nil {
+		return maxPrice, nil
+	}
+
+	if order.FirstTradePrice == nil {
+		price, err := firstTradePrice(ex, *order)
+		if err != nil {
+			return decimal.Zero, err
+		}
+
+		if price.Sign() <= 0 {
+			return decimal.Zero, ErrNoTradeYet
+		}
+
+		err = db.WithContext(ctx).Model(&Order{}).Where("id = ? AND first_trade_price IS NULL", order.ID).
+			Update("first_trade_price", price).Error
+		if err != nil {
+			return decimal.Zero, err
+		}
+		order.FirstTradePrice = &price
+	}
+
+	percentPrice := order.FirstTradePrice.Mul(decimal.NewFromFloat(1 + *order.MaxPricePercent/100))
+	if maxPrice.IsZero() || percentPrice.LessThan(maxPrice) {
+		maxPrice = percentPrice
+	}
+
+	return maxPrice, nil
+}
+
+// placeBuyOrder places the buy of the order with its order type, making sure the max price is respected.
+// Market buys are refused when the book is above the max price, limit buys are priced at the max price.
+func placeBuyOrder(ctx context.Context, db *gorm.DB, ex exchange.Exchange, order *Order, clientOrderID string) (exchange.OrderResponse, error) {
+	orderType := order.buyOrderType()
+
+	maxPrice, err := maxBuyPrice(ctx, db, ex, order)
+	if err != nil {
+		return exchange.OrderResponse{}, err
+	}
+
+	if orderType == exchange.OrderTypeMarket {
+		if maxPrice.Sign() > 0 {
+			_, askPrice, err := bestPrices(ex, *order)
+			if err != nil {
+				return exchange.OrderResponse{}, err
+			}
+
+			if askPrice.GreaterThan(maxPrice) {
+				return exchange.OrderResponse{}, fmt.Errorf("%w: %v over %v", ErrPriceAboveMax, askPrice, maxPrice)
+			}
+		}
+
+		return ex.PlaceMarketOrder(exchange.OrderRequest{
+			Symbol:        *order.Symbol,
+			Side:          exchange.OrderSideBuy,
+			Type:          exchange.OrderTypeMarket,
+			QuoteOrderQty: *order.Price,
+			ClientOrderID: clientOrderID,
+		})
+	}
+
+	if maxPrice.Sign() <= 0 {
+		return exchange.OrderResponse{}, fmt.Errorf("a %s buy needs a max price", orderType)
+	}
+
+	quantity := order.Price.Div(maxPrice)
+	response, err := ex.PlaceLimitOrder(exchange.OrderRequest{
+		Symbol:        *order.Symbol,
+		Side:          exchange.OrderSideBuy,
+		Type:          orderType,
+		Quantity:      quantity,
+		Price:         maxPrice,
+		ClientOrderID: clientOrderID,
+	})
+	if err != nil {
+		return response, err
+	}
+	if response.OrigQty.Sign() > 0 {
+		quantity = response.OrigQty
+	}
+
+	fills, err := reconcileFills(ex, *order.Symbol, response.OrderId)
+	if err != nil {
+		// nothing can stay on the book while the next attempts run, buy looks the order up once it is off
+		if orderType == exchange.OrderTypeLimit {
+			if cancelErr := cancelBuyRemainder(ex, *order.Symbol, response.OrderId); cancelErr != nil {
+				return response, cancelErr
+			}
+		}
+		return response, fmt.Errorf("%w: reconciling %s buy %s failed: %v", exchange.ErrOrderStateUnknown, orderType, response.OrderId, err)
+	}
+
+	// what a limit buy does not fill right away is cancelled, the next attempt goes again when nothing filled
+	if orderType == exchange.OrderTypeLimit && fills.Quantity.LessThan(quantity) {
+		err = cancelBuyRemainder(ex, *order.Symbol, response.OrderId)
+		if err != nil {
+			return response, err
+		}
+
+		// some more may have filled before the cancel
+		fills, err = reconcileFills(ex, *order.Symbol, response.OrderId)
+		if err != nil {
+			return response, fmt.Errorf("%w: reconciling %s buy %s failed: %v", exchange.ErrOrderStateUnknown, orderType, response.OrderId, err)
+		}
+	}
+
+	if fills.Quantity.IsZero() {
+		return response, fmt.Errorf("%w: %s buy at %v", ErrNotFilled, orderType, maxPrice)
+	}
+
+	return response, nil
+}
+
+// cancelBuyRemainder takes what is left of a buy off the book, a buy that filled or got cancelled meanwhile is fine
+func cancelBuyRemainder(ex exchange.Exchange, symbol string, orderID string) error {
+	err := cancelRemainder(ex, symbol, orderID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBuyNotCancelled, err)
+	}
+	return nil
+}
+
+// cancelRemainder takes what is left of an order off the book, an order that filled or got cancelled meanwhile is fine
+func cancelRemainder(ex exchange.Exchange, symbol string, orderID string) error {
+	_, err := ex.CancelOrder(symbol, orderID)
+	if err == nil {
+		return nil
+	}
+
+	placedOrder, lookupErr := ex.GetOrder(symbol, orderID)
+	if lookupErr == nil && !openExchangeStatuses[placedOrder.Status] {
+		return nil
+	}
+
+	return fmt.Errorf("cancelling order %s failed: %v", orderID, err)
+}
+
+// placeSellOrder places the sell of the order with its order type, limit sells are priced at the best bid
+func placeSellOrder(ex exchange.Exchange, order Order, quantity decimal.Decimal, clientOrderID string) (exchange.OrderResponse, error) {
+	orderType := order.sellOrderType()
+
+	if orderType == exchange.OrderTypeMarket {
+		return ex.PlaceMarketOrder(exchange.OrderRequest{
+			Symbol:        *order.Symbol,
+			Side:          exchange.OrderSideSell,
+			Type:          exchange.OrderTypeMarket,
+			Quantity:      quantity,
+			ClientOrderID: clientOrderID,
+		})
+	}
+
+	bidPrice, _, err := bestPrices(ex, order)
+	if err != nil {
+		return exchange.OrderResponse{}, err
+	}
+
+	if bidPrice.Sign() <= 0 {
+		return exchange.OrderResponse{}, fmt.Errorf("no bid to %s sell %s at", orderType, *order.Symbol)
+	}
+
+	return ex.PlaceLimitOrder(exchange.OrderRequest{
+		Symbol:        *order.Symbol,
+		Side:          exchange.OrderSideSell,
+		Type:          orderType,
+		Quantity:      quantity,
+		Price:         bidPrice,
+		ClientOrderID: clientOrderID,
+	})
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// limitBuyOrder is an armed order buying 50 USDT with the order type at 2.5 at most, 20 FOO
+func limitBuyOrder(t *testing.T, orderType exchange.OrderType) Order {
+	db := newTestDB(t)
+	order := createTestOrder(t, db, StatusArmed)
+
+	buyOrderType := string(orderType)
+	maxPrice := decimal.RequireFromString("2.5")
+	order.BuyOrderType = &buyOrderType
+	order.MaxPrice = &maxPrice
+	return order
+}
+
+func TestPlaceBuyOrderCancelsWhatDidNotFill(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderType exchange.OrderType
+		filled    string
+		cancelled bool
+		err       error
+	}{
+		{name: "limit filled", orderType: exchange.OrderTypeLimit, filled: "20"},
+		{name: "limit partially filled", orderType: exchange.OrderTypeLimit, filled: "8", cancelled: true},
+		{name: "limit not filled", orderType: exchange.OrderTypeLimit, filled: "0", cancelled: true, err: ErrNotFilled},
+		{name: "immediate or cancel partially filled", orderType: exchange.OrderTypeImmediateOrCancel, filled: "8"},
+		{name: "immediate or cancel not filled", orderType: exchange.OrderTypeImmediateOrCancel, filled: "0", err: ErrNotFilled},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order := limitBuyOrder(t, test.orderType)
+			ex := newFakeExchange("2")
+			ex.fill = func(request exchange.OrderRequest) decimal.Decimal {
+				return decimal.RequireFromString(test.filled)
+			}
+
+			response, err := placeBuyOrder(context.Background(), nil, ex, &order, "nlbtest")
+			if !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+
+			request := ex.requests[0]
+			if request.Quantity.Cmp(decimal.New(20)) != 0 || request.Price.Cmp(decimal.RequireFromString("2.5")) != 0 {
+				t.Errorf("placed %v at %v, want 20 at 2.5", request.Quantity, request.Price)
+			}
+			if response.OrderId != "fake-1" {
+				t.Errorf("response = %s, want fake-1", response.OrderId)
+			}
+			if cancelled := len(ex.cancelled) == 1; cancelled != test.cancelled {
+				t.Errorf("cancelled = %v, want %v", ex.cancelled, test.cancelled)
+			}
+		})
+	}
+}
+
+func TestPlaceBuyOrderStopsWhenTheCancelFails(t *testing.T) {
+	order := limitBuyOrder(t, exchange.OrderTypeLimit)
+	ex := newFakeExchange("2")
+	ex.fill = func(request exchange.OrderRequest) decimal.Decimal {
+		return decimal.RequireFromString("8")
+	}
+	ex.cancelErr = errors.New("too many requests")
+
+	_, err := placeBuyOrder(context.Background(), nil, ex, &order, "nlbtest")
+	if !errors.Is(err, ErrBuyNotCancelled) {
+		t.Fatalf("err = %v, want ErrBuyNotCancelled", err)
+	}
+
+	// the next attempts would buy along with what is still on the book
+	if isRetryableBuyError(err) {
+		t.Error("a buy left on the book must stop the burst")
+	}
+}
+
+func TestBuyAttemptsSendTheirOwnClientOrderID(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	ex.fill = func(request exchange.OrderRequest) decimal.Decimal {
+		return decimal.Zero
+	}
+
+	order := createTestOrder(t, db, StatusArmed)
+	buyOrderType := string(exchange.OrderTypeLimit)
+	maxPrice := decimal.RequireFromString("2.5")
+	order.BuyOrderType = &buyOrderType
+	order.MaxPrice = &maxPrice
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := buy(context.Background(), db, ex, order)
+		if !errors.Is(err, ErrNotFilled) {
+			t.Fatalf("attempt %d: err = %v, want ErrNotFilled", attempt, err)
+		}
+	}
+
+	first, second := ex.requests[0].ClientOrderID, ex.requests[1].ClientOrderID
+	if first == second {
+		t.Errorf("both attempts sent %s", first)
+	}
+
+	prefix := "nlb" + strings.ReplaceAll(order.ID.String(), "-", "")[:21]
+	for _, clientOrderID := range []string{first, second} {
+		if len(clientOrderID) != 32 || !strings.HasPrefix(clientOrderID, prefix) {
+			t.Errorf("client order id %s is not a 32 characters id of the order", clientOrderID)
+		}
+	}
+
+	// the last attempt is the one a restart looks up
+	if reloaded := reloadOrder(t, db, order); reloaded.Status != StatusArmed || *reloaded.ClientOrderID != second {
+		t.Errorf("order = %s %v, want armed with %s", reloaded.Status, reloaded.ClientOrderID, second)
+	}
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	StatusDraft     OrderStatus = "draft"
+	StatusPending   OrderStatus = "pending"
+	StatusArmed     OrderStatus = "armed"
+	StatusBuying    OrderStatus = "buying"
+	StatusBought    OrderStatus = "bought"
+	StatusSelling   OrderStatus = "selling"
+	StatusSold      OrderStatus = "sold"
+	StatusFailed    OrderStatus = "failed"
+	StatusCancelled OrderStatus = "cancelled"
+	StatusExpired   OrderStatus = "expired"
+)
+
+// orderTransitions lists the statuses an order can move to from each status
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	StatusDraft:   {StatusPending, StatusCancelled},
+	StatusPending: {StatusArmed, StatusCancelled, StatusExpired, StatusFailed},
+	StatusArmed:   {StatusBuying, StatusCancelled, StatusExpired, StatusFailed},
+	StatusBuying:  {StatusBought, StatusArmed, StatusFailed},
+	StatusBought:  {StatusSelling, StatusCancelled},
+	StatusSelling: {StatusSold, StatusBought, StatusFailed},
+}
+
+var (
+	ErrInvalidTransition   = errors.New("invalid order status transition")
+	ErrOrderStatusConflict = errors.New("order status changed concurrently")
+)
+
+// OrderEvent records a single status transition of an order
+type OrderEvent struct {
+	BaseModel
+	OrderID          uuid.UUID   `json:"order_id" gorm:"type:uuid;index"`
+	FromStatus       OrderStatus `json:"from_status"`
+	ToStatus         OrderStatus `json:"to_status"`
+	Reason           string      `json:"reason"`
+	ExchangeResponse *string     `json:"exchange_response"`
+}
+
+// CanTransition reports whether an order can move from one status to the other
+func CanTransition(from, to OrderStatus) bool {
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal reports whether no transition can leave the status
+func (s OrderStatus) IsFinal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+// TransitionOrder moves the order from one status to the other and records the event.
+// The update only applies while the order is still in the from status, so concurrent callers
+// racing for the same transition get ErrOrderStatusConflict except for the first one.
+// updates holds the other columns to change along with the status.
+func TransitionOrder(ctx context.Context, db *gorm.DB, orderID uuid.UUID, from, to OrderStatus, reason string, response interface{}, updates map[string]interface{}) error {
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	event := OrderEvent{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+	}
+	now := time.Now()
+	event.Timestamp = &now
+
+	if response != nil {
+		encoded, err := json.Marshal(response)
+		if err == nil {
+			exchangeResponse := string(encoded)
+			event.ExchangeResponse = &exchangeResponse
+		}
+	}
+
+	columns := map[string]interface{}{}
+	for column, value := range updates {
+		columns[column] = value
+	}
+	columns["status"] = to
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Order{}).Where("id = ? AND status = ?", orderID, from).Updates(columns)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: order %s is no longer %s", ErrOrderStatusConflict, orderID, from)
+		}
+
+		return tx.Model(&OrderEvent{}).Create(&event).Error
+	})
+}
+
+// Transition moves the order from its current status and keeps the struct in sync
+func (order *Order) Transition(ctx context.Context, db *gorm.DB, to OrderStatus, reason string, response interface{}, updates map[string]interface{}) error {
+	err := TransitionOrder(ctx, db, order.ID, order.Status, to, reason, response, updates)
+	if err != nil {
+		return err
+	}
+
+	order.Status = to
+	return nil
+}
+
+// GetOrderEvents returns the transitions of the order, oldest first
+func GetOrderEvents(ctx context.Context, db *gorm.DB, orderID uuid.UUID) ([]OrderEvent, error) {
+	var events []OrderEvent
+
+	err := db.WithContext(ctx).Model(&OrderEvent{}).Where("order_id = ?", orderID).
+		Order("timestamp asc").Find(&events).Error
+
+	return events, err
+}
@@ -0,0 +1,318 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"NewListingBot/logger"
+	"context"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+)
+
+// OrderFill is a single execution of the buy or of a sell of an order
+type OrderFill struct {
+	BaseModel
+	OrderID         uuid.UUID          `json:"order_id" gorm:"type:uuid;index"`
+	Side            exchange.OrderSide `json:"side"`
+	ExchangeOrderID string             `json:"exchange_order_id"`
+	TradeID         string             `json:"trade_id" gorm:"uniqueIndex"`
+	Price           decimal.Decimal    `json:"price"`
+	Quantity        decimal.Decimal    `json:"quantity"`
+	QuoteQty        decimal.Decimal    `json:"quote_qty"`
+	Commission      decimal.Decimal    `json:"commission"`
+	CommissionAsset string             `json:"commission_asset"`
+	// the commission valued in the quote asset of the symbol
+	CommissionQuote decimal.Decimal `json:"commission_quote"`
+	BaseCommission  bool            `json:"base_commission"`
+	Time            time.Time       `json:"time"`
+}
+
+// commissionInQuote values a commission in the quote asset, from the trade price when it is taken in the base asset
+// and from the ticker of the asset when it is a third one like MX
+func commissionInQuote(ex exchange.Exchange, symbolInfo exchange.SymbolInfo, tradePrice decimal.Decimal, commission decimal.Decimal, asset string) decimal.Decimal {
+	switch {
+	case commission.IsZero() || asset == "" || asset == symbolInfo.QuoteAsset:
+		return commission
+	case asset == symbolInfo.BaseAsset:
+		return commission.Mul(tradePrice)
+	}
+
+	ticker, err := ex.GetTicker(asset + symbolInfo.QuoteAsset)
+	if err != nil {
+		logger.Error(context.Background(), "error valuing commission", zap.String("asset", asset), zap.Error(err))
+		return decimal.Zero
+	}
+	return commission.Mul(ticker.LastPrice)
+}
+
+// recordFills saves the executions of an exchange order of the order and updates its accounting.
+// When the trades are not visible yet the executed amounts of the order are saved as a single fill without fees,
+// it is replaced by the trades once they show up.
+func recordFills(ctx context.Context, db *gorm.DB, ex exchange.Exchange, order Order, side exchange.OrderSide, exchangeOrderID string) error {
+	symbolInfo, err := ex.GetSymbolInfo(*order.Symbol)
+	if err != nil {
+		return err
+	}
+
+	orderFillID := "order:" + exchangeOrderID
+
+	trades, err := ex.GetMyTrades(*order.Symbol, exchangeOrderID)
+	if err == nil && len(trades) > 0 {
+		var fills []OrderFill
+		for _, trade := range trades {
+			fills = append(fills, OrderFill{
+				OrderID:         order.ID,
+				Side:            side,
+				ExchangeOrderID: exchangeOrderID,
+				TradeID:         trade.Id,
+				Price:           trade.Price,
+				Quantity:        trade.Qty,
+				QuoteQty:        trade.QuoteQty,
+				Commission:      trade.Commission,
+				CommissionAsset: trade.CommissionAsset,
+				CommissionQuote: commissionInQuote(ex, symbolInfo, trade.Price, trade.Commission, trade.CommissionAsset),
+				BaseCommission:  trade.CommissionAsset == symbolInfo.BaseAsset,
+				Time:            time.UnixMilli(trade.Time),
+			})
+		}
+
+		err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// the trades stand for the executions the order fill was saved for
+			err := tx.Where("trade_id = ?", orderFillID).Delete(&OrderFill{}).Error
+			if err != nil {
+				return err
+			}
+
+			// the same trades come back on every lookup
+			return tx.Model(&OrderFill{}).Clauses(clause.OnConflict{DoNothing: true}).Create(&fills).Error
+		})
+		if err != nil {
+			return err
+		}
+
+		return updateOrderPnL(ctx, db, order.ID)
+	}
+
+	var tradeFills int64
+	err = db.WithContext(ctx).Model(&OrderFill{}).
+		Where("exchange_order_id = ? AND order_id = ? AND trade_id <> ?", exchangeOrderID, order.ID, orderFillID).
+		Count(&tradeFills).Error
+	if err != nil || tradeFills > 0 {
+		// the trades were already saved
+		return err
+	}
+
+	placedOrder, err := ex.GetOrder(*order.Symbol, exchangeOrderID)
+	if err != nil {
+		return err
+	}
+
+	quantity := placedOrder.ExecutedQty
+	if quantity.IsZero() {
+		return nil
+	}
+
+	quoteQty := placedOrder.CummulativeQuoteQty
+	fill := OrderFill{
+		OrderID:         order.ID,
+		Side:            side,
+		ExchangeOrderID: exchangeOrderID,
+		TradeID:         orderFillID,
+		Price:           quoteQty.Div(quantity),
+		Quantity:        quantity,
+		QuoteQty:        quoteQty,
+		Time:            time.Now(),
+	}
+
+	// the order may have executed some more since the last lookup
+	err = db.WithContext(ctx).Model(&OrderFill{}).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "trade_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price", "quantity", "quote_qty"}),
+	}).Create(&fill).Error
+	if err != nil {
+		return err
+	}
+
+	return updateOrderPnL(ctx, db, order.ID)
+}
+
+// orderAccounting is what the fills of an order add up to
+type orderAccounting struct {
+	EntryPrice decimal.Decimal
+	ExitPrice  decimal.Decimal
+	Fees       decimal.Decimal
+	// cost of the quantity sold
+	CostBasis decimal.Decimal
+	Profit    decimal.Decimal
+	ROI       float64
+	Sold      bool
+}
+
+// accountFills computes the cost basis and the realized PnL of the fills.
+// The buy commissions taken in the base asset are already paid through the smaller quantity held,
+// the other ones are added to the cost basis, the sell commissions are taken from the proceeds.
+func accountFills(fills []OrderFill) orderAccounting {
+	var buyQty, buyQuote, buyFees, heldQty, extraCost, sellQty, sellQuote, sellFees decimal.Decimal
+
+	for _, fill := range fills {
+		if fill.Side == exchange.OrderSideBuy {
+			buyQty = buyQty.Add(fill.Quantity)
+			buyQuote = buyQuote.Add(fill.QuoteQty)
+			buyFees = buyFees.Add(fill.CommissionQuote)
+			heldQty = heldQty.Add(fill.Quantity)
+			if fill.BaseCommission {
+				heldQty = heldQty.Sub(fill.Commission)
+			} else {
+				extraCost = extraCost.Add(fill.CommissionQuote)
+			}
+			continue
+		}
+
+		sellQty = sellQty.Add(fill.Quantity)
+		sellQuote = sellQuote.Add(fill.QuoteQty)
+		sellFees = sellFees.Add(fill.CommissionQuote)
+	}
+
+	accounting := orderAccounting{
+		Fees: buyFees.Add(sellFees),
+	}
+	if buyQty.Sign() > 0 {
+		accounting.EntryPrice = buyQuote.Div(buyQty)
+	}
+	if sellQty.IsZero() || heldQty.Sign() <= 0 {
+		return accounting
+	}
+
+	accounting.Sold = true
+	accounting.ExitPrice = sellQuote.Div(sellQty)
+
+	soldShare := decimal.Min(sellQty.Div(heldQty), decimal.New(1))
+
+	accounting.CostBasis = buyQuote.Add(extraCost).Mul(soldShare)
+	accounting.Profit = sellQuote.Sub(sellFees).Sub(accounting.CostBasis)
+	if accounting.CostBasis.Sign() > 0 {
+		accounting.ROI = accounting.Profit.Div(accounting.CostBasis).Float64() * 100
+	}
+
+	return accounting
+}
+
+// updateOrderPnL recomputes the accounting of the order from all its fills
+func updateOrderPnL(ctx context.Context, db *gorm.DB, orderID uuid.UUID) error {
+	var fills []OrderFill
+
+	err := db.WithContext(ctx).Model(&OrderFill{}).Where("order_id = ?", orderID).Find(&fills).Error
+	if err != nil {
+		return err
+	}
+
+	accounting := accountFills(fills)
+	updates := map[string]interface{}{
+		"entry_price": accounting.EntryPrice,
+		"fees":        accounting.Fees,
+	}
+	if accounting.Sold {
+		updates["sold_price"] = accounting.ExitPrice
+		updates["cost_basis"] = accounting.CostBasis
+		updates["profit"] = accounting.Profit
+		updates["roi"] = accounting.ROI
+	}
+
+	return db.WithContext(ctx).Model(&Order{}).Where("id = ?", orderID).Updates(updates).Error
+}
+
+// PnLBucket is the realized PnL of a group of orders
+type PnLBucket struct {
+	Key    string          `json:"key"`
+	Orders int             `json:"orders"`
+	Cost   decimal.Decimal `json:"cost"`
+	Fees   decimal.Decimal `json:"fees"`
+	Profit decimal.Decimal `json:"profit"`
+	ROI    float64         `json:"roi"`
+}
+
+type PnLSummary struct {
+	Total    PnLBucket   `json:"total"`
+	ByDay    []PnLBucket `json:"by_day"`
+	BySymbol []PnLBucket `json:"by_symbol"`
+	ByVenue  []PnLBucket `json:"by_venue"`
+}
+
+// GetPnLSummary adds up the realized PnL of the real or of the paper orders, the day is the one of the last sell
+func GetPnLSummary(ctx context.Context, db *gorm.DB, paper bool) (PnLSummary, error) {
+	var orders []Order
+
+	err := db.WithContext(ctx).Model(&Order{}).Where("profit IS NOT NULL AND paper = ?", paper).Find(&orders).Error
+	if err != nil {
+		return PnLSummary{}, err
+	}
+
+	summary := PnLSummary{Total: PnLBucket{Key: "total"}}
+	byDay := map[string]*PnLBucket{}
+	bySymbol := map[string]*PnLBucket{}
+	byVenue := map[string]*PnLBucket{}
+
+	add := func(buckets map[string]*PnLBucket, key string, order Order) {
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = &PnLBucket{Key: key}
+			buckets[key] = bucket
+		}
+		bucket.add(order)
+	}
+
+	for _, order := range orders {
+		day := "open"
+		if order.SoldTime != nil {
+			day = order.SoldTime.UTC().Format("2006-01-02")
+		}
+
+		venue := exchange.VenueMEXC
+		if order.Venue != nil {
+			venue = *order.Venue
+		}
+
+		summary.Total.add(order)
+		add(byDay, day, order)
+		add(bySymbol, *order.Symbol, order)
+		add(byVenue, venue, order)
+	}
+
+	summary.ByDay = sortedBuckets(byDay)
+	summary.BySymbol = sortedBuckets(bySymbol)
+	summary.ByVenue = sortedBuckets(byVenue)
+
+	return summary, nil
+}
+
+func (bucket *PnLBucket) add(order Order) {
+	bucket.Orders++
+	bucket.Profit = bucket.Profit.Add(*order.Profit)
+	if order.Fees != nil {
+		bucket.Fees = bucket.Fees.Add(*order.Fees)
+	}
+
+	if order.CostBasis != nil {
+		bucket.Cost = bucket.Cost.Add(*order.CostBasis)
+	}
+
+	if bucket.Cost.Sign() > 0 {
+		bucket.ROI = bucket.Profit.Div(bucket.Cost).Float64() * 100
+	}
+}
+
+func sortedBuckets(buckets map[string]*PnLBucket) []PnLBucket {
+	sorted := make([]PnLBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		sorted = append(sorted, *bucket)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
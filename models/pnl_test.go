@@ -0,0 +1,205 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"context"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func orderFills(t *testing.T, db *gorm.DB, order Order) []OrderFill {
+	t.Helper()
+
+	var fills []OrderFill
+	if err := db.Model(&OrderFill{}).Where("order_id = ?", order.ID).Order("trade_id asc").Find(&fills).Error; err != nil {
+		t.Fatal(err)
+	}
+	return fills
+}
+
+func TestRecordFillsReplacesTheOrderFillByTheTrades(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := createTestOrder(t, db, StatusBought)
+
+	ex.hideTrades = true
+	ex.fill = func(request exchange.OrderRequest) decimal.Decimal {
+		return decimal.New(10)
+	}
+	response, err := ex.PlaceLimitOrder(exchange.OrderRequest{
+		Symbol: "FOOUSDT", Side: exchange.OrderSideBuy, Type: exchange.OrderTypeLimit, Quantity: decimal.New(25), Price: decimal.New(2),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recordFills(context.Background(), db, ex, order, exchange.OrderSideBuy, response.OrderId); err != nil {
+		t.Fatal(err)
+	}
+	fills := orderFills(t, db, order)
+	if len(fills) != 1 || fills[0].TradeID != "order:fake-1" || fills[0].Quantity.Cmp(decimal.New(10)) != 0 {
+		t.Fatalf("fills = %+v, want the order fill of 10", fills)
+	}
+
+	// the order executed some more before its trades showed up
+	executed := ex.orders["fake-1"]
+	executed.ExecutedQty, executed.CummulativeQuoteQty = decimal.New(25), decimal.New(50)
+	ex.orders["fake-1"] = executed
+
+	if err := recordFills(context.Background(), db, ex, order, exchange.OrderSideBuy, response.OrderId); err != nil {
+		t.Fatal(err)
+	}
+	fills = orderFills(t, db, order)
+	if len(fills) != 1 || fills[0].Quantity.Cmp(decimal.New(25)) != 0 {
+		t.Fatalf("fills = %+v, want the order fill updated to 25", fills)
+	}
+
+	ex.hideTrades = false
+	ex.trades["fake-1"] = append(ex.trades["fake-1"], exchange.Trade{
+		Symbol: "FOOUSDT", Id: "fake-1-2", OrderId: "fake-1", Price: decimal.New(2), Qty: decimal.New(15), QuoteQty: decimal.New(30),
+		Commission: decimal.RequireFromString("0.015"), CommissionAsset: "FOO", IsBuyer: true,
+	})
+
+	// the trades replace the order fill and are not counted twice on the next lookups
+	for i := 0; i < 2; i++ {
+		if err := recordFills(context.Background(), db, ex, order, exchange.OrderSideBuy, response.OrderId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fills = orderFills(t, db, order)
+	if len(fills) != 2 || fills[0].TradeID != "fake-1-1" || fills[1].TradeID != "fake-1-2" {
+		t.Fatalf("fills = %+v, want the two trades", fills)
+	}
+
+	// once saved the trades are not replaced by an order fill when they can't be read
+	ex.hideTrades = true
+	if err := recordFills(context.Background(), db, ex, order, exchange.OrderSideBuy, response.OrderId); err != nil {
+		t.Fatal(err)
+	}
+	if fills = orderFills(t, db, order); len(fills) != 2 {
+		t.Fatalf("fills = %+v, want the two trades only", fills)
+	}
+
+	order = reloadOrder(t, db, order)
+	if order.EntryPrice == nil || order.EntryPrice.Cmp(decimal.New(2)) != 0 {
+		t.Errorf("entry price = %v, want 2", order.EntryPrice)
+	}
+	if want := decimal.RequireFromString("0.05"); order.Fees == nil || order.Fees.Cmp(want) != 0 {
+		t.Errorf("fees = %v, want %v", order.Fees, want)
+	}
+}
+
+func TestAccountFills(t *testing.T) {
+	buy := func(quantity, quote, commission string, base bool) OrderFill {
+		commissionQuote := decimal.RequireFromString(commission)
+		if base {
+			commissionQuote = commissionQuote.Mul(decimal.RequireFromString(quote).Div(decimal.RequireFromString(quantity)))
+		}
+		return OrderFill{
+			Side: exchange.OrderSideBuy, Quantity: decimal.RequireFromString(quantity), QuoteQty: decimal.RequireFromString(quote),
+			Commission: decimal.RequireFromString(commission), CommissionQuote: commissionQuote, BaseCommission: base,
+		}
+	}
+	sell := func(quantity, quote, commission string) OrderFill {
+		return OrderFill{
+			Side: exchange.OrderSideSell, Quantity: decimal.RequireFromString(quantity), QuoteQty: decimal.RequireFromString(quote),
+			CommissionQuote: decimal.RequireFromString(commission),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		fills  []OrderFill
+		sold   bool
+		entry  string
+		cost   string
+		profit string
+	}{
+		{
+			name:  "bought only",
+			fills: []OrderFill{buy("25", "50", "0", false)},
+			entry: "2",
+		},
+		{
+			name:   "sold everything with quote fees",
+			fills:  []OrderFill{buy("25", "50", "0.05", false), sell("25", "75", "0.075")},
+			sold:   true,
+			entry:  "2",
+			cost:   "50.05",
+			profit: "24.875",
+		},
+		{
+			name:   "sold half with base fees",
+			fills:  []OrderFill{buy("25", "50", "0.025", true), sell("12.4875", "37.4625", "0")},
+			sold:   true,
+			entry:  "2",
+			cost:   "25",
+			profit: "12.4625",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accounting := accountFills(test.fills)
+			if accounting.Sold != test.sold {
+				t.Fatalf("sold = %v, want %v", accounting.Sold, test.sold)
+			}
+			if accounting.EntryPrice.Cmp(decimal.RequireFromString(test.entry)) != 0 {
+				t.Errorf("entry price = %v, want %s", accounting.EntryPrice, test.entry)
+			}
+			if !test.sold {
+				return
+			}
+			if accounting.CostBasis.Cmp(decimal.RequireFromString(test.cost)) != 0 {
+				t.Errorf("cost basis = %v, want %s", accounting.CostBasis, test.cost)
+			}
+			if accounting.Profit.Cmp(decimal.RequireFromString(test.profit)) != 0 {
+				t.Errorf("profit = %v, want %s", accounting.Profit, test.profit)
+			}
+		})
+	}
+}
+
+func TestApplyBuyUpdateRecordsTheLateFills(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	useFakeExchange(t, ex)
+
+	order := createTestOrder(t, db, StatusArmed)
+	ex.hideTrades = true
+	if err := buy(context.Background(), db, ex, order); err != nil {
+		t.Fatal(err)
+	}
+	order = reloadOrder(t, db, order)
+
+	// the placement was answered before the trades, the user stream tells once they are in
+	ex.hideTrades = false
+	err := applyBuyUpdate(context.Background(), db, exchange.OrderUpdate{
+		Symbol:         "FOOUSDT",
+		OrderID:        "fake-1",
+		ClientOrderID:  *order.ClientOrderID,
+		Side:           exchange.OrderSideBuy,
+		Status:         "FILLED",
+		ExecutedQty:    decimal.New(25),
+		ExecutedAmount: decimal.New(50),
+		Time:           time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fills := orderFills(t, db, order)
+	if len(fills) != 1 || fills[0].TradeID != "fake-1-1" {
+		t.Fatalf("fills = %+v, want the trade", fills)
+	}
+
+	order = reloadOrder(t, db, order)
+	if want := decimal.RequireFromString("24.975"); order.Quantity.Cmp(want) != 0 {
+		t.Errorf("quantity = %v, want %v", order.Quantity, want)
+	}
+	if want := decimal.RequireFromString("0.05"); order.Fees == nil || order.Fees.Cmp(want) != 0 {
+		t.Errorf("fees = %v, want %v", order.Fees, want)
+	}
+}
@@ -0,0 +1,316 @@
+package models
+
+import (
+	"NewListingBot/config"
+	"NewListingBot/exchange"
+	"NewListingBot/logger"
+	"NewListingBot/scheduler"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+var errPositionMonitorStopped = errors.New("position monitor is not running")
+
+// trackedPosition is a bought order watched by the monitor, cancel stops its checks
+type trackedPosition struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	ex     exchange.Exchange
+	symbol string
+	queued bool
+}
+
+// PositionMonitor checks the exit plans of the tracked orders with a pool of workers,
+// on every interval and on every deal of their symbol on the stream.
+// The checks are throttled so the REST fallbacks stay under the rate limits.
+type PositionMonitor struct {
+	db       *gorm.DB
+	ctx      context.Context
+	interval time.Duration
+	workers  int
+	limiter  *time.Ticker
+	checks   chan uuid.UUID
+
+	mu        sync.Mutex
+	positions map[uuid.UUID]*trackedPosition
+}
+
+var positionMonitor *PositionMonitor
+
+func NewPositionMonitor(ctx context.Context, db *gorm.DB, cfg config.Config) *PositionMonitor {
+	workers := cfg.PositionMonitorWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	interval := time.Duration(cfg.PositionMonitorIntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	requestsPerSecond := cfg.PositionMonitorRequestsPerSecond
+	if requestsPerSecond < 1 {
+		requestsPerSecond = 1
+	}
+
+	return &PositionMonitor{
+		db:        db,
+		ctx:       ctx,
+		interval:  interval,
+		workers:   workers,
+		limiter:   time.NewTicker(time.Second / time.Duration(requestsPerSecond)),
+		checks:    make(chan uuid.UUID, 256),
+		positions: map[uuid.UUID]*trackedPosition{},
+	}
+}
+
+// StartPositionMonitor starts the shared monitor and tracks the bought orders whose exits already started,
+// the sells cut by a restart are settled first and the paper ones closed. Everything stops with the context.
+func StartPositionMonitor(ctx context.Context, db *gorm.DB, cfg config.Config) *PositionMonitor {
+	positionMonitor = NewPositionMonitor(ctx, db, cfg)
+	positionMonitor.Start()
+
+	var orders []Order
+	err := db.WithContext(ctx).Model(&Order{}).
+		Where("status IN ? AND (schedule_sell_time IS NULL OR schedule_sell_time <= ?)", []OrderStatus{StatusBought, StatusSelling}, time.Now()).
+		Find(&orders).Error
+	if err != nil {
+		logger.Error(ctx, "error fetching bought orders", zap.Error(err))
+	}
+
+	for _, order := range orders {
+		closed, err := closeLostPaperOrder(ctx, db, &order)
+		if err != nil {
+			logger.Error(ctx, "error closing lost paper order", zap.String("order_id", order.ID.String()), zap.Error(err))
+		}
+		if closed || err != nil {
+			continue
+		}
+
+		if order.Status == StatusSelling {
+			// the sell was cut by the restart, it is settled from the exchange before the exit plan goes on
+			err = reconcileSellingOrder(ctx, db, &order)
+			if err != nil {
+				logger.Error(ctx, "error reconciling selling order", zap.String("order_id", order.ID.String()), zap.Error(err))
+			}
+			if order.Status == StatusSold {
+				continue
+			}
+		}
+
+		if err := positionMonitor.Track(order); err != nil {
+			logger.Error(ctx, "error tracking order", zap.String("order_id", order.ID.String()), zap.Error(err))
+		}
+	}
+
+	return positionMonitor
+}
+
+// Start runs the workers, the interval ticks and the stream ticks
+func (m *PositionMonitor) Start() {
+	for i := 0; i < m.workers; i++ {
+		go m.work()
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		defer m.limiter.Stop()
+
+		for {
+			select {
+			case <-m.ctx.Done():
+				m.mu.Lock()
+				for orderID, tracked := range m.positions {
+					tracked.cancel()
+					delete(m.positions, orderID)
+				}
+				m.mu.Unlock()
+				return
+			case <-ticker.C:
+				m.queueAll()
+			}
+		}
+	}()
+
+	if stream := exchange.MEXCMarketStream(); stream != nil {
+		stream.Cache().OnDeal(func(deal exchange.Deal) {
+			m.queueSymbol(deal.Symbol)
+		})
+	}
+}
+
+// Track starts checking the exit plan of the order until it is sold or untracked
+func (m *PositionMonitor) Track(order Order) error {
+	if m.ctx.Err() != nil {
+		return errPositionMonitorStopped
+	}
+
+	ex, err := exchangeForOrder(order)
+	if err != nil {
+		return err
+	}
+
+	// the stream gives the prices and ticks the checks
+	watchSymbol(order)
+
+	ctx, cancel := context.WithCancel(m.ctx)
+
+	m.mu.Lock()
+	if _, ok := m.positions[order.ID]; ok {
+		m.mu.Unlock()
+		cancel()
+		return nil
+	}
+	m.positions[order.ID] = &trackedPosition{ctx: ctx, cancel: cancel, ex: ex, symbol: *order.Symbol}
+	m.mu.Unlock()
+
+	m.queue(order.ID)
+	return nil
+}
+
+// Untrack stops checking the order, a check in flight is cancelled through its context
+func (m *PositionMonitor) Untrack(orderID uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tracked, ok := m.positions[orderID]; ok {
+		tracked.cancel()
+		delete(m.positions, orderID)
+	}
+}
+
+// Tracked returns the number of orders being watched
+func (m *PositionMonitor) Tracked() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.positions)
+}
+
+// queue asks for a check of the order unless one is already waiting
+func (m *PositionMonitor) queue(orderID uuid.UUID) {
+	m.mu.Lock()
+	tracked, ok := m.positions[orderID]
+	if !ok || tracked.queued {
+		m.mu.Unlock()
+		return
+	}
+	tracked.queued = true
+	m.mu.Unlock()
+
+	select {
+	case m.checks <- orderID:
+	default:
+		// the workers are behind, the next tick asks again
+		m.mu.Lock()
+		tracked.queued = false
+		m.mu.Unlock()
+	}
+}
+
+func (m *PositionMonitor) queueAll() {
+	m.mu.Lock()
+	orderIDs := make([]uuid.UUID, 0, len(m.positions))
+	for orderID := range m.positions {
+		orderIDs = append(orderIDs, orderID)
+	}
+	m.mu.Unlock()
+
+	for _, orderID := range orderIDs {
+		m.queue(orderID)
+	}
+}
+
+func (m *PositionMonitor) queueSymbol(symbol string) {
+	m.mu.Lock()
+	var orderIDs []uuid.UUID
+	for orderID, tracked := range m.positions {
+		if tracked.symbol == symbol {
+			orderIDs = append(orderIDs, orderID)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, orderID := range orderIDs {
+		m.queue(orderID)
+	}
+}
+
+func (m *PositionMonitor) work() {
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case orderID := <-m.checks:
+			m.check(orderID)
+		}
+	}
+}
+
+func (m *PositionMonitor) check(orderID uuid.UUID) {
+	m.mu.Lock()
+	tracked, ok := m.positions[orderID]
+	if ok {
+		tracked.queued = false
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	select {
+	case <-tracked.ctx.Done():
+		return
+	case <-m.limiter.C:
+	}
+
+	done, err := checkExit(tracked.ctx, m.db, tracked.ex, orderID)
+	if err != nil {
+		if tracked.ctx.Err() == nil {
+			logger.Error(tracked.ctx, "error checking exit", zap.String("order_id", orderID.String()), zap.Error(err))
+		}
+		return
+	}
+
+	if done {
+		m.Untrack(orderID)
+	}
+}
+
+// CancelOrder stops everything scheduled for the order and moves it to cancelled.
+// A bought order stops being managed, what was bought stays on the exchange.
+func CancelOrder(ctx context.Context, db *gorm.DB, orderID uuid.UUID) (Order, error) {
+	var order Order
+
+	err := db.WithContext(ctx).Model(&Order{}).Where("id = ?", orderID).First(&order).Error
+	if err != nil {
+		return order, err
+	}
+
+	err = order.Transition(ctx, db, StatusCancelled, "cancelled by the operator", nil, nil)
+	if err != nil {
+		return order, err
+	}
+
+	scheduler.Default.Cancel(buyJobKey(order.ID))
+	scheduler.Default.Cancel(sellJobKey(order.ID))
+
+	err = db.WithContext(ctx).Model(&ScheduledJob{}).Where("order_id = ? AND status = ?", order.ID, JobStatusPending).
+		Update("status", JobStatusDone).Error
+	if err != nil {
+		logger.Error(ctx, "error closing jobs of cancelled order", zap.Error(err))
+	}
+
+	if positionMonitor != nil {
+		positionMonitor.Untrack(order.ID)
+	}
+
+	return order, nil
+}
@@ -0,0 +1,220 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/exchange"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReconcileSellingOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending *PendingSell
+		// the sell placed before the restart, nothing was placed when empty
+		placed string
+		filled string
+		status OrderStatus
+		sold   string
+	}{
+		{
+			name:    "sold before the restart",
+			pending: &PendingSell{ClientOrderID: "nlssold", Quantity: decimal.RequireFromString("24.975"), LevelsDone: 1, Final: true},
+			placed:  "nlssold",
+			status:  StatusSold,
+			sold:    "24.975",
+		},
+		{
+			name:    "partly sold before the restart",
+			pending: &PendingSell{ClientOrderID: "nlshalf", Quantity: decimal.RequireFromString("12"), LevelsDone: 1},
+			placed:  "nlshalf",
+			status:  StatusBought,
+			sold:    "12",
+		},
+		{
+			name:    "limit sell left on the book",
+			pending: &PendingSell{ClientOrderID: "nlsbook", Quantity: decimal.RequireFromString("24.975"), LevelsDone: 1, Final: true},
+			placed:  "nlsbook",
+			filled:  "4",
+			status:  StatusBought,
+			sold:    "4",
+		},
+		{
+			name:    "sell never placed",
+			pending: &PendingSell{ClientOrderID: "nlslost", Quantity: decimal.RequireFromString("24.975"), LevelsDone: 1, Final: true},
+			status:  StatusBought,
+		},
+		{
+			name:   "no pending sell",
+			status: StatusBought,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			ex := newFakeExchange("2")
+			useFakeExchange(t, ex)
+			order := boughtTestOrder(t, db, ex)
+
+			updates := map[string]interface{}{}
+			if test.pending != nil {
+				updates["pending_sell"] = *test.pending
+			}
+			if err := order.Transition(context.Background(), db, StatusSelling, "exit", nil, updates); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.placed != "" {
+				orderType := exchange.OrderTypeMarket
+				if test.filled != "" {
+					orderType = exchange.OrderTypeLimit
+					sellOrderType := string(orderType)
+					if err := db.Model(&Order{}).Where("id = ?", order.ID).Update("sell_order_type", sellOrderType).Error; err != nil {
+						t.Fatal(err)
+					}
+					ex.fill = func(request exchange.OrderRequest) decimal.Decimal {
+						return decimal.RequireFromString(test.filled)
+					}
+				}
+
+				_, err := ex.place(exchange.OrderRequest{
+					Symbol:        "FOOUSDT",
+					Side:          exchange.OrderSideSell,
+					Type:          orderType,
+					Quantity:      test.pending.Quantity,
+					Price:         ex.price,
+					ClientOrderID: test.placed,
+				}, fakeFill(test.pending.Quantity, test.filled))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			order = reloadOrder(t, db, order)
+			if err := reconcileSellingOrder(context.Background(), db, &order); err != nil {
+				t.Fatal(err)
+			}
+
+			reloaded := reloadOrder(t, db, order)
+			if reloaded.Status != test.status || order.Status != test.status {
+				t.Errorf("status = %s, want %s", reloaded.Status, test.status)
+			}
+			if reloaded.PendingSell != nil {
+				t.Errorf("pending sell = %+v, want it cleared", reloaded.PendingSell)
+			}
+
+			if test.sold == "" {
+				if reloaded.SoldQuantity != nil || reloaded.TakeProfitsDone != 0 {
+					t.Errorf("sold %v with %d levels, want nothing", reloaded.SoldQuantity, reloaded.TakeProfitsDone)
+				}
+				return
+			}
+			if reloaded.SoldQuantity == nil || reloaded.SoldQuantity.Cmp(decimal.RequireFromString(test.sold)) != 0 {
+				t.Errorf("sold quantity = %v, want %s", reloaded.SoldQuantity, test.sold)
+			}
+			if reloaded.TakeProfitsDone != 1 {
+				t.Errorf("levels done = %d, want 1", reloaded.TakeProfitsDone)
+			}
+			if test.filled != "" && len(ex.cancelled) != 1 {
+				t.Errorf("cancelled = %v, want the rest of the limit sell", ex.cancelled)
+			}
+		})
+	}
+}
+
+func TestReconcileSellingOrderKeepsSellingWhenTheLookupFails(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	useFakeExchange(t, ex)
+	order := boughtTestOrder(t, db, ex)
+
+	pending := PendingSell{ClientOrderID: "nlsdown", OrderID: "fake-9", Quantity: decimal.RequireFromString("24.975"), Final: true}
+	err := order.Transition(context.Background(), db, StatusSelling, "exit", nil, map[string]interface{}{"pending_sell": pending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex.getErr = errors.New("connection reset by peer")
+	order = reloadOrder(t, db, order)
+	if err := reconcileSellingOrder(context.Background(), db, &order); err == nil {
+		t.Fatal("reconciled without reaching the exchange")
+	}
+
+	reloaded := reloadOrder(t, db, order)
+	if reloaded.Status != StatusSelling {
+		t.Errorf("status = %s, want %s", reloaded.Status, StatusSelling)
+	}
+	if reloaded.PendingSell == nil || reloaded.PendingSell.OrderID != pending.OrderID {
+		t.Errorf("pending sell = %+v, want it kept", reloaded.PendingSell)
+	}
+}
+
+// fakeFill is how much of an order placed by hand on the fake executes
+func fakeFill(quantity decimal.Decimal, filled string) decimal.Decimal {
+	if filled == "" {
+		return quantity
+	}
+	return decimal.RequireFromString(filled)
+}
+
+func TestCheckExitSettlesAPlacedSell(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := boughtTestOrder(t, db, ex)
+
+	// the sell went through but its fills could not be read when it was placed
+	response, err := ex.PlaceMarketOrder(exchange.OrderRequest{
+		Symbol:        "FOOUSDT",
+		Side:          exchange.OrderSideSell,
+		Type:          exchange.OrderTypeMarket,
+		Quantity:      *order.Quantity,
+		ClientOrderID: "nlsplaced",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending := PendingSell{ClientOrderID: "nlsplaced", OrderID: response.OrderId, Quantity: *order.Quantity, LevelsDone: 1, Final: true}
+	err = order.Transition(context.Background(), db, StatusSelling, "take profit 1", nil, map[string]interface{}{"pending_sell": pending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := checkExit(context.Background(), db, ex, order.ID)
+	if err != nil || !done {
+		t.Fatalf("done = %v %v, want the sell settled", done, err)
+	}
+	if status := reloadOrder(t, db, order).Status; status != StatusSold {
+		t.Errorf("status = %s, want %s", status, StatusSold)
+	}
+}
+
+func TestExitPositionKeepsThePendingSell(t *testing.T) {
+	db := newTestDB(t)
+	ex := newFakeExchange("2")
+	order := boughtTestOrder(t, db, ex)
+
+	err := exitPosition(context.Background(), db, ex, order, exitDecision{Reason: "take profit 1", Fraction: 0.5, LevelsDone: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pending sell is only kept while the order is selling
+	if reloaded := reloadOrder(t, db, order); reloaded.PendingSell != nil {
+		t.Errorf("pending sell = %+v, want it cleared", reloaded.PendingSell)
+	}
+
+	events, err := GetOrderEvents(context.Background(), db, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := ex.requests[len(ex.requests)-1]
+	if len(request.ClientOrderID) != 32 || request.ClientOrderID[:3] != "nls" {
+		t.Errorf("sell client order id = %q, want a 32 characters nls id", request.ClientOrderID)
+	}
+	if last := events[len(events)-1]; last.FromStatus != StatusSelling || last.ToStatus != StatusBought {
+		t.Errorf("last event = %s to %s, want selling to bought", last.FromStatus, last.ToStatus)
+	}
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"NewListingBot/logger"
+	"NewListingBot/scheduler"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	JobKindBuy  = "buy"
+	JobKindSell = "sell"
+)
+
+const (
+	JobStatusPending = "pending"
+	JobStatusDone    = "done"
+	JobStatusMissed  = "missed"
+)
+
+// MissedPolicyExecute runs a job that became due while the server was down as soon as it is back,
+// MissedPolicySkip only marks it as missed
+const (
+	MissedPolicyExecute = "execute"
+	MissedPolicySkip    = "skip"
+)
+
+// ScheduledJob is the persisted copy of a job armed on the scheduler so it survives restarts
+type ScheduledJob struct {
+	BaseModel
+	OrderID uuid.UUID  `json:"order_id" gorm:"type:uuid;index"`
+	Kind    string     `json:"kind"`
+	RunAt   *time.Time `json:"run_at"`
+	Status  string     `json:"status" gorm:"index"`
+}
+
+func (order *Order) missedPolicy() string {
+	if order.MissedPolicy != nil && *order.MissedPolicy == MissedPolicyExecute {
+		return MissedPolicyExecute
+	}
+	return MissedPolicySkip
+}
+
+func createScheduledJob(ctx context.Context, db *gorm.DB, orderID uuid.UUID, kind string, runAt time.Time) (ScheduledJob, error) {
+	job := ScheduledJob{
+		OrderID: orderID,
+		Kind:    kind,
+		RunAt:   &runAt,
+		Status:  JobStatusPending,
+	}
+
+	err := db.WithContext(ctx).Model(&ScheduledJob{}).Create(&job).Error
+	return job, err
+}
+
+func markScheduledJob(ctx context.Context, db *gorm.DB, jobID uuid.UUID, status string) {
+	err := db.WithContext(ctx).Model(&ScheduledJob{}).Where("id = ?", jobID).Update("status", status).Error
+	if err != nil {
+		logger.Error(ctx, "error updating scheduled job", zap.String("job_id", jobID.String()), zap.Error(err))
+	}
+}
+
+// RecoverScheduledJobs re-arms the jobs that were still pending when the server stopped.
+// Jobs whose time already passed are executed right away or marked as missed depending on the order missed policy.
+// Paper orders cut in the middle of a trade are closed, their paper state did not survive the restart.
+func RecoverScheduledJobs(ctx context.Context, db *gorm.DB) {
+	var jobs []ScheduledJob
+
+	err := db.WithContext(ctx).Model(&ScheduledJob{}).Where("status = ?", JobStatusPending).Find(&jobs).Error
+	if err != nil {
+		logger.Error(ctx, "error fetching pending scheduled jobs", zap.Error(err))
+		return
+	}
+
+	now := scheduler.Default.Now()
+	for _, job := range jobs {
+		var order Order
+
+		err := db.WithContext(ctx).Model(&Order{}).Where("id = ?", job.OrderID).First(&order).Error
+		if err != nil {
+			logger.Error(ctx, "error fetching order of scheduled job", zap.String("job_id", job.ID.String()), zap.Error(err))
+			continue
+		}
+
+		closed, err := closeLostPaperOrder(ctx, db, &order)
+		if err != nil {
+			logger.Error(ctx, "error closing lost paper order", zap.String("order_id", order.ID.String()), zap.Error(err))
+			continue
+		}
+
+		if !closed && order.Status == StatusBuying {
+			err = reconcileBuyingOrder(ctx, db, &order)
+			if err != nil {
+				logger.Error(ctx, "error reconciling buying order", zap.String("order_id", order.ID.String()), zap.Error(err))
+				continue
+			}
+		}
+
+		// a bought order needs no more buy attempts and a closed one nothing at all
+		if (job.Kind == JobKindBuy && order.Status != StatusArmed) || order.Status.IsFinal() {
+			markScheduledJob(ctx, db, job.ID, JobStatusDone)
+			continue
+		}
+
+		// a buy job is still alive as long as the last attempt of its burst is ahead
+		deadline := *job.RunAt
+		if job.Kind == JobKindBuy {
+			deadline = order.burstPlan().Last(*job.RunAt)
+		}
+
+		if now.Before(deadline) {
+			switch job.Kind {
+			case JobKindBuy:
+				armBuyJob(db, order, job)
+			case JobKindSell:
+				armSellJob(db, order, job)
+			}
+			continue
+		}
+
+		if order.missedPolicy() == MissedPolicyExecute {
+			go executeMissedJob(db, order, job)
+			continue
+		}
+
+		logger.Info(ctx, "scheduled job missed while the server was down",
+			zap.String("job_id", job.ID.String()), zap.String("order_id", order.ID.String()), zap.String("kind", job.Kind))
+		markScheduledJob(ctx, db, job.ID, JobStatusMissed)
+
+		if job.Kind == JobKindBuy && order.Status == StatusArmed {
+			err = order.Transition(ctx, db, StatusExpired, "buy job missed while the server was down", nil, nil)
+			if err != nil {
+				logger.Error(ctx, "error expiring order", zap.Error(err))
+			}
+		}
+	}
+}
+
+func executeMissedJob(db *gorm.DB, order Order, job ScheduledJob) {
+	ctx := context.Background()
+
+	ex, err := exchangeForOrder(order)
+	if err != nil {
+		logger.Error(ctx, "error resolving exchange for missed job", zap.Error(err))
+		return
+	}
+
+	switch job.Kind {
+	case JobKindBuy:
+		err = buy(ctx, db, ex, order)
+	case JobKindSell:
+		err = sell(ctx, db, order.ID)
+	}
+	markScheduledJob(ctx, db, job.ID, JobStatusDone)
+
+	if err != nil && !errors.Is(err, errBuyAttemptSkipped) {
+		logger.Error(ctx, "error executing missed job", zap.String("kind", job.Kind), zap.Error(err))
+	}
+}
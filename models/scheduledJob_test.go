@@ -0,0 +1,64 @@
+package models
+
+import (
+	"NewListingBot/decimal"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecoverScheduledJobsClosesLostPaperOrders(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    OrderStatus
+		kind      string
+		runAt     time.Duration
+		want      OrderStatus
+		jobStatus string
+	}{
+		{name: "buy cut by the restart", status: StatusBuying, kind: JobKindBuy, runAt: -time.Hour, want: StatusExpired, jobStatus: JobStatusMissed},
+		{name: "bought position", status: StatusBought, kind: JobKindSell, runAt: time.Hour, want: StatusCancelled, jobStatus: JobStatusDone},
+		{name: "sell cut by the restart", status: StatusSelling, kind: JobKindSell, runAt: time.Hour, want: StatusFailed, jobStatus: JobStatusDone},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newTestDB(t)
+			ctx := context.Background()
+
+			order := createTestOrder(t, db, test.status)
+			pending := &PendingSell{ClientOrderID: "nlspaper", Quantity: decimal.New(20), Final: true}
+			err := db.Model(&order).Updates(Order{Paper: boolPointer(true), PendingSell: pending}).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			job, err := createScheduledJob(ctx, db, order.ID, test.kind, time.Now().Add(test.runAt))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			RecoverScheduledJobs(ctx, db)
+
+			reloaded := reloadOrder(t, db, order)
+			if reloaded.Status != test.want {
+				t.Errorf("status = %s, want %s", reloaded.Status, test.want)
+			}
+			if test.status == StatusSelling && reloaded.PendingSell != nil {
+				t.Errorf("pending sell = %+v, want none", reloaded.PendingSell)
+			}
+
+			var recovered ScheduledJob
+			if err := db.Model(&ScheduledJob{}).Where("id = ?", job.ID).First(&recovered).Error; err != nil {
+				t.Fatal(err)
+			}
+			if recovered.Status != test.jobStatus {
+				t.Errorf("job = %s, want %s", recovered.Status, test.jobStatus)
+			}
+		})
+	}
+}
+
+func boolPointer(value bool) *bool {
+	return &value
+}
@@ -15,5 +15,12 @@ func HttpRoutes(app *fiber.App) {
 func Routers(incomingRoutes *fiber.App) {
 	incomingRoutes.Get("api/v1/orders", controllers.OrderListController)
 	incomingRoutes.Post("api/v1/orders", controllers.OrderCreateController)
+	incomingRoutes.Post("api/v1/orders/:id/approve", controllers.OrderApproveController)
+	incomingRoutes.Post("api/v1/orders/:id/reject", controllers.OrderRejectController)
+	incomingRoutes.Post("api/v1/orders/:id/cancel", controllers.OrderCancelController)
+	incomingRoutes.Get("api/v1/orders/:id/events", controllers.OrderEventsController)
+	incomingRoutes.Get("api/v1/orders/:id/transactions", controllers.OrderTransactionsController)
+	incomingRoutes.Get("api/v1/pnl", controllers.PnLController)
 	incomingRoutes.Get("api/v1/symbols", controllers.GetMarketDataController)
+	incomingRoutes.Get("api/v1/clock", controllers.ClockController)
 }
@@ -1 +1,221 @@
 package scheduler
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// spinWindow is how early the timer wakes up before busy waiting for the exact fire time,
+// the go timers alone are only accurate to about a millisecond
+const spinWindow = 2 * time.Millisecond
+
+// BurstPlan describes the attempts fired around a target time.
+// For every offset, Count attempts are fired Spacing apart starting at target + offset.
+type BurstPlan struct {
+	OffsetsMs []int64 `json:"offsets_ms" validate:"required,min=1,max=50"`
+	Count     int     `json:"count" validate:"min=1,max=20"`
+	SpacingMs int64   `json:"spacing_ms" validate:"min=0,max=10000"`
+}
+
+// DefaultBurstPlan is used when an order does not carry its own plan
+var DefaultBurstPlan = BurstPlan{
+	OffsetsMs: []int64{-200, -100, 0, 100, 250, 500, 1000},
+	Count:     2,
+	SpacingMs: 20,
+}
+
+// Times returns every fire time of the plan for the target, in order
+func (p BurstPlan) Times(target time.Time) []time.Time {
+	count := p.Count
+	if count < 1 {
+		count = 1
+	}
+
+	var times []time.Time
+	for _, offset := range p.OffsetsMs {
+		start := target.Add(time.Duration(offset) * time.Millisecond)
+		for i := 0; i < count; i++ {
+			times = append(times, start.Add(time.Duration(int64(i)*p.SpacingMs)*time.Millisecond))
+		}
+	}
+
+	return times
+}
+
+// Last returns the latest fire time of the plan for the target
+func (p BurstPlan) Last(target time.Time) time.Time {
+	last := target
+	for _, t := range p.Times(target) {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// Clock tells the engine what time it is, the exchange clock can be used so jobs fire on exchange time
+type Clock interface {
+	Now() time.Time
+}
+
+type localClock struct{}
+
+func (localClock) Now() time.Time {
+	return time.Now()
+}
+
+type entry struct {
+	timer *time.Timer
+	clock Clock
+	at    time.Time
+	job   func()
+}
+
+type Engine struct {
+	mu      sync.Mutex
+	clock   Clock
+	entries map[string][]*entry
+}
+
+// Default is the engine shared by the order lifecycle
+var Default = New()
+
+func New() *Engine {
+	return &Engine{
+		clock:   localClock{},
+		entries: map[string][]*entry{},
+	}
+}
+
+// SetClock changes the clock the fire times are compared to, jobs already armed keep their clock
+func (e *Engine) SetClock(clock Clock) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.clock = clock
+}
+
+// Now returns the current time on the engine clock
+func (e *Engine) Now() time.Time {
+	e.mu.Lock()
+	clock := e.clock
+	e.mu.Unlock()
+
+	return clock.Now()
+}
+
+// Schedule runs job at the given time, jobs in the past are run right away
+func (e *Engine) Schedule(key string, at time.Time, job func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.arm(key, at, job)
+}
+
+// ScheduleBurst arms every attempt of the plan around target under the same key.
+// The attempt number starting from 1 is passed to the job.
+func (e *Engine) ScheduleBurst(key string, target time.Time, plan BurstPlan, job func(attempt int)) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	times := plan.Times(target)
+	for index, at := range times {
+		attempt := index + 1
+		e.arm(key, at, func() { job(attempt) })
+	}
+
+	return len(times)
+}
+
+// Cancel stops every job that has not fired yet under the key and returns how many were stopped
+func (e *Engine) Cancel(key string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stopped := 0
+	for _, scheduled := range e.entries[key] {
+		if scheduled.timer.Stop() {
+			stopped++
+		}
+	}
+	delete(e.entries, key)
+
+	return stopped
+}
+
+// Pending returns the number of jobs registered under the key that have not fired yet
+func (e *Engine) Pending(key string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.entries[key])
+}
+
+// ClockChanged re-arms the jobs that have not fired yet once their clock moved by more than the spin window,
+// their timers were set from the time before the change. It returns how many were re-armed.
+func (e *Engine) ClockChanged(change time.Duration) int {
+	if change < 0 {
+		change = -change
+	}
+	if change <= spinWindow {
+		return 0
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rearmed := 0
+	for key, entries := range e.entries {
+		for _, scheduled := range entries {
+			if scheduled.timer.Stop() {
+				e.start(key, scheduled)
+				rearmed++
+			}
+		}
+	}
+
+	return rearmed
+}
+
+// arm must be called with the lock held
+func (e *Engine) arm(key string, at time.Time, job func()) {
+	scheduled := &entry{clock: e.clock, at: at, job: job}
+	e.start(key, scheduled)
+
+	e.entries[key] = append(e.entries[key], scheduled)
+}
+
+// start sets the timer of the entry from its clock, must be called with the lock held
+func (e *Engine) start(key string, scheduled *entry) {
+	clock, at := scheduled.clock, scheduled.at
+
+	scheduled.timer = time.AfterFunc(at.Sub(clock.Now())-spinWindow, func() {
+		// busy wait the last moment so the job fires as close as possible to the requested time
+		for at.Sub(clock.Now()) > 0 {
+			runtime.Gosched()
+		}
+
+		e.done(key, scheduled)
+		scheduled.job()
+	})
+}
+
+func (e *Engine) done(key string, scheduled *entry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	entries := e.entries[key]
+	for index, current := range entries {
+		if current == scheduled {
+			entries = append(entries[:index], entries[index+1:]...)
+			break
+		}
+	}
+
+	if len(entries) == 0 {
+		delete(e.entries, key)
+		return
+	}
+	e.entries[key] = entries
+}
@@ -0,0 +1,132 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// shiftedClock is the local time moved by an offset the test changes
+type shiftedClock struct {
+	mu     sync.Mutex
+	offset time.Duration
+}
+
+func (c *shiftedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return time.Now().Add(c.offset)
+}
+
+func (c *shiftedClock) shift(change time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.offset += change
+}
+
+func TestClockChangedRearmsThePendingJobs(t *testing.T) {
+	clock := &shiftedClock{}
+	engine := New()
+	engine.SetClock(clock)
+
+	fired := make(chan struct{})
+	engine.Schedule("job", clock.Now().Add(time.Hour), func() { close(fired) })
+
+	// a move within the spin window keeps the timers
+	if rearmed := engine.ClockChanged(time.Millisecond); rearmed != 0 {
+		t.Errorf("re-armed %d jobs on a small move, want 0", rearmed)
+	}
+
+	clock.shift(time.Hour - 50*time.Millisecond)
+	if rearmed := engine.ClockChanged(time.Hour - 50*time.Millisecond); rearmed != 1 {
+		t.Fatalf("re-armed %d jobs, want 1", rearmed)
+	}
+
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("the job did not fire on the new time")
+	}
+
+	if pending := engine.Pending("job"); pending != 0 {
+		t.Errorf("%d jobs pending, want 0", pending)
+	}
+}
+
+func TestDefaultBurstPlanTimes(t *testing.T) {
+	target := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	times := DefaultBurstPlan.Times(target)
+
+	// two attempts 20ms apart for each of the 7 offsets
+	var want []time.Duration
+	for _, offset := range []time.Duration{-200, -100, 0, 100, 250, 500, 1000} {
+		want = append(want, offset*time.Millisecond, (offset+20)*time.Millisecond)
+	}
+
+	if len(times) != len(want) {
+		t.Fatalf("%d times, want %d", len(times), len(want))
+	}
+	for i, at := range times {
+		if offset := at.Sub(target); offset != want[i] {
+			t.Errorf("attempt %d at %v, want %v", i+1, offset, want[i])
+		}
+	}
+
+	if last := DefaultBurstPlan.Last(target); last.Sub(target) != 1020*time.Millisecond {
+		t.Errorf("last = %v after the target, want 1.02s", last.Sub(target))
+	}
+
+	// a plan without a count fires once per offset
+	single := BurstPlan{OffsetsMs: []int64{0, 50}, SpacingMs: 20}
+	if times := single.Times(target); len(times) != 2 || times[1].Sub(target) != 50*time.Millisecond {
+		t.Errorf("times = %v, want one per offset", times)
+	}
+}
+
+func TestScheduleBurstFiresEveryAttemptOnTheEngineClock(t *testing.T) {
+	// the engine runs an hour ahead of the local time, a job armed on the local time would never fire here
+	clock := &shiftedClock{offset: time.Hour}
+	engine := New()
+	engine.SetClock(clock)
+
+	target := clock.Now().Add(300 * time.Millisecond)
+	times := DefaultBurstPlan.Times(target)
+
+	var mu sync.Mutex
+	fired := map[int]time.Time{}
+	done := make(chan struct{})
+
+	armed := engine.ScheduleBurst("burst", target, DefaultBurstPlan, func(attempt int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		fired[attempt] = clock.Now()
+		if len(fired) == len(times) {
+			close(done)
+		}
+	})
+	if armed != len(times) {
+		t.Fatalf("armed %d attempts, want %d", armed, len(times))
+	}
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		mu.Lock()
+		defer mu.Unlock()
+		t.Fatalf("%d of %d attempts fired", len(fired), len(times))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for attempt, at := range times {
+		if firedAt := fired[attempt+1]; firedAt.Before(at) {
+			t.Errorf("attempt %d fired %v early", attempt+1, at.Sub(firedAt))
+		}
+	}
+	if pending := engine.Pending("burst"); pending != 0 {
+		t.Errorf("%d attempts pending, want 0", pending)
+	}
+}
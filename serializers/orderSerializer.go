@@ -1,9 +1,33 @@
 package serializers
 
-import "time"
+import (
+	"NewListingBot/decimal"
+	"NewListingBot/models"
+	"NewListingBot/scheduler"
+	"time"
+)
 
 type OrderCreateRequestSerializer struct {
-	Symbol       *string    `json:"symbol" validate:"required"`
-	ScheduleTime *time.Time `json:"schedule_time"  validate:"required"`
-	Price        *float64   `json:"price"  validate:"required"`
+	Symbol       *string              `json:"symbol" validate:"required"`
+	ScheduleTime *time.Time           `json:"schedule_time"  validate:"required"`
+	Price        *decimal.Decimal     `json:"price"  validate:"required"`
+	Venue        *string              `json:"venue" validate:"omitempty,oneof=mexc"`
+	BurstPlan    *scheduler.BurstPlan `json:"burst_plan"`
+	MissedPolicy *string              `json:"missed_policy" validate:"omitempty,oneof=execute skip"`
+
+	BuyOrderType    *string          `json:"buy_order_type" validate:"omitempty,oneof=MARKET LIMIT IMMEDIATE_OR_CANCEL FILL_OR_KILL"`
+	SellOrderType   *string          `json:"sell_order_type" validate:"omitempty,oneof=MARKET LIMIT IMMEDIATE_OR_CANCEL FILL_OR_KILL"`
+	MaxPrice        *decimal.Decimal `json:"max_price" validate:"omitempty,gt=0"`
+	MaxPricePercent *float64         `json:"max_price_percent" validate:"omitempty,gt=0"`
+
+	ExitPlan *models.ExitPlan `json:"exit_plan"`
+	// simulated on the paper exchange, defaults to the PAPER_TRADING setting
+	Paper *bool `json:"paper"`
+}
+
+type OrderApproveRequestSerializer struct {
+	ScheduleTime    *time.Time       `json:"schedule_time"`
+	Price           *decimal.Decimal `json:"price" validate:"omitempty,gt=0"`
+	MaxPrice        *decimal.Decimal `json:"max_price" validate:"omitempty,gt=0"`
+	MaxPricePercent *float64         `json:"max_price_percent" validate:"omitempty,gt=0"`
 }